@@ -209,6 +209,39 @@ func TestRunCopyWithOutput(t *testing.T) {
 			wantContains:   []string{"Copying to vault", "Skipped: .config/missing"},
 			wantCopyCalled: true,
 		},
+		{
+			name: "copy with template drift",
+			cfg: &config.Config{
+				Git: config.GitModeDisable,
+				Watching: []config.Watched{
+					{Path: ".gitconfig", Enabled: true, Template: true},
+				},
+			},
+			copyResult: &snapfig.CopyResult{
+				Copied:        []string{".gitconfig"},
+				TemplateDrift: []string{".gitconfig"},
+			},
+			wantContains:   []string{"Drifted: .gitconfig"},
+			wantCopyCalled: true,
+		},
+		{
+			name: "copy continuing on errors",
+			cfg: &config.Config{
+				Git: config.GitModeDisable,
+				Watching: []config.Watched{
+					{Path: ".config/app", Enabled: true},
+				},
+			},
+			copyResult: &snapfig.CopyResult{
+				Copied:  []string{".config/app"},
+				Special: []string{".config/app/sock (socket)"},
+				Errors: []snapfig.CopyError{
+					{Path: ".config/app/secret.db", Op: "copy", Err: os.ErrPermission},
+				},
+			},
+			wantContains:   []string{"Left out: .config/app/sock (socket)", "Not copied (1):", "copy: .config/app/secret.db: permission denied"},
+			wantCopyCalled: true,
+		},
 		{
 			name:         "no paths configured",
 			cfg:          &config.Config{Git: config.GitModeDisable, Watching: nil},
@@ -244,6 +277,25 @@ func TestRunCopyWithOutput(t *testing.T) {
 			wantErr:         true,
 			wantErrContains: "permission denied",
 		},
+		{
+			name: "commit blocked by secrets",
+			cfg: &config.Config{
+				Git: config.GitModeDisable,
+				Watching: []config.Watched{
+					{Path: ".kube", Enabled: true},
+				},
+			},
+			copyResult: &snapfig.CopyResult{
+				Copied: []string{".kube"},
+				Findings: []snapfig.SecretFinding{
+					{Path: ".kube/config", Line: 12, Rule: "kube-credential", Match: "toke****"},
+				},
+			},
+			copyErr:         snapfig.ErrCommitBlocked,
+			wantErr:         true,
+			wantErrContains: "commit blocked",
+			wantContains:    []string{"Possible secrets found (1)", ".kube/config:12", "kube-credential"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -299,6 +351,56 @@ func TestRunCopyWithOutput(t *testing.T) {
 	}
 }
 
+func TestRunCopyDryRun(t *testing.T) {
+	withMockedDeps(t, func() {
+		cfg := &config.Config{
+			Git:      config.GitModeDisable,
+			Watching: []config.Watched{{Path: ".config/nvim", Enabled: true}},
+		}
+		mockSvc := snapfig.NewMockService(cfg)
+		mockSvc.PlanCopyFunc = func() (*snapfig.CopyPlan, error) {
+			return &snapfig.CopyPlan{
+				Changes: []snapfig.PlanEntry{
+					{Action: snapfig.PlanAdd, Path: ".config/nvim/init.lua", Bytes: 2048},
+					{Action: snapfig.PlanRemove, Path: ".config/nvim/old", IsDir: true, Bytes: 10},
+					{Action: snapfig.PlanModify, Path: ".config/nvim/lua.snapfig-symlink", Bytes: 20, Link: "../lua"},
+				},
+				GitDirs:       []snapfig.GitDirPlan{{Path: ".config/nvim/.git", Mode: config.GitModeDisable}},
+				Unchanged:     4,
+				AddedBytes:    2048,
+				ModifiedBytes: 20,
+				RemovedBytes:  10,
+			}, nil
+		}
+		ConfigLoader = func(path string) (*config.Config, error) { return cfg, nil }
+		ServiceFactory = func(cfg *config.Config, path string) (snapfig.Service, error) { return mockSvc, nil }
+
+		copyDryRun = true
+		defer func() { copyDryRun = false }()
+
+		var buf bytes.Buffer
+		if err := runCopyWithOutput(&buf); err != nil {
+			t.Fatalf("runCopyWithOutput() error = %v", err)
+		}
+		if mockSvc.CopyCalled {
+			t.Error("Copy should not be called on a dry run")
+		}
+
+		output := buf.String()
+		for _, want := range []string{
+			"Add:    .config/nvim/init.lua (2.0 KB)",
+			"Remove: .config/nvim/old/ (10 B)",
+			"Modify: .config/nvim/lua.snapfig-symlink -> ../lua",
+			"Git:    .config/nvim/.git (stored as .git_disabled)",
+			"1 to add (2.0 KB), 1 to modify (20 B), 1 to remove (10 B), 4 unchanged",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("output should contain %q, got: %s", want, output)
+			}
+		}
+	})
+}
+
 func TestRunRestoreWithOutput(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -343,6 +445,20 @@ func TestRunRestoreWithOutput(t *testing.T) {
 			wantContains:      []string{"Restoring from vault", "Skipped: .config/missing"},
 			wantRestoreCalled: true,
 		},
+		{
+			name: "restore with permission denied",
+			cfg: &config.Config{
+				Git: config.GitModeDisable,
+				Watching: []config.Watched{
+					{Path: "/etc/hosts", Enabled: true},
+				},
+			},
+			restoreResult: &snapfig.RestoreResult{
+				Denied: []string{"/etc/hosts"},
+			},
+			wantContains:      []string{"Permission denied: /etc/hosts", "privilege_helper"},
+			wantRestoreCalled: true,
+		},
 		{
 			name:         "no paths configured",
 			cfg:          &config.Config{Git: config.GitModeDisable, Watching: nil},
@@ -405,7 +521,7 @@ func TestRunRestoreWithOutput(t *testing.T) {
 				}
 
 				var buf bytes.Buffer
-				err := runRestoreWithOutput(&buf)
+				err := runRestoreWithOutput(&buf, nil)
 
 				if (err != nil) != tt.wantErr {
 					t.Errorf("runRestoreWithOutput() error = %v, wantErr %v", err, tt.wantErr)
@@ -433,6 +549,57 @@ func TestRunRestoreWithOutput(t *testing.T) {
 	}
 }
 
+func TestRunRestoreAtAndPaths(t *testing.T) {
+	cfg := &config.Config{
+		Git:      config.GitModeDisable,
+		Watching: []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+
+	t.Run("at a revision", func(t *testing.T) {
+		withMockedDeps(t, func() {
+			mockSvc := snapfig.NewMockService(cfg)
+			ConfigLoader = func(path string) (*config.Config, error) { return cfg, nil }
+			ServiceFactory = func(cfg *config.Config, path string) (snapfig.Service, error) { return mockSvc, nil }
+
+			restoreAt = "2026-01-15"
+			defer func() { restoreAt = "" }()
+
+			var buf bytes.Buffer
+			if err := runRestoreWithOutput(&buf, []string{".config/nvim/init.lua"}); err != nil {
+				t.Fatalf("runRestoreWithOutput() error = %v", err)
+			}
+			if !mockSvc.RestoreAtCalled || mockSvc.RestoreCalled {
+				t.Fatal("RestoreAt should be called instead of Restore")
+			}
+			if mockSvc.RestoreAtRev != "2026-01-15" || len(mockSvc.RestoreAtPaths) != 1 {
+				t.Errorf("RestoreAt(%q, %v), want the revision and path given", mockSvc.RestoreAtRev, mockSvc.RestoreAtPaths)
+			}
+			if !strings.Contains(buf.String(), "Restoring from vault at 2026-01-15") {
+				t.Errorf("output should name the revision, got: %s", buf.String())
+			}
+		})
+	})
+
+	t.Run("selected paths", func(t *testing.T) {
+		withMockedDeps(t, func() {
+			mockSvc := snapfig.NewMockService(cfg)
+			ConfigLoader = func(path string) (*config.Config, error) { return cfg, nil }
+			ServiceFactory = func(cfg *config.Config, path string) (snapfig.Service, error) { return mockSvc, nil }
+
+			var buf bytes.Buffer
+			if err := runRestoreWithOutput(&buf, []string{".config/nvim"}); err != nil {
+				t.Fatalf("runRestoreWithOutput() error = %v", err)
+			}
+			if !mockSvc.RestoreSelectiveCalled || mockSvc.RestoreCalled {
+				t.Fatal("RestoreSelective should be called instead of Restore")
+			}
+			if !strings.Contains(buf.String(), "Restored: .config/nvim") {
+				t.Errorf("output should list the restored path, got: %s", buf.String())
+			}
+		})
+	})
+}
+
 func TestRunPullWithOutput(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -714,7 +881,70 @@ func TestRunPushWithOutput(t *testing.T) {
 	}
 }
 
+func TestRunVaultMigrateWithOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		result       *snapfig.MigrateResult
+		migrateErr   error
+		wantErr      bool
+		wantContains []string
+	}{
+		{
+			name: "legacy markers migrated",
+			result: &snapfig.MigrateResult{
+				Markers: []string{".config/app/current.snapfig-symlink"},
+				Invalid: []string{".config/app/broken.snapfig-symlink"},
+			},
+			wantContains: []string{
+				"Migrated: .config/app/current.snapfig-symlink",
+				"Unreadable: .config/app/broken.snapfig-symlink",
+				"Migrated 1 symlink marker(s).",
+			},
+		},
+		{
+			name:         "nothing to migrate",
+			result:       &snapfig.MigrateResult{},
+			wantContains: []string{"Vault is already up to date."},
+		},
+		{
+			name:       "migrate error",
+			migrateErr: fmt.Errorf("permission denied"),
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withMockedDeps(t, func() {
+				cfg := &config.Config{Git: config.GitModeDisable}
+				mockSvc := snapfig.NewMockService(cfg)
+				mockSvc.MigrateVaultFunc = func() (*snapfig.MigrateResult, error) {
+					return tt.result, tt.migrateErr
+				}
+				ConfigLoader = func(path string) (*config.Config, error) { return cfg, nil }
+				ServiceFactory = func(cfg *config.Config, path string) (snapfig.Service, error) { return mockSvc, nil }
+
+				var buf bytes.Buffer
+				err := runVaultMigrateWithOutput(&buf)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("runVaultMigrateWithOutput() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !mockSvc.MigrateVaultCalled {
+					t.Error("MigrateVault should be called")
+				}
+				for _, want := range tt.wantContains {
+					if !strings.Contains(buf.String(), want) {
+						t.Errorf("output should contain %q, got: %s", want, buf.String())
+					}
+				}
+			})
+		})
+	}
+}
+
 func TestParsePaths(t *testing.T) {
+	home, _ := os.UserHomeDir()
+
 	tests := []struct {
 		name        string
 		input       string
@@ -737,6 +967,20 @@ func TestParsePaths(t *testing.T) {
 			wantFirst:   ".config/nvim",
 			wantGitMode: config.GitModeDisable,
 		},
+		{
+			name:        "single path with b mode",
+			input:       ".config/nvim:b",
+			wantLen:     1,
+			wantFirst:   ".config/nvim",
+			wantGitMode: config.GitModeBundle,
+		},
+		{
+			name:        "single path with r mode",
+			input:       ".config/nvim:r",
+			wantLen:     1,
+			wantFirst:   ".config/nvim",
+			wantGitMode: config.GitModeReference,
+		},
 		{
 			name:        "single path with uppercase G mode",
 			input:       ".config/nvim:G",
@@ -783,8 +1027,15 @@ func TestParsePaths(t *testing.T) {
 			wantGitMode: config.GitModeDisable,
 		},
 		{
-			name:        "path with leading slash",
-			input:       "/.config/nvim:g",
+			name:        "absolute path outside home",
+			input:       "/etc/X11/xorg.conf.d/:g",
+			wantLen:     1,
+			wantFirst:   "/etc/X11/xorg.conf.d",
+			wantGitMode: config.GitModeDisable,
+		},
+		{
+			name:        "absolute path inside home",
+			input:       filepath.Join(home, ".config/nvim") + ":g",
 			wantLen:     1,
 			wantFirst:   ".config/nvim",
 			wantGitMode: config.GitModeDisable,
@@ -1480,11 +1731,11 @@ func TestParsePathsTableDriven(t *testing.T) {
 			},
 		},
 		{
-			name:    "path with leading slash",
-			input:   "/.config/nvim:x",
+			name:    "absolute path outside home",
+			input:   "/etc/hosts:x",
 			wantLen: 1,
 			checkFirst: &config.Watched{
-				Path:    ".config/nvim",
+				Path:    "/etc/hosts",
 				Git:     config.GitModeRemove,
 				Enabled: true,
 			},
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/adrianpk/snapfig/internal/config"
+	"github.com/adrianpk/snapfig/internal/snapfig"
 	"github.com/spf13/cobra"
 )
 
@@ -14,7 +16,16 @@ var copyCmd = &cobra.Command{
 	RunE:  runCopy,
 }
 
+var copyDryRun bool
+
+var planLabels = map[snapfig.PlanAction]string{
+	snapfig.PlanAdd:    "Add:",
+	snapfig.PlanModify: "Modify:",
+	snapfig.PlanRemove: "Remove:",
+}
+
 func init() {
+	copyCmd.Flags().BoolVar(&copyDryRun, "dry-run", false, "Show what would change in the vault without writing it")
 	rootCmd.AddCommand(copyCmd)
 }
 
@@ -39,8 +50,19 @@ func runCopyWithOutput(w io.Writer) error {
 		return err
 	}
 
+	if copyDryRun {
+		return printPlan(w, svc)
+	}
+
 	fmt.Fprintln(w, "Copying to vault...")
-	result, err := svc.Copy()
+	ctx, stop := operationContext()
+	defer stop()
+	report, erase := progressLine()
+	result, err := svc.Copy(ctx, report)
+	erase()
+	if result != nil {
+		printFindings(w, result.Findings, result.Quarantined, result.Unscanned)
+	}
 	if err != nil {
 		return err
 	}
@@ -51,7 +73,110 @@ func runCopyWithOutput(w io.Writer) error {
 	for _, p := range result.Skipped {
 		fmt.Fprintf(w, "  Skipped: %s (not found)\n", p)
 	}
+	for _, p := range result.TemplateDrift {
+		fmt.Fprintf(w, "  Drifted: %s (edited locally, update its template in the vault)\n", p)
+	}
+	for _, p := range result.Loops {
+		fmt.Fprintf(w, "  Not followed: %s (symlink loop)\n", p)
+	}
+	for _, p := range result.Special {
+		fmt.Fprintf(w, "  Left out: %s\n", p)
+	}
+	printHookErrors(w, result.HookErrors)
+	printCopyErrors(w, result.Errors)
 
 	fmt.Fprintf(w, "\nDone. %d copied, %d skipped. Vault: %s\n", len(result.Copied), len(result.Skipped), svc.VaultDir())
 	return nil
 }
+
+// printPlan reports what a copy would change in the vault.
+func printPlan(w io.Writer, svc snapfig.Service) error {
+	fmt.Fprintln(w, "Planning copy to vault (dry run)...")
+	plan, err := svc.PlanCopy()
+	if err != nil {
+		return err
+	}
+	printFindings(w, plan.Findings, plan.Quarantined, plan.Unscanned)
+
+	for _, e := range plan.Changes {
+		path := e.Path
+		if e.IsDir {
+			path += "/"
+		}
+		if e.Link != "" {
+			path += " -> " + e.Link
+		}
+		fmt.Fprintf(w, "  %-7s %s (%s)\n", planLabels[e.Action], path, snapfig.FormatSize(e.Bytes))
+	}
+	for _, g := range plan.GitDirs {
+		switch g.Mode {
+		case config.GitModeRemove:
+			fmt.Fprintf(w, "  Git:    %s (left out)\n", g.Path)
+		case config.GitModeBundle:
+			fmt.Fprintf(w, "  Git:    %s (stored as a bundle)\n", g.Path)
+		case config.GitModeReference:
+			fmt.Fprintf(w, "  Git:    %s (referenced by its remote)\n", g.Path)
+		default:
+			fmt.Fprintf(w, "  Git:    %s (stored as .git_disabled)\n", g.Path)
+		}
+	}
+	for _, p := range plan.Skipped {
+		fmt.Fprintf(w, "  Skipped: %s (not found)\n", p)
+	}
+	for _, p := range plan.TemplateDrift {
+		fmt.Fprintf(w, "  Drifted: %s (edited locally, update its template in the vault)\n", p)
+	}
+	for _, p := range plan.Loops {
+		fmt.Fprintf(w, "  Not followed: %s (symlink loop)\n", p)
+	}
+	for _, p := range plan.Special {
+		fmt.Fprintf(w, "  Left out: %s\n", p)
+	}
+
+	fmt.Fprintf(w, "\nDry run. %d to add (%s), %d to modify (%s), %d to remove (%s), %d unchanged. Nothing was written.\n",
+		plan.Count(snapfig.PlanAdd), snapfig.FormatSize(plan.AddedBytes),
+		plan.Count(snapfig.PlanModify), snapfig.FormatSize(plan.ModifiedBytes),
+		plan.Count(snapfig.PlanRemove), snapfig.FormatSize(plan.RemovedBytes),
+		plan.Unchanged)
+	return nil
+}
+
+// printHookErrors reports hooks that failed around an operation.
+func printHookErrors(w io.Writer, failed []snapfig.HookError) {
+	for _, h := range failed {
+		fmt.Fprintf(w, "  Hook failed: %v\n", &h)
+	}
+}
+
+// printCopyErrors summarizes the files and paths a copy continuing on
+// errors could not back up, one per line with what failed.
+func printCopyErrors(w io.Writer, failed []snapfig.CopyError) {
+	if len(failed) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Not copied (%d):\n", len(failed))
+	for _, e := range failed {
+		fmt.Fprintf(w, "  %s: %s: %v\n", e.Op, e.Path, e.Err)
+	}
+}
+
+// printFindings reports suspected secrets found during copy, and the
+// files only scanned in part.
+func printFindings(w io.Writer, findings []snapfig.SecretFinding, quarantined, unscanned []string) {
+	for _, p := range unscanned {
+		fmt.Fprintf(w, "  Not fully scanned: %s (only its first MiB was checked for secrets)\n", p)
+	}
+	if len(findings) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Possible secrets found (%d):\n", len(findings))
+	for _, f := range findings {
+		fmt.Fprintf(w, "  %s:%d  %s  %s\n", f.Path, f.Line, f.Rule, f.Match)
+	}
+	for _, p := range quarantined {
+		fmt.Fprintf(w, "  Quarantined: %s\n", p)
+	}
+	fmt.Fprintln(w, "Add false positives to the secrets allowlist.")
+}
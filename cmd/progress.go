@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/adrianpk/snapfig/internal/snapfig"
+)
+
+// operationContext returns a context cancelled by Ctrl-C, so an
+// interrupted operation stops between files and releases the vault.
+// Copies made with it are committed as triggered from the CLI.
+func operationContext() (context.Context, context.CancelFunc) {
+	ctx := snapfig.WithTrigger(context.Background(), snapfig.TriggerCLI)
+	return signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+}
+
+// progressLine returns a ProgressFunc redrawing one line in place on
+// stderr, and a func erasing it before the results are printed.
+// Nothing is drawn unless stderr is a terminal.
+func progressLine() (snapfig.ProgressFunc, func()) {
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, func() {}
+	}
+
+	report := func(p snapfig.Progress) {
+		fmt.Fprintf(os.Stderr, "\r\033[K  %s", p)
+	}
+	erase := func() {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	return report, erase
+}
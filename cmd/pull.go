@@ -48,11 +48,16 @@ func runPullWithOutput(w io.Writer) error {
 	}
 
 	fmt.Fprintf(w, "Pulling from %s...\n", remoteURL)
-	result, err := svc.Pull()
+	ctx, stop := operationContext()
+	defer stop()
+	report, erase := progressLine()
+	result, err := svc.Pull(ctx, report)
+	erase()
 	if err != nil {
 		return err
 	}
 
+	printHookErrors(w, result.HookErrors)
 	if result.Cloned {
 		fmt.Fprintln(w, "Cloned successfully.")
 	} else {
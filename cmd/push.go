@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/adrianpk/snapfig/internal/snapfig"
 	"github.com/spf13/cobra"
 )
 
@@ -43,8 +46,19 @@ func runPushWithOutput(w io.Writer) error {
 	}
 
 	fmt.Fprintf(w, "Pushing to %s...\n", url)
-	if err := svc.Push(); err != nil {
-		return err
+	ctx, stop := operationContext()
+	defer stop()
+	report, erase := progressLine()
+	err = svc.Push(ctx, report)
+	erase()
+	// The push went through when only hooks failed
+	if err != nil {
+		if !errors.Is(err, snapfig.ErrHookFailed) {
+			return err
+		}
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(w, "  Hook failed: %s\n", line)
+		}
 	}
 
 	fmt.Fprintln(w, "Done.")
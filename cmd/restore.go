@@ -4,26 +4,30 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/adrianpk/snapfig/internal/snapfig"
 	"github.com/spf13/cobra"
 )
 
 var restoreCmd = &cobra.Command{
 	Use:   "restore",
 	Short: "Restore paths from the vault",
-	Long:  "Restores all enabled watched paths from ~/.snapfig/vault/ to their original locations. Existing files are backed up with a .YYYYMMDDHHMM.bak suffix before overwriting.",
+	Long:  "Restores all enabled watched paths from ~/.snapfig/vault/ to their original locations, or only the given paths and files within them. With --at, files are read from an earlier vault commit, tag or date without changing the vault. Files about to be overwritten are backed up first, under ~/.snapfig/backups/<YYYYMMDDHHMMSS>/ or next to them with a .YYYYMMDDHHMMSS.bak suffix, as set by backups in the config.",
 	RunE:  runRestore,
 }
 
+var restoreAt string
+
 func init() {
+	restoreCmd.Flags().StringVar(&restoreAt, "at", "", "Restore from a vault commit, tag or date (YYYY-MM-DD [HH:MM[:SS]])")
 	rootCmd.AddCommand(restoreCmd)
 }
 
 // runRestore delegates to runRestoreWithOutput which is unit tested.
 func runRestore(cmd *cobra.Command, args []string) error {
-	return runRestoreWithOutput(cmd.OutOrStdout())
+	return runRestoreWithOutput(cmd.OutOrStdout(), args)
 }
 
-func runRestoreWithOutput(w io.Writer) error {
+func runRestoreWithOutput(w io.Writer, paths []string) error {
 	cfg, configPath, err := loadConfigWithPath()
 	if err != nil {
 		return err
@@ -39,8 +43,22 @@ func runRestoreWithOutput(w io.Writer) error {
 		return err
 	}
 
-	fmt.Fprintln(w, "Restoring from vault...")
-	result, err := svc.Restore()
+	ctx, stop := operationContext()
+	defer stop()
+	report, erase := progressLine()
+	var result *snapfig.RestoreResult
+	switch {
+	case restoreAt != "":
+		fmt.Fprintf(w, "Restoring from vault at %s...\n", restoreAt)
+		result, err = svc.RestoreAt(ctx, restoreAt, paths, report)
+	case len(paths) > 0:
+		fmt.Fprintln(w, "Restoring from vault...")
+		result, err = svc.RestoreSelective(ctx, paths, report)
+	default:
+		fmt.Fprintln(w, "Restoring from vault...")
+		result, err = svc.Restore(ctx, report)
+	}
+	erase()
 	if err != nil {
 		return err
 	}
@@ -54,6 +72,19 @@ func runRestoreWithOutput(w io.Writer) error {
 	for _, p := range result.Skipped {
 		fmt.Fprintf(w, "  Skipped: %s (not in vault)\n", p)
 	}
+	for _, p := range result.Denied {
+		fmt.Fprintf(w, "  Permission denied: %s (set privilege_helper or run as root)\n", p)
+	}
+	for _, p := range result.Kept {
+		fmt.Fprintf(w, "  Kept: %s (directory where a symlink was stored, marker restored next to it)\n", p)
+	}
+	for _, p := range result.Unreferenced {
+		fmt.Fprintf(w, "  Not cloned: %s, restored from the working tree copy\n", p)
+	}
+	for _, p := range result.Diverged {
+		fmt.Fprintf(w, "  Diverged: %s\n", p)
+	}
+	printHookErrors(w, result.HookErrors)
 
 	fmt.Fprintf(w, "\nDone. %d restored, %d backed up, %d skipped.\n",
 		len(result.Restored), len(result.Backups), len(result.Skipped))
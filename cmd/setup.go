@@ -34,7 +34,9 @@ Examples:
 
 Path format: path:mode where mode is:
   x = remove .git directories (default)
-  g = preserve .git as .git_disabled`,
+  g = preserve .git as .git_disabled
+  b = store .git as a single git bundle with its refs and remotes
+  r = record the remote, branch and commit, and clone again on restore`,
 	RunE: runSetup,
 }
 
@@ -100,8 +102,13 @@ func runSetup(cmd *cobra.Command, args []string) error {
 	fmt.Println("\nWatching:")
 	for _, w := range watching {
 		mode := "x"
-		if w.Git == config.GitModeDisable {
+		switch w.Git {
+		case config.GitModeDisable:
 			mode = "g"
+		case config.GitModeBundle:
+			mode = "b"
+		case config.GitModeReference:
+			mode = "r"
 		}
 		fmt.Printf("  %s [%s]\n", w.Path, mode)
 	}
@@ -113,7 +120,11 @@ func runSetup(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
 
-	result, err := svc.Copy()
+	ctx, stop := operationContext()
+	defer stop()
+	report, erase := progressLine()
+	result, err := svc.Copy(ctx, report)
+	erase()
 	if err != nil {
 		return fmt.Errorf("initial copy failed: %w", err)
 	}
@@ -167,17 +178,32 @@ func parsePaths(pathsStr string) ([]config.Watched, error) {
 				gitMode = config.GitModeDisable
 			case "x":
 				gitMode = config.GitModeRemove
+			case "b":
+				gitMode = config.GitModeBundle
+			case "r":
+				gitMode = config.GitModeReference
 			default:
-				return nil, fmt.Errorf("invalid mode '%s' for path '%s' (use 'x' or 'g')", mode, path)
+				return nil, fmt.Errorf("invalid mode '%s' for path '%s' (use 'x', 'g', 'b' or 'r')", mode, path)
 			}
 		} else {
 			path = part
 		}
 
-		// Clean path
+		// Clean path: home paths are stored relative to $HOME,
+		// absolute paths outside it are kept as they are
 		path = strings.TrimSpace(path)
 		path = strings.TrimPrefix(path, "~/")
-		path = strings.TrimPrefix(path, "/")
+		if filepath.IsAbs(path) {
+			path = filepath.Clean(path)
+			if home, err := os.UserHomeDir(); err == nil {
+				if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+					path = rel
+				}
+			}
+			if path == "." || path == "/" {
+				continue
+			}
+		}
 
 		if path == "" {
 			continue
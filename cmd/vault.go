@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Maintain the vault",
+	Long:  "Commands that operate on the vault itself rather than on watched paths.",
+}
+
+var vaultMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite vault files stored in older formats",
+	Long:  "Rewrites legacy 'ln -s' symlink markers in the vault in the structured format and commits the change.",
+	RunE:  runVaultMigrate,
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultMigrateCmd)
+	rootCmd.AddCommand(vaultCmd)
+}
+
+// runVaultMigrate delegates to runVaultMigrateWithOutput which is unit tested.
+func runVaultMigrate(cmd *cobra.Command, args []string) error {
+	return runVaultMigrateWithOutput(cmd.OutOrStdout())
+}
+
+func runVaultMigrateWithOutput(w io.Writer) error {
+	cfg, configPath, err := loadConfigWithPath()
+	if err != nil {
+		return err
+	}
+
+	svc, err := ServiceFactory(cfg, configPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Migrating %s...\n", svc.VaultDir())
+	result, err := svc.MigrateVault()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range result.Markers {
+		fmt.Fprintf(w, "  Migrated: %s\n", p)
+	}
+	for _, p := range result.Invalid {
+		fmt.Fprintf(w, "  Unreadable: %s (left as is)\n", p)
+	}
+
+	if len(result.Markers) == 0 {
+		fmt.Fprintln(w, "Vault is already up to date.")
+	} else {
+		fmt.Fprintf(w, "Migrated %d symlink marker(s).\n", len(result.Markers))
+	}
+
+	if result.GitError != nil {
+		fmt.Fprintf(w, "Warning: git commit failed: %v\n", result.GitError)
+	}
+	return nil
+}
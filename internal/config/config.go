@@ -5,6 +5,10 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,33 +17,191 @@ import (
 type GitMode string
 
 const (
-	GitModeDisable GitMode = "disable"
-	GitModeRemove  GitMode = "remove"
+	GitModeDisable   GitMode = "disable"
+	GitModeRemove    GitMode = "remove"
+	GitModeBundle    GitMode = "bundle"    // history as one git bundle file, refs and remotes beside it
+	GitModeReference GitMode = "reference" // remote, branch and commit in the manifest, cloned on restore
 )
 
+// SymlinkPolicy defines how symlinks inside a watched path are stored.
+type SymlinkPolicy string
+
+const (
+	SymlinksMarker   SymlinkPolicy = "marker"   // a versioned JSON marker describing the link
+	SymlinksPreserve SymlinkPolicy = "preserve" // the symlink itself
+	SymlinksFollow   SymlinkPolicy = "follow"   // the content of the target
+)
+
+// SecretsPolicy defines what happens when the secret scanner finds something.
+type SecretsPolicy string
+
+const (
+	SecretsOff        SecretsPolicy = "off"
+	SecretsWarn       SecretsPolicy = "warn"       // copy and commit, report findings
+	SecretsQuarantine SecretsPolicy = "quarantine" // keep the file out of the vault
+	SecretsBlock      SecretsPolicy = "block"      // keep the file out and skip the commit
+)
+
+// ErrorPolicy defines what a copy does when a file or watched path
+// cannot be backed up.
+type ErrorPolicy string
+
+const (
+	OnErrorStop     ErrorPolicy = "stop"     // fail the copy, commit nothing
+	OnErrorContinue ErrorPolicy = "continue" // report the failure, back up the rest
+)
+
+// BackupLocation defines where restore saves a file it is about to overwrite.
+type BackupLocation string
+
+const (
+	BackupsCentral BackupLocation = "central" // one tree per restore under the backups dir
+	BackupsBeside  BackupLocation = "beside"  // next to the file, as <name>.<YYYYMMDDHHMMSS>.bak
+	BackupsOff     BackupLocation = "off"
+)
+
+// BackupsConfig holds settings for the backups restore makes of the
+// files it overwrites.
+type BackupsConfig struct {
+	Location BackupLocation `yaml:"location,omitempty"` // default: central
+	Dir      string         `yaml:"dir,omitempty"`      // central tree, default: ~/.snapfig/backups
+	Keep     int            `yaml:"keep,omitempty"`     // restores kept centrally, or backups per file beside it; default: 10
+}
+
+// DefaultBackupsKeep is how many backups are kept when backups.keep is unset.
+const DefaultBackupsKeep = 10
+
+// EffectiveLocation returns where backups go, defaulting to central.
+func (b BackupsConfig) EffectiveLocation() BackupLocation {
+	if b.Location == "" {
+		return BackupsCentral
+	}
+	return b.Location
+}
+
+// EffectiveKeep returns how many backups are kept.
+func (b BackupsConfig) EffectiveKeep() int {
+	if b.Keep > 0 {
+		return b.Keep
+	}
+	return DefaultBackupsKeep
+}
+
+// SecretsConfig holds settings for secret scanning during copy.
+type SecretsConfig struct {
+	Policy    SecretsPolicy `yaml:"policy,omitempty"`    // default: warn
+	Allowlist string        `yaml:"allowlist,omitempty"` // default: ~/.snapfig/secrets-allowlist
+}
+
+// EffectivePolicy returns the configured policy, defaulting to warn.
+func (s SecretsConfig) EffectivePolicy() SecretsPolicy {
+	if s.Policy == "" {
+		return SecretsWarn
+	}
+	return s.Policy
+}
+
+// EncryptionConfig holds the key source for encrypted watched paths.
+// Without a keyfile the passphrase is read from SNAPFIG_PASSPHRASE.
+type EncryptionConfig struct {
+	Keyfile string `yaml:"keyfile,omitempty"` // e.g. ~/.config/snapfig/vault.key
+}
+
+// MetadataConfig controls the file metadata recorded in the vault.
+// Mode, mtime and ownership are always recorded.
+type MetadataConfig struct {
+	Xattrs bool `yaml:"xattrs,omitempty"` // also record extended attributes
+}
+
+// HooksConfig holds shell commands run before and after operations.
+// Timeout applies to each hook, e.g. "30s"; default: 1m.
+type HooksConfig struct {
+	PreCopy     string `yaml:"pre_copy,omitempty"`
+	PostCopy    string `yaml:"post_copy,omitempty"`
+	PreRestore  string `yaml:"pre_restore,omitempty"`
+	PostRestore string `yaml:"post_restore,omitempty"`
+	PrePush     string `yaml:"pre_push,omitempty"`
+	PostPush    string `yaml:"post_push,omitempty"`
+	PrePull     string `yaml:"pre_pull,omitempty"`
+	PostPull    string `yaml:"post_pull,omitempty"`
+	Timeout     string `yaml:"timeout,omitempty"`
+}
+
+// PathHooks holds shell commands run around copying or restoring
+// one watched path.
+type PathHooks struct {
+	PreCopy     string `yaml:"pre_copy,omitempty"`
+	PostCopy    string `yaml:"post_copy,omitempty"` // only when the path changed
+	PreRestore  string `yaml:"pre_restore,omitempty"`
+	PostRestore string `yaml:"post_restore,omitempty"` // only when the path changed
+}
+
+// DefaultHookTimeout is how long a hook may run when hooks.timeout is unset.
+const DefaultHookTimeout = time.Minute
+
 // DaemonConfig holds settings for the background runner.
 type DaemonConfig struct {
 	CopyInterval string `yaml:"copy_interval,omitempty"` // e.g. "1h", "30m"
 	PushInterval string `yaml:"push_interval,omitempty"` // e.g. "24h", "12h"
 	PullInterval string `yaml:"pull_interval,omitempty"` // disabled by default
 	AutoRestore  bool   `yaml:"auto_restore,omitempty"`  // restore after pull
+
+	OnError ErrorPolicy `yaml:"on_error,omitempty"` // for the daemon's copies, default: continue
+}
+
+// EffectiveOnError returns the error policy of the daemon's copies,
+// defaulting to continue: an unattended run backs up what it can.
+func (d DaemonConfig) EffectiveOnError() ErrorPolicy {
+	if d.OnError == "" {
+		return OnErrorContinue
+	}
+	return d.OnError
 }
 
 // Config represents the main Snapfig configuration.
 type Config struct {
-	Git       GitMode      `yaml:"git"`
-	Remote    string       `yaml:"remote,omitempty"`
-	GitToken  string       `yaml:"git_token,omitempty"` // app token for HTTPS auth
-	VaultPath string       `yaml:"vault_path,omitempty"` // custom vault location
-	Watching  []Watched    `yaml:"watching"`
-	Daemon    DaemonConfig `yaml:"daemon,omitempty"`
+	Git        GitMode           `yaml:"git"`
+	Remote     string            `yaml:"remote,omitempty"`
+	GitToken   string            `yaml:"git_token,omitempty"`  // app token for HTTPS auth
+	VaultPath  string            `yaml:"vault_path,omitempty"` // custom vault location
+	Hostname   string            `yaml:"hostname,omitempty"`   // host layer name, default: system hostname
+	Include    []string          `yaml:"include,omitempty"`    // globs applied to every watched path
+	Exclude    []string          `yaml:"exclude,omitempty"`    // globs applied to every watched path
+	Vars       map[string]string `yaml:"vars,omitempty"`       // template variables, override per-host vars files
+	Watching   []Watched         `yaml:"watching"`
+	Daemon     DaemonConfig      `yaml:"daemon,omitempty"`
+	Secrets    SecretsConfig     `yaml:"secrets,omitempty"`
+	Encryption EncryptionConfig  `yaml:"encryption,omitempty"`
+	Metadata   MetadataConfig    `yaml:"metadata,omitempty"`
+	Hooks      HooksConfig       `yaml:"hooks,omitempty"`
+	Backups    BackupsConfig     `yaml:"backups,omitempty"`
+	Workers    int               `yaml:"workers,omitempty"` // parallel file copies, default: number of CPUs
+
+	Transactional   bool   `yaml:"transactional,omitempty"`    // stage the copy, swap it in only when every path succeeded
+	LockTimeout     string `yaml:"lock_timeout,omitempty"`     // wait for a busy vault, e.g. "30s", default: 10s
+	PrivilegeHelper string `yaml:"privilege_helper,omitempty"` // e.g. "sudo", writes system paths on restore
+	CommitTemplate  string `yaml:"commit_template,omitempty"`  // text/template for vault commit messages
+
+	OnError ErrorPolicy `yaml:"on_error,omitempty"` // stop or continue, default: stop
 }
 
+// DefaultLockTimeout is how long an operation waits for another snapfig
+// process to release the vault.
+const DefaultLockTimeout = 10 * time.Second
+
 // Watched represents a directory being observed by Snapfig.
 type Watched struct {
-	Path    string  `yaml:"path"`
-	Git     GitMode `yaml:"git,omitempty"`
-	Enabled bool    `yaml:"enabled"`
+	Path     string   `yaml:"path"`
+	Git      GitMode  `yaml:"git,omitempty"`
+	Enabled  bool     `yaml:"enabled"`
+	Include  []string `yaml:"include,omitempty"`  // only back up matching files
+	Exclude  []string `yaml:"exclude,omitempty"`  // never back up matching files
+	Encrypt  bool     `yaml:"encrypt,omitempty"`  // store files encrypted in the vault
+	Template bool     `yaml:"template,omitempty"` // keep files as templates, render on restore
+
+	HostSpecific bool          `yaml:"host_specific,omitempty"` // store under hosts/<hostname>/
+	Symlinks     SymlinkPolicy `yaml:"symlinks,omitempty"`      // marker, preserve or follow; default: marker
+	Hooks        PathHooks     `yaml:"hooks,omitempty"`
 }
 
 // DefaultConfigDir returns the default configuration directory path.
@@ -123,12 +285,109 @@ func (c *Config) Save(path string) error {
 
 // Validate checks if the configuration is valid.
 func (c *Config) Validate() error {
-	if c.Git != GitModeDisable && c.Git != GitModeRemove {
-		return errors.New("git mode must be 'disable' or 'remove'")
+	switch c.Git {
+	case GitModeDisable, GitModeRemove, GitModeBundle, GitModeReference:
+	default:
+		return errors.New("git mode must be 'disable', 'remove', 'bundle' or 'reference'")
+	}
+	switch c.Secrets.EffectivePolicy() {
+	case SecretsOff, SecretsWarn, SecretsQuarantine, SecretsBlock:
+	default:
+		return errors.New("secrets policy must be 'off', 'warn', 'quarantine' or 'block'")
+	}
+	for _, w := range c.Watching {
+		switch w.EffectiveSymlinks() {
+		case SymlinksMarker, SymlinksPreserve, SymlinksFollow:
+		default:
+			return errors.New("symlinks policy must be 'marker', 'preserve' or 'follow'")
+		}
+		if _, err := filepath.Match(w.Path, ""); err != nil {
+			return errors.New("invalid glob in watched path " + w.Path)
+		}
+	}
+	switch c.Backups.EffectiveLocation() {
+	case BackupsCentral, BackupsBeside, BackupsOff:
+	default:
+		return errors.New("backups location must be 'central', 'beside' or 'off'")
+	}
+	if c.Backups.Keep < 0 {
+		return errors.New("backups keep must not be negative")
+	}
+	for _, policy := range []ErrorPolicy{c.EffectiveOnError(), c.Daemon.EffectiveOnError()} {
+		if policy != OnErrorStop && policy != OnErrorContinue {
+			return errors.New("on_error must be 'stop' or 'continue'")
+		}
+	}
+	if c.Workers < 0 {
+		return errors.New("workers must not be negative")
+	}
+	if c.Hooks.Timeout != "" {
+		if d, err := time.ParseDuration(c.Hooks.Timeout); err != nil || d <= 0 {
+			return errors.New("hooks timeout must be a positive duration such as '30s'")
+		}
+	}
+	if c.LockTimeout != "" {
+		if d, err := time.ParseDuration(c.LockTimeout); err != nil || d < 0 {
+			return errors.New("lock_timeout must be a duration such as '30s'")
+		}
+	}
+	if c.CommitTemplate != "" {
+		if _, err := template.New("commit").Parse(c.CommitTemplate); err != nil {
+			return errors.New("commit_template is not a valid template: " + err.Error())
+		}
+	}
+	if c.Hostname == "." || c.Hostname == ".." || strings.ContainsAny(c.Hostname, `/\`) {
+		return errors.New("hostname must be a plain name")
 	}
 	return nil
 }
 
+// EffectiveWorkers returns the number of files copied or restored
+// in parallel.
+func (c *Config) EffectiveWorkers() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// EffectiveOnError returns the error policy of copies started from the
+// CLI and the TUI, defaulting to stop.
+func (c *Config) EffectiveOnError() ErrorPolicy {
+	if c.OnError == "" {
+		return OnErrorStop
+	}
+	return c.OnError
+}
+
+// EffectiveLockTimeout returns how long to wait for the vault lock.
+func (c *Config) EffectiveLockTimeout() time.Duration {
+	if d, err := time.ParseDuration(c.LockTimeout); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultLockTimeout
+}
+
+// EffectiveTimeout returns how long each hook may run.
+func (h HooksConfig) EffectiveTimeout() time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultHookTimeout
+}
+
+// IsSystem reports whether the watched path is outside $HOME.
+// Such paths are given as absolute paths, e.g. /etc/hosts.
+func (w *Watched) IsSystem() bool {
+	return filepath.IsAbs(w.Path)
+}
+
+// IsPattern reports whether the watched path is a glob, e.g.
+// .config/*/settings.json, standing for every path it matches.
+func (w *Watched) IsPattern() bool {
+	return strings.ContainsAny(w.Path, "*?[")
+}
+
 // EffectiveGitMode returns the git mode for a watched path,
 // falling back to the global setting if not specified.
 func (w *Watched) EffectiveGitMode(global GitMode) GitMode {
@@ -138,6 +397,27 @@ func (w *Watched) EffectiveGitMode(global GitMode) GitMode {
 	return global
 }
 
+// EffectiveSymlinks returns the symlink policy for a watched path,
+// defaulting to marker.
+func (w *Watched) EffectiveSymlinks() SymlinkPolicy {
+	if w.Symlinks == "" {
+		return SymlinksMarker
+	}
+	return w.Symlinks
+}
+
+// EffectiveInclude returns the include globs for a watched path,
+// combining the global list with the path's own.
+func (w *Watched) EffectiveInclude(global []string) []string {
+	return append(append([]string{}, global...), w.Include...)
+}
+
+// EffectiveExclude returns the exclude globs for a watched path,
+// combining the global list with the path's own.
+func (w *Watched) EffectiveExclude(global []string) []string {
+	return append(append([]string{}, global...), w.Exclude...)
+}
+
 // VaultDir returns the vault directory path, using custom path if set.
 func (c *Config) VaultDir() (string, error) {
 	if c.VaultPath != "" {
@@ -154,6 +434,42 @@ func (c *Config) VaultDir() (string, error) {
 	return DefaultVaultDir()
 }
 
+// Host returns the name of this machine's vault layer: the configured
+// hostname, or the system hostname without its domain.
+func (c *Config) Host() (string, error) {
+	if c.Hostname != "" {
+		return c.Hostname, nil
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	return host, nil
+}
+
+// BackupDir returns the central backups directory, using the custom
+// path if set.
+func (c *Config) BackupDir() (string, error) {
+	if c.Backups.Dir != "" {
+		if c.Backups.Dir[0] == '~' {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(home, c.Backups.Dir[1:]), nil
+		}
+		return c.Backups.Dir, nil
+	}
+	dir, err := DefaultSnapfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "backups"), nil
+}
+
 // SnapfigDir returns the base snapfig directory (parent of vault).
 func (c *Config) SnapfigDir() (string, error) {
 	vaultDir, err := c.VaultDir()
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfigDir(t *testing.T) {
@@ -306,6 +308,84 @@ func TestValidate(t *testing.T) {
 			config:  Config{Git: ""},
 			wantErr: true,
 		},
+		{
+			name:    "valid secrets policy",
+			config:  Config{Git: GitModeDisable, Secrets: SecretsConfig{Policy: SecretsBlock}},
+			wantErr: false,
+		},
+		{
+			name:    "invalid secrets policy",
+			config:  Config{Git: GitModeDisable, Secrets: SecretsConfig{Policy: "panic"}},
+			wantErr: true,
+		},
+		{
+			name:    "valid hostname",
+			config:  Config{Git: GitModeDisable, Hostname: "workstation"},
+			wantErr: false,
+		},
+		{
+			name:    "hostname with path separator",
+			config:  Config{Git: GitModeDisable, Hostname: "../laptop"},
+			wantErr: true,
+		},
+		{
+			name:    "negative workers",
+			config:  Config{Git: GitModeDisable, Workers: -1},
+			wantErr: true,
+		},
+		{
+			name:    "valid glob path",
+			config:  Config{Git: GitModeDisable, Watching: []Watched{{Path: ".config/*/settings.json"}}},
+			wantErr: false,
+		},
+		{
+			name:    "malformed glob path",
+			config:  Config{Git: GitModeDisable, Watching: []Watched{{Path: ".config/[a-"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid lock timeout",
+			config:  Config{Git: GitModeDisable, LockTimeout: "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid hooks timeout",
+			config:  Config{Git: GitModeDisable, Hooks: HooksConfig{Timeout: "-1m"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid on_error",
+			config:  Config{Git: GitModeDisable, OnError: "skip"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid daemon on_error",
+			config:  Config{Git: GitModeDisable, Daemon: DaemonConfig{OnError: "ignore"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid backups location",
+			config:  Config{Git: GitModeDisable, Backups: BackupsConfig{Location: "elsewhere"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative backups keep",
+			config:  Config{Git: GitModeDisable, Backups: BackupsConfig{Keep: -1}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid commit template",
+			config:  Config{Git: GitModeDisable, CommitTemplate: "{{ .Summary"},
+			wantErr: true,
+		},
+		{
+			name: "invalid symlinks policy",
+			config: Config{
+				Git:      GitModeDisable,
+				Watching: []Watched{{Path: ".config", Symlinks: "copy"}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -361,6 +441,164 @@ func TestEffectiveGitMode(t *testing.T) {
 	}
 }
 
+func TestEffectiveIncludeExclude(t *testing.T) {
+	global := []string{"*.swp"}
+	w := Watched{
+		Path:    ".config/nvim",
+		Include: []string{"lua/**"},
+		Exclude: []string{"lazy-lock.json"},
+	}
+
+	include := w.EffectiveInclude(nil)
+	if len(include) != 1 || include[0] != "lua/**" {
+		t.Errorf("EffectiveInclude() = %v, want [lua/**]", include)
+	}
+
+	exclude := w.EffectiveExclude(global)
+	if len(exclude) != 2 || exclude[0] != "*.swp" || exclude[1] != "lazy-lock.json" {
+		t.Errorf("EffectiveExclude() = %v, want [*.swp lazy-lock.json]", exclude)
+	}
+
+	// Must not alias the global slice
+	exclude[0] = "changed"
+	if global[0] != "*.swp" {
+		t.Error("EffectiveExclude() modified the global list")
+	}
+}
+
+func TestLoadIncludeExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	content := `git: disable
+exclude:
+  - "*.swp"
+watching:
+  - path: .config/Code
+    enabled: true
+    exclude:
+      - "**/node_modules"
+      - "Cache/**"
+    include:
+      - "User/**"
+`
+	os.WriteFile(configPath, []byte(content), 0644)
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(cfg.Exclude) != 1 || cfg.Exclude[0] != "*.swp" {
+		t.Errorf("Exclude = %v, want [*.swp]", cfg.Exclude)
+	}
+	w := cfg.Watching[0]
+	if len(w.Exclude) != 2 || len(w.Include) != 1 {
+		t.Errorf("watched include/exclude = %v / %v", w.Include, w.Exclude)
+	}
+}
+
+func TestSecretsEffectivePolicy(t *testing.T) {
+	if got := (SecretsConfig{}).EffectivePolicy(); got != SecretsWarn {
+		t.Errorf("EffectivePolicy() = %q, want %q", got, SecretsWarn)
+	}
+	if got := (SecretsConfig{Policy: SecretsQuarantine}).EffectivePolicy(); got != SecretsQuarantine {
+		t.Errorf("EffectivePolicy() = %q, want %q", got, SecretsQuarantine)
+	}
+}
+
+func TestEffectiveLockTimeout(t *testing.T) {
+	if got := (&Config{}).EffectiveLockTimeout(); got != DefaultLockTimeout {
+		t.Errorf("EffectiveLockTimeout() = %v, want %v", got, DefaultLockTimeout)
+	}
+	if got := (&Config{LockTimeout: "2m"}).EffectiveLockTimeout(); got != 2*time.Minute {
+		t.Errorf("EffectiveLockTimeout() = %v, want %v", got, 2*time.Minute)
+	}
+}
+
+func TestEffectiveOnError(t *testing.T) {
+	cfg := &Config{}
+	if got := cfg.EffectiveOnError(); got != OnErrorStop {
+		t.Errorf("EffectiveOnError() = %v, want %v", got, OnErrorStop)
+	}
+	if got := cfg.Daemon.EffectiveOnError(); got != OnErrorContinue {
+		t.Errorf("Daemon.EffectiveOnError() = %v, want %v", got, OnErrorContinue)
+	}
+	cfg.Daemon.OnError = OnErrorStop
+	if got := cfg.Daemon.EffectiveOnError(); got != OnErrorStop {
+		t.Errorf("Daemon.EffectiveOnError() = %v, want %v", got, OnErrorStop)
+	}
+}
+
+func TestBackupsDefaults(t *testing.T) {
+	var b BackupsConfig
+	if got := b.EffectiveLocation(); got != BackupsCentral {
+		t.Errorf("EffectiveLocation() = %v, want %v", got, BackupsCentral)
+	}
+	if got := b.EffectiveKeep(); got != DefaultBackupsKeep {
+		t.Errorf("EffectiveKeep() = %d, want %d", got, DefaultBackupsKeep)
+	}
+	b = BackupsConfig{Location: BackupsBeside, Keep: 3}
+	if got := b.EffectiveLocation(); got != BackupsBeside {
+		t.Errorf("EffectiveLocation() = %v, want %v", got, BackupsBeside)
+	}
+	if got := b.EffectiveKeep(); got != 3 {
+		t.Errorf("EffectiveKeep() = %d, want 3", got)
+	}
+}
+
+func TestBackupDir(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("failed to get home dir: %v", err)
+	}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"", filepath.Join(home, ".snapfig", "backups")},
+		{"~/backups", filepath.Join(home, "backups")},
+		{"/var/backups/snapfig", "/var/backups/snapfig"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Backups: BackupsConfig{Dir: tt.dir}}
+		got, err := cfg.BackupDir()
+		if err != nil {
+			t.Fatalf("BackupDir() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("BackupDir() with dir %q = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestHooksEffectiveTimeout(t *testing.T) {
+	if got := (&HooksConfig{}).EffectiveTimeout(); got != DefaultHookTimeout {
+		t.Errorf("EffectiveTimeout() = %v, want %v", got, DefaultHookTimeout)
+	}
+	if got := (&HooksConfig{Timeout: "30s"}).EffectiveTimeout(); got != 30*time.Second {
+		t.Errorf("EffectiveTimeout() = %v, want %v", got, 30*time.Second)
+	}
+}
+
+func TestHost(t *testing.T) {
+	cfg := &Config{Hostname: "laptop"}
+	if got, err := cfg.Host(); err != nil || got != "laptop" {
+		t.Errorf("Host() = %q, %v; want laptop", got, err)
+	}
+
+	sys, err := os.Hostname()
+	if err != nil {
+		t.Skip("no system hostname")
+	}
+	got, err := (&Config{}).Host()
+	if err != nil {
+		t.Fatalf("Host() error: %v", err)
+	}
+	if got == "" || strings.Contains(got, ".") || !strings.HasPrefix(sys, got) {
+		t.Errorf("Host() = %q, want short form of %q", got, sys)
+	}
+}
+
 func TestVaultDir(t *testing.T) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -2,6 +2,8 @@
 package daemon
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -129,9 +131,9 @@ func (d *Daemon) Run() error {
 	d.logger.Printf("  Push interval: %v", d.pushInterval)
 	d.logger.Printf("  Pull interval: %v", d.pullInterval)
 
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Setup signal handling: a signal also cancels the task running
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Create tickers
 	var copyTicker, pushTicker, pullTicker *time.Ticker
@@ -158,26 +160,43 @@ func (d *Daemon) Run() error {
 	// Main loop
 	for {
 		select {
-		case <-sigChan:
+		case <-ctx.Done():
 			d.logger.Println("Daemon stopped")
 			return nil
 
 		case <-copyChan:
-			d.doCopy()
+			d.doCopy(ctx)
 
 		case <-pushChan:
-			d.doPush()
+			d.doPush(ctx)
 
 		case <-pullChan:
-			d.doPull()
+			d.doPull(ctx)
 		}
 	}
 }
 
-func (d *Daemon) doCopy() {
+// lock takes the vault lock for op. While another snapfig process keeps
+// the vault busy the run is skipped and nil is returned.
+func (d *Daemon) lock(op string) *snapfig.VaultLock {
+	l, err := snapfig.LockVault(d.vaultDir, d.cfg.EffectiveLockTimeout())
+	if err != nil {
+		d.logger.Printf("%s skipped: %v", op, err)
+		return nil
+	}
+	return l
+}
+
+func (d *Daemon) doCopy(ctx context.Context) {
 	// Reload config to pick up any changes
 	d.reloadConfig()
 
+	l := d.lock("Copy")
+	if l == nil {
+		return
+	}
+	defer l.Unlock()
+
 	d.logger.Println("Copy started")
 
 	copier, err := snapfig.NewCopier(d.cfg)
@@ -186,14 +205,38 @@ func (d *Daemon) doCopy() {
 		return
 	}
 
-	result, err := copier.Copy()
+	result, err := copier.CopyContext(snapfig.WithTrigger(ctx, snapfig.TriggerDaemon), nil)
+	if result != nil {
+		for _, f := range result.Findings {
+			d.logger.Printf("  possible secret: %s:%d (%s)", f.Path, f.Line, f.Rule)
+		}
+		for _, p := range result.Quarantined {
+			d.logger.Printf("  quarantined: %s", p)
+		}
+		for _, p := range result.Unscanned {
+			d.logger.Printf("  not fully scanned: %s", p)
+		}
+		for _, p := range result.TemplateDrift {
+			d.logger.Printf("  template drift: %s", p)
+		}
+		for _, p := range result.Loops {
+			d.logger.Printf("  symlink loop not followed: %s", p)
+		}
+		for _, p := range result.Special {
+			d.logger.Printf("  left out: %s", p)
+		}
+		for _, e := range result.Errors {
+			d.logger.Printf("  not copied: %v", &e)
+		}
+		d.logHookErrors(result.HookErrors)
+	}
 	if err != nil {
 		d.logger.Printf("Copy error: %v", err)
 		return
 	}
 
-	d.logger.Printf("Copy done: %d paths, %d updated, %d unchanged, %d removed",
-		len(result.Copied), result.FilesUpdated, result.FilesSkipped, result.FilesRemoved)
+	d.logger.Printf("Copy done: %d paths, %d updated, %d unchanged, %d removed, %d failed",
+		len(result.Copied), result.FilesUpdated, result.FilesSkipped, result.FilesRemoved, len(result.Errors))
 
 	for _, p := range result.Copied {
 		d.logger.Printf("  copied: %s", p)
@@ -203,38 +246,65 @@ func (d *Daemon) doCopy() {
 	}
 }
 
-func (d *Daemon) doPush() {
+func (d *Daemon) doPush(ctx context.Context) {
+	l := d.lock("Push")
+	if l == nil {
+		return
+	}
+	defer l.Unlock()
+
 	d.logger.Println("Push started")
 
-	if err := snapfig.PushVaultWithToken(d.vaultDir, d.cfg.GitToken); err != nil {
-		d.logger.Printf("Push error: %v", err)
-		return
+	if err := snapfig.PushWithHooks(ctx, d.cfg, d.vaultDir, nil); err != nil {
+		if !errors.Is(err, snapfig.ErrHookFailed) {
+			d.logger.Printf("Push error: %v", err)
+			return
+		}
+		d.logger.Printf("  hook failed: %v", err)
 	}
 
 	d.logger.Println("Push done")
 }
 
-func (d *Daemon) doPull() {
+func (d *Daemon) doPull(ctx context.Context) {
+	// The restore takes the lock again once the pull released it
+	if d.pull(ctx) && d.cfg.Daemon.AutoRestore {
+		d.doRestore(ctx)
+	}
+}
+
+// pull pulls the vault and reports whether it succeeded.
+func (d *Daemon) pull(ctx context.Context) bool {
+	l := d.lock("Pull")
+	if l == nil {
+		return false
+	}
+	defer l.Unlock()
+
 	d.logger.Println("Pull started")
 
-	result, err := snapfig.PullVaultWithToken(d.vaultDir, d.cfg.Remote, d.cfg.GitToken)
+	result, err := snapfig.PullWithHooks(ctx, d.cfg, d.vaultDir, nil)
 	if err != nil {
 		d.logger.Printf("Pull error: %v", err)
-		return
+		return false
 	}
+	d.logHookErrors(result.HookErrors)
 
 	if result.Cloned {
 		d.logger.Println("Pull done (cloned)")
 	} else {
 		d.logger.Println("Pull done")
 	}
+	return true
+}
 
-	if d.cfg.Daemon.AutoRestore {
-		d.doRestore()
+func (d *Daemon) doRestore(ctx context.Context) {
+	l := d.lock("Restore")
+	if l == nil {
+		return
 	}
-}
+	defer l.Unlock()
 
-func (d *Daemon) doRestore() {
 	d.logger.Println("Restore started (auto)")
 
 	restorer, err := snapfig.NewRestorer(d.cfg)
@@ -243,16 +313,38 @@ func (d *Daemon) doRestore() {
 		return
 	}
 
-	result, err := restorer.Restore()
+	result, err := restorer.RestoreContext(ctx, nil)
 	if err != nil {
 		d.logger.Printf("Restore error: %v", err)
 		return
 	}
+	for _, p := range result.Backups {
+		d.logger.Printf("  backed up: %s", p)
+	}
+	for _, p := range result.Denied {
+		d.logger.Printf("  permission denied: %s", p)
+	}
+	for _, p := range result.Kept {
+		d.logger.Printf("  kept directory: %s", p)
+	}
+	for _, p := range result.Unreferenced {
+		d.logger.Printf("  not cloned: %s", p)
+	}
+	for _, p := range result.Diverged {
+		d.logger.Printf("  diverged: %s", p)
+	}
+	d.logHookErrors(result.HookErrors)
 
 	d.logger.Printf("Restore done: %d updated, %d unchanged",
 		result.FilesUpdated, result.FilesSkipped)
 }
 
+func (d *Daemon) logHookErrors(failed []snapfig.HookError) {
+	for _, h := range failed {
+		d.logger.Printf("  hook failed: %v", &h)
+	}
+}
+
 func (d *Daemon) writePidFile() error {
 	pidPath, err := config.PidFilePath()
 	if err != nil {
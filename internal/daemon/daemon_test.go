@@ -1,12 +1,16 @@
 package daemon
 
 import (
+	"bytes"
+	"context"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/adrianpk/snapfig/internal/config"
+	"github.com/adrianpk/snapfig/internal/snapfig"
 )
 
 func TestNew(t *testing.T) {
@@ -410,7 +414,7 @@ func TestDoCopy(t *testing.T) {
 
 	// Override home directory by modifying copier expectations
 	// This test won't work perfectly without mocking, but we can test the flow
-	d.doCopy()
+	d.doCopy(context.Background())
 	// doCopy should not panic and should handle errors gracefully
 }
 
@@ -437,7 +441,7 @@ func TestDoPush(t *testing.T) {
 	}
 
 	// doPush will fail (no git repo) but should handle gracefully
-	d.doPush()
+	d.doPush(context.Background())
 }
 
 func TestDoPull(t *testing.T) {
@@ -464,7 +468,7 @@ func TestDoPull(t *testing.T) {
 	}
 
 	// doPull will fail (no remote) but should handle gracefully
-	d.doPull()
+	d.doPull(context.Background())
 }
 
 func TestDoRestore(t *testing.T) {
@@ -492,7 +496,7 @@ func TestDoRestore(t *testing.T) {
 	}
 
 	// doRestore should handle case with no watched paths
-	d.doRestore()
+	d.doRestore(context.Background())
 }
 
 func TestDoPullWithAutoRestore(t *testing.T) {
@@ -524,7 +528,7 @@ func TestDoPullWithAutoRestore(t *testing.T) {
 	}
 
 	// doPull will fail but AutoRestore code path will not be reached
-	d.doPull()
+	d.doPull(context.Background())
 }
 
 func TestDoCopyWithResults(t *testing.T) {
@@ -556,7 +560,7 @@ func TestDoCopyWithResults(t *testing.T) {
 	}
 
 	// This will trigger the skipped path logging
-	d.doCopy()
+	d.doCopy(context.Background())
 }
 
 func TestDoPullAutoRestoreEnabled(t *testing.T) {
@@ -593,7 +597,7 @@ func TestDoPullAutoRestoreEnabled(t *testing.T) {
 	}
 
 	// doPull will fail because no remote, but we test the code path exists
-	d.doPull()
+	d.doPull(context.Background())
 }
 
 func TestDoRestoreNoWatching(t *testing.T) {
@@ -626,7 +630,7 @@ func TestDoRestoreNoWatching(t *testing.T) {
 	}
 
 	// doRestore with no watching paths should log nothing to restore
-	d.doRestore()
+	d.doRestore(context.Background())
 }
 
 func TestDoRestoreWithResults(t *testing.T) {
@@ -663,5 +667,37 @@ func TestDoRestoreWithResults(t *testing.T) {
 	}
 
 	// doRestore should restore files
-	d.doRestore()
+	d.doRestore(context.Background())
+}
+
+func TestDoCopySkipsBusyVault(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	held, err := snapfig.LockVault(vaultDir, 0)
+	if err != nil {
+		t.Fatalf("LockVault() error: %v", err)
+	}
+	defer held.Unlock()
+
+	var logs bytes.Buffer
+	d := &Daemon{
+		cfg: &config.Config{
+			VaultPath:   vaultDir,
+			LockTimeout: "0s",
+			Watching:    []config.Watched{{Path: ".testrc", Enabled: true}},
+		},
+		configPath: filepath.Join(tmpDir, "config.yml"),
+		vaultDir:   vaultDir,
+		logger:     log.New(&logs, "", 0),
+	}
+
+	d.doCopy(context.Background())
+
+	if !strings.Contains(logs.String(), "Copy skipped: vault busy") {
+		t.Errorf("log should report the busy vault, got:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "Copy started") {
+		t.Error("copy should not start while the vault is locked")
+	}
 }
@@ -0,0 +1,68 @@
+package paths
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether name matches the glob pattern.
+// Both use forward slashes. On top of path.Match syntax:
+//   - "**" as a whole segment matches zero or more segments
+//   - a pattern without "/" matches the last segment of name at any depth
+//   - a leading "/" anchors the pattern to the root
+//   - a trailing "/" is ignored; callers handle directory-only rules
+func Match(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	name = strings.Trim(name, "/")
+	if pattern == "" || name == "" {
+		return false
+	}
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	pattern = strings.TrimPrefix(pattern, "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// MatchOrParent reports whether name or any of its parent directories
+// matches pattern. Use it to test files against directory patterns.
+func MatchOrParent(pattern, name string) bool {
+	name = strings.Trim(name, "/")
+	for name != "" && name != "." {
+		if Match(pattern, name) {
+			return true
+		}
+		name = path.Dir(name)
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
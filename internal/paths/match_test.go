@@ -0,0 +1,61 @@
+package paths
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.swp", "init.lua.swp", true},
+		{"*.swp", "lua/plugins/init.lua.swp", true},
+		{"*.swp", "init.lua", false},
+		{"node_modules", "extensions/foo/node_modules", true},
+		{"node_modules/", "node_modules", true},
+		{"lazy-lock.json", "lazy-lock.json", true},
+		{"lua/*.lua", "lua/init.lua", true},
+		{"lua/*.lua", "lua/plugins/init.lua", false},
+		{"lua/**/*.lua", "lua/init.lua", true},
+		{"lua/**/*.lua", "lua/plugins/deep/init.lua", true},
+		{"**/cache", "cache", true},
+		{"**/cache", "a/b/cache", true},
+		{"Cache/**", "Cache/a/b", true},
+		{"Cache/**", "Cache", true},
+		{"/settings.json", "settings.json", true},
+		{"/settings.json", "User/settings.json", false},
+		{"a/b", "a/b/c", false},
+		{"", "anything", false},
+		{"[", "x", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.name, func(t *testing.T) {
+			if got := Match(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchOrParent(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"node_modules", "ext/node_modules/pkg/index.js", true},
+		{"lua", "lua/init.lua", true},
+		{"Cache/**", "Cache/a/b", true},
+		{"*.json", "lua/init.lua", false},
+		{"User/workspaceStorage", "User/workspaceStorage/abc/state.vscdb", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.name, func(t *testing.T) {
+			if got := MatchOrParent(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("MatchOrParent(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// atomicTempInfix marks the temporary files written next to their target.
+// One left behind by a crash in the vault is removed on the next copy:
+// below a watched path as a stale entry, at the top by removeAtomicTemps.
+const atomicTempInfix = ".snapfig-tmp-"
+
+// atomicFile is a temporary file that replaces its target on commit.
+// Until then the target keeps its old content, so a crash or a full disk
+// never leaves it half-written.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+// createAtomic starts writing path through a temporary file in the same
+// directory, so the final rename stays on one filesystem.
+func createAtomic(path string) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+atomicTempInfix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// commit sets mode, flushes the content to disk and renames the
+// temporary file over the target.
+func (f *atomicFile) commit(mode os.FileMode) error {
+	if err := f.Chmod(mode); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// abort discards the temporary file, leaving the target untouched.
+func (f *atomicFile) abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// writeFileAtomic is os.WriteFile through a temporary file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit(mode)
+}
+
+// removeAtomicTemps removes temporary files a crash left in dir.
+func removeAtomicTemps(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasPrefix(entry.Name(), ".") && strings.Contains(entry.Name(), atomicTempInfix) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
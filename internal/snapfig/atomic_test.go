@@ -0,0 +1,102 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestWriteFileAtomicReplacesTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.yml")
+	os.WriteFile(path, []byte("old"), 0644)
+
+	if err := writeFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatalf("writeFileAtomic() error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "new" {
+		t.Errorf("content = %q, want %q", data, "new")
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %o, want 600", info.Mode().Perm())
+	}
+	assertNoTemps(t, dir)
+}
+
+func TestAtomicFileAbortKeepsTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".zshrc")
+	os.WriteFile(path, []byte("export A=1\n"), 0644)
+
+	f, err := createAtomic(path)
+	if err != nil {
+		t.Fatalf("createAtomic() error: %v", err)
+	}
+	f.Write([]byte("export A="))
+	f.abort()
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "export A=1\n" {
+		t.Errorf("content = %q, an aborted write must leave the target intact", data)
+	}
+	assertNoTemps(t, dir)
+}
+
+func TestRemoveAtomicTemps(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".manifest.yml"+atomicTempInfix+"123"), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join(dir, "manifest.yml"), []byte("kept"), 0644)
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("kept"), 0644)
+
+	removeAtomicTemps(dir)
+
+	assertNoTemps(t, dir)
+	for _, name := range []string{"manifest.yml", ".gitignore"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should be kept: %v", name, err)
+		}
+	}
+}
+
+func TestCopyRemovesStaleTemps(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "config"), []byte("content"), 0644)
+
+	// Left behind by a copy that crashed mid-write
+	os.MkdirAll(filepath.Join(vaultDir, ".config", "app"), 0755)
+	os.WriteFile(filepath.Join(vaultDir, ".config", "app", ".config"+atomicTempInfix+"42"), []byte("cont"), 0644)
+	os.WriteFile(filepath.Join(vaultDir, ".README.md"+atomicTempInfix+"42"), []byte("# Snap"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	assertNoTemps(t, vaultDir)
+	assertNoTemps(t, filepath.Join(vaultDir, ".config", "app"))
+}
+
+func assertNoTemps(t *testing.T, dir string) {
+	t.Helper()
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), atomicTempInfix) {
+			t.Errorf("temporary file %s left in %s", e.Name(), dir)
+		}
+	}
+}
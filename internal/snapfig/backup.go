@@ -0,0 +1,283 @@
+package snapfig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// backupTimeFormat stamps the backups of one restore, to the second.
+// Where a backup of an earlier restore has the same stamp, a counter is
+// added to it, e.g. 20260102150405-2.
+const backupTimeFormat = "20060102150405"
+
+// backupMinuteFormat stamped the backups of earlier versions, which are
+// still recognized and pruned.
+const backupMinuteFormat = "200601021504"
+
+// backupExt ends the name of a backup made next to its file, e.g.
+// .bashrc.20260102150405.bak.
+const backupExt = ".bak"
+
+// backupStore saves the files a restore overwrites, see config.BackupsConfig.
+// A nil store saves nothing.
+type backupStore struct {
+	location config.BackupLocation
+	dir      string // central tree, holding one directory per restore
+	home     string
+	keep     int
+	stamp    string // of the running restore
+
+	mu    sync.Mutex
+	saved map[string]bool // paths this store saved
+}
+
+// newBackupStore returns the store of a restore started at now, or nil
+// when backups are off.
+func newBackupStore(cfg *config.Config, home string, now time.Time) (*backupStore, error) {
+	location := cfg.Backups.EffectiveLocation()
+	if location == config.BackupsOff {
+		return nil, nil
+	}
+	dir, err := cfg.BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	stamp := uniqueStamp(now.Format(backupTimeFormat), func(stamp string) string {
+		return filepath.Join(dir, stamp)
+	})
+	return &backupStore{
+		location: location,
+		dir:      dir,
+		home:     home,
+		keep:     cfg.Backups.EffectiveKeep(),
+		stamp:    stamp,
+	}, nil
+}
+
+// uniqueStamp returns stamp, or stamp with the lowest counter from 2 up,
+// for which nothing exists at the path name returns.
+func uniqueStamp(stamp string, name func(string) string) string {
+	unique := stamp
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(name(unique)); errors.Is(err, fs.ErrNotExist) {
+			return unique
+		}
+		unique = fmt.Sprintf("%s-%d", stamp, n)
+	}
+}
+
+// isBackupStamp reports whether s is a backup stamp, with or without
+// a counter.
+func isBackupStamp(s string) bool {
+	if stamp, counter, ok := strings.Cut(s, "-"); ok {
+		return isDigits(counter) && isBackupStamp(stamp)
+	}
+	return (len(s) == len(backupTimeFormat) || len(s) == len(backupMinuteFormat)) && isDigits(s)
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isBackupFile reports whether name is a backup restore made next to
+// a file. Copy leaves them out of the vault.
+func isBackupFile(name string) bool {
+	rest, ok := strings.CutSuffix(name, backupExt)
+	if !ok {
+		return false
+	}
+	i := strings.LastIndexByte(rest, '.')
+	return i > 0 && isBackupStamp(rest[i+1:])
+}
+
+// target returns where the file at path is saved, and whether next to
+// it. Paths outside home always go to the central tree: writing next to
+// them may need privileges. A backup next to the file gets a counter
+// when one of an earlier restore has the same stamp.
+func (b *backupStore) target(path string) (string, bool) {
+	rel := displayPath(b.home, path)
+	if b.location == config.BackupsBeside && !filepath.IsAbs(rel) {
+		stamp := uniqueStamp(b.stamp, func(stamp string) string {
+			return path + "." + stamp + backupExt
+		})
+		return path + "." + stamp + backupExt, true
+	}
+	return filepath.Join(b.dir, b.stamp, vaultRel(config.Watched{Path: rel})), false
+}
+
+// claim marks path as saved by this store, and reports whether it was
+// not already.
+func (b *backupStore) claim(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.saved[path] {
+		return false
+	}
+	if b.saved == nil {
+		b.saved = make(map[string]bool)
+	}
+	b.saved[path] = true
+	return true
+}
+
+// release undoes the claim of path, whose backup failed.
+func (b *backupStore) release(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.saved, path)
+}
+
+// save copies the file at path, described by info, to its backup and
+// returns where, keeping its mode and mtime. A file already saved by
+// this store keeps its first backup, and "" is returned. A file the
+// user cannot read, or a backup next to it the user cannot write, is
+// copied through helper if not nil.
+func (b *backupStore) save(path string, info os.FileInfo, helper *privilegeHelper) (string, error) {
+	if !b.claim(path) {
+		return "", nil
+	}
+	target, beside := b.target(path)
+
+	err := copyBackup(path, target, info)
+	if errors.Is(err, fs.ErrPermission) && helper != nil {
+		err = copyBackupElevated(helper, path, target)
+	}
+	if err != nil {
+		b.release(path)
+		return "", permissionError(err)
+	}
+
+	if beside {
+		b.pruneBeside(path, helper)
+	}
+	return target, nil
+}
+
+// copyBackup copies the file at path to target, keeping its mode and mtime.
+func copyBackup(path, target string, info os.FileInfo) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	dst, err := createAtomic(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.abort()
+		return err
+	}
+	if err := dst.commit(info.Mode().Perm()); err != nil {
+		return err
+	}
+	os.Chtimes(target, info.ModTime(), info.ModTime())
+	return nil
+}
+
+// copyBackupElevated copies the file at path to target through the
+// privilege helper, keeping its mode, owner and mtime.
+func copyBackupElevated(helper *privilegeHelper, path, target string) error {
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0700); errors.Is(err, fs.ErrPermission) {
+		if err := helper.run(nil, "mkdir", "-p", dir); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return helper.run(nil, "cp", "-p", path, target)
+}
+
+// pruneBeside removes the oldest backups next to the file at path
+// beyond keep, through helper when the user cannot.
+func (b *backupStore) pruneBeside(path string, helper *privilegeHelper) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	prefix := filepath.Base(path) + "."
+	var stamps []string
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		if stamp, ok := strings.CutSuffix(rest, backupExt); ok && isBackupStamp(stamp) {
+			stamps = append(stamps, stamp)
+		}
+	}
+	sort.Strings(stamps)
+	for len(stamps) > b.keep {
+		old := path + "." + stamps[0] + backupExt
+		if err := os.Remove(old); errors.Is(err, fs.ErrPermission) && helper != nil {
+			helper.run(nil, "rm", "-f", old)
+		}
+		stamps = stamps[1:]
+	}
+}
+
+// prune removes the oldest restores of the central tree beyond keep.
+func (b *backupStore) prune() {
+	if b == nil {
+		return
+	}
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return
+	}
+	var stamps []string
+	for _, entry := range entries {
+		if entry.IsDir() && isBackupStamp(entry.Name()) {
+			stamps = append(stamps, entry.Name())
+		}
+	}
+	sort.Strings(stamps)
+	for len(stamps) > b.keep {
+		os.RemoveAll(filepath.Join(b.dir, stamps[0]))
+		stamps = stamps[1:]
+	}
+}
+
+// backup saves dst before restore overwrites it, when it is a file,
+// and lists it in the result. Failing to save it fails the file: it is
+// not overwritten without its backup. A file only the privilege helper
+// can read is backed up through it; without a helper, it is reported
+// as denied like a file restore cannot write.
+func (r *Restorer) backup(dst string, result *RestoreResult) error {
+	if r.backups == nil {
+		return nil
+	}
+	info, err := os.Stat(dst)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	saved, err := r.backups.save(dst, info, r.helper)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", displayPath(r.home, dst), err)
+	}
+	if saved != "" {
+		result.Backups = append(result.Backups, displayPath(r.home, dst)+" -> "+displayPath(r.home, saved))
+	}
+	return nil
+}
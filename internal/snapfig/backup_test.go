@@ -0,0 +1,355 @@
+package snapfig
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestIsBackupFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{".bashrc.202601021504.bak", true},
+		{"init.lua.202601021504.bak", true},
+		{".bashrc.bak", false},
+		{".bashrc.2026.bak", false},
+		{".bashrc.20260102150x.bak", false},
+		{"202601021504.bak", false},
+		{".bashrc.202601021504", false},
+		{".bashrc.20260102150405.bak", true},
+		{".bashrc.20260102150405-2.bak", true},
+		{".bashrc.20260102150405-.bak", false},
+		{".bashrc.2026010215040-2.bak", false},
+	}
+	for _, tt := range tests {
+		if got := isBackupFile(tt.name); got != tt.want {
+			t.Errorf("isBackupFile(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewBackupStoreOff(t *testing.T) {
+	cfg := &config.Config{Backups: config.BackupsConfig{Location: config.BackupsOff}}
+	store, err := newBackupStore(cfg, t.TempDir(), time.Now())
+	if err != nil {
+		t.Fatalf("newBackupStore() error: %v", err)
+	}
+	if store != nil {
+		t.Error("newBackupStore() should return no store when backups are off")
+	}
+	store.prune()
+}
+
+// restoreOver restores a changed .testrc over homeDir with the given
+// backups, and returns the result.
+func restoreOver(t *testing.T, homeDir, vaultDir string, backups *backupStore) *RestoreResult {
+	t.Helper()
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".testrc", Enabled: true}},
+	}
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), backups: backups}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	return result
+}
+
+func TestRestoreBacksUpCentrally(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	backupDir := filepath.Join(tmpDir, "backups")
+	os.MkdirAll(homeDir, 0755)
+	os.MkdirAll(vaultDir, 0755)
+	os.WriteFile(filepath.Join(vaultDir, ".testrc"), []byte("vault"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".testrc"), []byte("local"), 0600)
+
+	store := &backupStore{location: config.BackupsCentral, dir: backupDir, home: homeDir, keep: 2, stamp: "202601021504"}
+	result := restoreOver(t, homeDir, vaultDir, store)
+
+	saved := filepath.Join(backupDir, "202601021504", ".testrc")
+	want := ".testrc -> " + saved
+	if len(result.Backups) != 1 || result.Backups[0] != want {
+		t.Errorf("Backups = %v, want [%s]", result.Backups, want)
+	}
+	data, err := os.ReadFile(saved)
+	if err != nil || string(data) != "local" {
+		t.Errorf("backup = %q, %v, want the overwritten content", data, err)
+	}
+	if info, err := os.Stat(saved); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf("backup mode = %v, want 0600", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(filepath.Join(homeDir, ".testrc")); string(data) != "vault" {
+		t.Errorf(".testrc = %q, want it restored", data)
+	}
+
+	// Unchanged files are not backed up again
+	if result := restoreOver(t, homeDir, vaultDir, store); len(result.Backups) != 0 {
+		t.Errorf("Backups = %v, want none for an unchanged file", result.Backups)
+	}
+}
+
+func TestRestoreBacksUpBeside(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(homeDir, 0755)
+	os.MkdirAll(vaultDir, 0755)
+	os.WriteFile(filepath.Join(vaultDir, ".testrc"), []byte("vault"), 0644)
+
+	// Older backups beyond keep are pruned
+	for _, stamp := range []string{"202501010000", "202502010000"} {
+		os.WriteFile(filepath.Join(homeDir, ".testrc."+stamp+backupExt), []byte("old"), 0644)
+	}
+	os.WriteFile(filepath.Join(homeDir, ".testrc"), []byte("local"), 0644)
+
+	store := &backupStore{location: config.BackupsBeside, dir: filepath.Join(tmpDir, "backups"), home: homeDir, keep: 2, stamp: "202601021504"}
+	result := restoreOver(t, homeDir, vaultDir, store)
+
+	want := ".testrc -> .testrc.202601021504.bak"
+	if len(result.Backups) != 1 || result.Backups[0] != want {
+		t.Errorf("Backups = %v, want [%s]", result.Backups, want)
+	}
+	data, err := os.ReadFile(filepath.Join(homeDir, ".testrc.202601021504.bak"))
+	if err != nil || string(data) != "local" {
+		t.Errorf("backup = %q, %v, want the overwritten content", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".testrc.202501010000.bak")); !os.IsNotExist(err) {
+		t.Error("the oldest backup should be pruned")
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".testrc.202502010000.bak")); err != nil {
+		t.Errorf("the newer backup should be kept: %v", err)
+	}
+}
+
+func TestRestoresInSameSecondKeepBackups(t *testing.T) {
+	for _, location := range []config.BackupLocation{config.BackupsCentral, config.BackupsBeside} {
+		t.Run(string(location), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			homeDir := filepath.Join(tmpDir, "home")
+			vaultDir := filepath.Join(tmpDir, "vault")
+			os.MkdirAll(homeDir, 0755)
+			os.MkdirAll(vaultDir, 0755)
+			os.WriteFile(filepath.Join(vaultDir, ".testrc"), []byte("vault"), 0644)
+
+			cfg := &config.Config{Backups: config.BackupsConfig{Location: location, Dir: filepath.Join(tmpDir, "backups")}}
+			now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+			// Each restore overwrites an edit made since the previous one
+			var saved []string
+			for _, edit := range []string{"first", "second"} {
+				os.WriteFile(filepath.Join(homeDir, ".testrc"), []byte(edit), 0644)
+				store, err := newBackupStore(cfg, homeDir, now)
+				if err != nil {
+					t.Fatalf("newBackupStore() error: %v", err)
+				}
+				result := restoreOver(t, homeDir, vaultDir, store)
+				if len(result.Backups) != 1 {
+					t.Fatalf("Backups = %v, want the edit saved", result.Backups)
+				}
+				saved = append(saved, result.Backups[0])
+			}
+
+			if saved[0] == saved[1] {
+				t.Fatalf("both restores saved to %s", saved[0])
+			}
+			for i, edit := range []string{"first", "second"} {
+				_, target, _ := strings.Cut(saved[i], " -> ")
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(homeDir, target)
+				}
+				if data, err := os.ReadFile(target); err != nil || string(data) != edit {
+					t.Errorf("backup %s = %q, %v, want %q", target, data, err, edit)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupStorePrune(t *testing.T) {
+	backupDir := t.TempDir()
+	stamps := []string{"202501010000", "202502010000", "202503010000"}
+	for _, stamp := range stamps {
+		os.MkdirAll(filepath.Join(backupDir, stamp), 0755)
+	}
+	os.MkdirAll(filepath.Join(backupDir, "keep-me"), 0755)
+
+	store := &backupStore{location: config.BackupsCentral, dir: backupDir, keep: 2}
+	store.prune()
+
+	if _, err := os.Stat(filepath.Join(backupDir, stamps[0])); !os.IsNotExist(err) {
+		t.Error("the oldest restore should be pruned")
+	}
+	for _, name := range []string{stamps[1], stamps[2], "keep-me"} {
+		if _, err := os.Stat(filepath.Join(backupDir, name)); err != nil {
+			t.Errorf("%s should be kept: %v", name, err)
+		}
+	}
+}
+
+func TestCopySkipsBackupFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	srcDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(srcDir, 0755)
+	os.WriteFile(filepath.Join(srcDir, "app.conf"), []byte("conf"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "app.conf.202601021504.bak"), []byte("old"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "app", "app.conf")); err != nil {
+		t.Errorf("app.conf not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "app", "app.conf.202601021504.bak")); !os.IsNotExist(err) {
+		t.Error("restore backups should not be copied to the vault")
+	}
+}
+
+func TestRestoreSymlinkBacksUpWhatIsInTheWay(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	target := filepath.Join(tmpDir, "target")
+	os.MkdirAll(target, 0755)
+
+	vaultSubDir := filepath.Join(vaultDir, ".config", "themes")
+	os.MkdirAll(vaultSubDir, 0755)
+	for _, name := range []string{"current", "dark"} {
+		marker, _ := newSymlinkMarker(name, target, 0).encode()
+		os.WriteFile(filepath.Join(vaultSubDir, name+symlinkMarkerExt), marker, 0644)
+	}
+
+	// A file where one link goes, a directory where the other does
+	homeSubDir := filepath.Join(homeDir, ".config", "themes")
+	os.MkdirAll(filepath.Join(homeSubDir, "dark"), 0755)
+	os.WriteFile(filepath.Join(homeSubDir, "dark", "palette"), []byte("mine"), 0644)
+	os.WriteFile(filepath.Join(homeSubDir, "current"), []byte("local"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/themes", Enabled: true}},
+	}
+	store := &backupStore{location: config.BackupsCentral, dir: filepath.Join(tmpDir, "backups"), home: homeDir, keep: 2, stamp: "202601021504"}
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), backups: store}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	if got, err := os.Readlink(filepath.Join(homeSubDir, "current")); err != nil || got != target {
+		t.Errorf("current -> %q, %v, want %q", got, err, target)
+	}
+	if len(result.Backups) != 1 {
+		t.Fatalf("Backups = %v, want the replaced file", result.Backups)
+	}
+	if data, err := os.ReadFile(filepath.Join(store.dir, store.stamp, ".config", "themes", "current")); err != nil || string(data) != "local" {
+		t.Errorf("backup = %q, %v, want the replaced content", data, err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(homeSubDir, "dark", "palette")); err != nil || string(data) != "mine" {
+		t.Errorf("dark/palette = %q, %v, want the directory kept", data, err)
+	}
+	if len(result.Kept) != 1 || result.Kept[0] != ".config/themes/dark" {
+		t.Errorf("Kept = %v, want the directory reported", result.Kept)
+	}
+	if _, err := os.Stat(filepath.Join(homeSubDir, "dark"+symlinkMarkerExt)); err != nil {
+		t.Errorf("marker should be restored next to the kept directory: %v", err)
+	}
+}
+
+func TestRestoreLinkBacksUpReplacedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(filepath.Join(vaultDir, ".config", "app"), 0755)
+	os.Symlink("app.conf", filepath.Join(vaultDir, ".config", "app", "rel"))
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "rel"), []byte("local"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true, Symlinks: config.SymlinksPreserve}},
+	}
+	store := &backupStore{location: config.BackupsBeside, home: homeDir, keep: 2, stamp: "202601021504"}
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), backups: store}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	dst := filepath.Join(homeDir, ".config", "app", "rel")
+	if got, err := os.Readlink(dst); err != nil || got != "app.conf" {
+		t.Errorf("rel -> %q, %v, want the symlink restored", got, err)
+	}
+	if data, err := os.ReadFile(dst + ".202601021504.bak"); err != nil || string(data) != "local" {
+		t.Errorf("backup = %q, %v, want the replaced content", data, err)
+	}
+	if len(result.Backups) != 1 {
+		t.Errorf("Backups = %v, want the replaced file", result.Backups)
+	}
+}
+
+func TestBackupThroughPrivilegeHelper(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	tmpDir := t.TempDir()
+	dst := filepath.Join(tmpDir, "shadow")
+	os.WriteFile(dst, []byte("secret"), 0600)
+	os.Chmod(dst, 0)
+	t.Cleanup(func() { os.Chmod(dst, 0600) })
+
+	// Stand-in for sudo: logs the command, then makes the source readable
+	logPath := filepath.Join(tmpDir, "helper.log")
+	helper := filepath.Join(tmpDir, "fake-sudo")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n[ \"$1\" = cp ] && chmod u+r \"$3\"\nexec \"$@\"\n"
+	os.WriteFile(helper, []byte(script), 0755)
+
+	store := &backupStore{location: config.BackupsBeside, home: tmpDir, keep: 2, stamp: "202601021504"}
+
+	// Without a helper the file is denied, not overwritten unsaved
+	r := &Restorer{home: tmpDir, backups: store}
+	err := r.backup(dst, &RestoreResult{})
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), "privilege_helper") {
+		t.Errorf("backup() without helper error = %v, want permission error with hint", err)
+	}
+
+	r.helper = newPrivilegeHelper(helper)
+	result := &RestoreResult{}
+	if err := r.backup(dst, result); err != nil {
+		t.Fatalf("backup() through helper error: %v", err)
+	}
+	if len(result.Backups) != 1 {
+		t.Errorf("Backups = %v, want the saved file", result.Backups)
+	}
+	if data, err := os.ReadFile(dst + ".202601021504.bak"); err != nil || string(data) != "secret" {
+		t.Errorf("backup = %q, %v, want the unreadable content", data, err)
+	}
+	log, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(log), "cp -p "+dst) {
+		t.Errorf("helper log = %q, want cp", log)
+	}
+}
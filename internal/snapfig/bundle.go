@@ -0,0 +1,441 @@
+package snapfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A nested repository stored by the bundle git mode is kept next to its
+// working tree as two vault files: the history as a git bundle, and what
+// a bundle leaves out as JSON.
+const (
+	gitBundleName     = ".snapfig-git.bundle"
+	gitBundleMetaName = ".snapfig-git.json"
+	gitBundleVersion  = 1
+
+	// gitBundleFetchRefs is where restore fetches the refs of a bundle
+	// to, before moving the repository's own refs.
+	gitBundleFetchRefs = "refs/snapfig/bundle/"
+)
+
+// gitBundleMeta records the state of a nested repository.
+type gitBundleMeta struct {
+	Version int               `json:"version"`
+	Head    string            `json:"head"` // symbolic ref, e.g. refs/heads/main, or a commit when detached
+	Refs    map[string]string `json:"refs"` // ref name to object, as stored in the bundle
+	Remotes []gitRemote       `json:"remotes,omitempty"`
+}
+
+// gitRemote is a remote of a nested repository.
+type gitRemote struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// isGitBundleFile reports whether name is one of the files of a stored
+// bundle, plain or encrypted. They are restored with their directory.
+func isGitBundleFile(name string) bool {
+	name = plainRel(name)
+	return name == gitBundleName || name == gitBundleMetaName
+}
+
+// bundleSuffix returns the suffix of the bundle files in the vault:
+// they are encrypted with their path, never templates.
+func (s *walkSpec) bundleSuffix() string {
+	if s.encrypt {
+		return EncryptedExt
+	}
+	return ""
+}
+
+// gitOutput runs git on the repository at gitDir and returns its
+// trimmed output.
+func gitOutput(gitDir string, args ...string) (string, error) {
+	out, err := gitRun(gitDir, nil, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+// gitRun runs git on the repository at gitDir, feeding it stdin if not
+// nil, and returns its output. Errors carry git's message.
+func gitRun(gitDir string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", gitDir}, args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		name := args[0]
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				name = arg
+				break
+			}
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", name, msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", name, err)
+	}
+	return out, nil
+}
+
+// readGitState reads the refs, HEAD and remotes of the repository at gitDir.
+func readGitState(gitDir string) (gitBundleMeta, error) {
+	meta := gitBundleMeta{Version: gitBundleVersion, Refs: make(map[string]string)}
+
+	refs, err := gitOutput(gitDir, "for-each-ref", "--format=%(objectname) %(refname)")
+	if err != nil {
+		return meta, err
+	}
+	meta.Refs = parseRefs(refs)
+
+	// An unborn branch still has a symbolic HEAD
+	if head, err := gitOutput(gitDir, "symbolic-ref", "-q", "HEAD"); err == nil {
+		meta.Head = head
+	} else if head, err := gitOutput(gitDir, "rev-parse", "-q", "--verify", "HEAD"); err == nil {
+		meta.Head = head
+	}
+
+	// No remote makes the lookup fail
+	urls, _ := gitOutput(gitDir, "config", "--get-regexp", `^remote\..*\.url$`)
+	for _, line := range strings.Split(urls, "\n") {
+		key, url, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "remote."), ".url")
+		meta.Remotes = append(meta.Remotes, gitRemote{Name: name, URL: url})
+	}
+	return meta, nil
+}
+
+// parseRefs parses "<object> <ref>" lines, leaving HEAD out.
+func parseRefs(out string) map[string]string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		object, ref, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && ref != "HEAD" {
+			refs[ref] = object
+		}
+	}
+	return refs
+}
+
+// encode returns the metadata as stored in the vault.
+func (m gitBundleMeta) encode() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// copyGitBundle stores the repository at gitDir in dst as a bundle of
+// every ref plus its metadata, instead of the .git tree. The bundle is
+// only rebuilt when a ref, HEAD or a remote changed, and its refs are
+// read back from it, so a repository changing during the copy is stored
+// as one consistent state. A repository without commits is stored as
+// metadata only.
+func (c *Copier) copyGitBundle(gitDir, dst string, spec *walkSpec, result *CopyResult) error {
+	return c.run(result, gitDir, "bundle", func(result *CopyResult) error {
+		bundlePath := filepath.Join(dst, gitBundleName+spec.bundleSuffix())
+		metaPath := filepath.Join(dst, gitBundleMetaName+spec.bundleSuffix())
+
+		meta, err := readGitState(gitDir)
+		if err != nil {
+			return err
+		}
+		content, err := meta.encode()
+		if err != nil {
+			return err
+		}
+
+		_, statErr := os.Stat(bundlePath)
+		hasBundle := statErr == nil
+		if existing, err := readVaultFile(c.cipher, metaPath); err == nil && bytes.Equal(existing, content) && hasBundle == (len(meta.Refs) > 0) {
+			result.FilesSkipped++
+			c.progress.file(false, 0)
+			return nil
+		}
+		if c.dryRun {
+			c.planWrite(metaPath, int64(len(content)), "", result)
+			if len(meta.Refs) > 0 {
+				c.planWrite(bundlePath, 0, "", result)
+			}
+			return nil
+		}
+
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		var size int64
+		if len(meta.Refs) > 0 {
+			if meta.Refs, size, err = c.writeGitBundle(gitDir, bundlePath, spec.encrypt); err != nil {
+				return err
+			}
+			if content, err = meta.encode(); err != nil {
+				return err
+			}
+		} else if err := os.Remove(bundlePath); err == nil {
+			result.FilesRemoved++
+		}
+
+		if spec.encrypt {
+			if content, err = c.cipher.encrypt(content); err != nil {
+				return err
+			}
+		}
+		if err := writeFileAtomic(metaPath, content, 0644); err != nil {
+			return err
+		}
+
+		result.FilesUpdated++
+		c.progress.file(true, size+int64(len(content)))
+		return nil
+	})
+}
+
+// writeGitBundle bundles every ref of the repository at gitDir to path,
+// through a temporary file, and returns the refs it holds and its size.
+func (c *Copier) writeGitBundle(gitDir, path string, encrypt bool) (map[string]string, int64, error) {
+	tmp, err := createAtomic(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if _, err := gitOutput(gitDir, "bundle", "create", "-q", tmp.Name(), "--all"); err != nil {
+		return nil, 0, err
+	}
+	heads, err := gitOutput(gitDir, "bundle", "list-heads", tmp.Name())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if encrypt {
+		plaintext, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return nil, 0, err
+		}
+		blob, err := c.cipher.encrypt(plaintext)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := writeFileAtomic(path, blob, 0644); err != nil {
+			return nil, 0, err
+		}
+		return parseRefs(heads), int64(len(blob)), nil
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, 0, err
+	}
+	return parseRefs(heads), info.Size(), nil
+}
+
+// restoreGitBundle recreates the .git of dst from the bundle stored in
+// src: refs are fetched from the bundle, HEAD and the remotes set as
+// recorded, and the index reset to HEAD so that the restored working
+// tree shows its uncommitted changes. In an existing repository, refs
+// are only created or fast-forwarded: one the bundle would move back or
+// away from its commits is kept and listed in result.Diverged, and its
+// other refs and objects are kept as well. The index is only reset when
+// HEAD moved. A repository already in the recorded state is left alone.
+func (r *Restorer) restoreGitBundle(src, dst string, result *RestoreResult) error {
+	metaPath := filepath.Join(src, gitBundleMetaName)
+	if _, err := os.Stat(metaPath); os.IsNotExist(err) {
+		metaPath += EncryptedExt
+	}
+	content, err := readVaultFile(r.cipher, metaPath)
+	if err != nil {
+		return err
+	}
+	var meta gitBundleMeta
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return fmt.Errorf("invalid %s: %w", gitBundleMetaName, err)
+	}
+	if meta.Version > gitBundleVersion {
+		return fmt.Errorf("%s version %d is newer than supported", gitBundleMetaName, meta.Version)
+	}
+
+	gitDir := filepath.Join(dst, ".git")
+	if current, err := readGitState(gitDir); err == nil && sameGitState(current, meta) {
+		result.FilesSkipped++
+		return nil
+	}
+
+	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		if err := exec.Command("git", "init", "-q", dst).Run(); err != nil {
+			return fmt.Errorf("git init: %w", err)
+		}
+	}
+
+	before, _ := gitOutput(gitDir, "rev-parse", "-q", "--verify", "HEAD")
+	if len(meta.Refs) > 0 {
+		if err := r.fetchGitBundle(src, gitDir, dst, meta, result); err != nil {
+			return err
+		}
+	}
+
+	if strings.HasPrefix(meta.Head, "refs/") {
+		_, err = gitOutput(gitDir, "symbolic-ref", "HEAD", meta.Head)
+	} else if meta.Head != "" {
+		// A detached HEAD only moves forward, like the refs
+		if _, err := gitOutput(gitDir, "symbolic-ref", "-q", "HEAD"); err == nil || fastForwards(gitDir, before, meta.Head) {
+			_, err = gitOutput(gitDir, "update-ref", "--no-deref", "HEAD", meta.Head)
+		} else {
+			result.Diverged = append(result.Diverged, divergedRef(r.home, dst, "HEAD", before, meta.Head))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, remote := range meta.Remotes {
+		if _, err := gitOutput(gitDir, "remote", "set-url", remote.Name, remote.URL); err != nil {
+			if _, err := gitOutput(gitDir, "remote", "add", remote.Name, remote.URL); err != nil {
+				return err
+			}
+		}
+	}
+
+	if after, err := gitOutput(gitDir, "rev-parse", "-q", "--verify", "HEAD"); err == nil && after != before {
+		reset := exec.Command("git", "reset", "-q")
+		reset.Dir = dst
+		if err := reset.Run(); err != nil {
+			return fmt.Errorf("git reset: %w", err)
+		}
+	}
+
+	result.FilesUpdated++
+	return nil
+}
+
+// fetchGitBundle fetches the refs of the bundle stored in src into
+// refs/snapfig/bundle/ of the repository at gitDir, then creates or
+// fast-forwards each recorded ref from there. Refs that would not
+// fast-forward are kept and listed in result.Diverged; the fetched
+// objects stay in the repository. The refs under refs/snapfig/ are
+// removed once done.
+func (r *Restorer) fetchGitBundle(src, gitDir, dst string, meta gitBundleMeta, result *RestoreResult) error {
+	bundle, cleanup, err := r.plainBundle(src)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	defer func() {
+		fetched, _ := gitOutput(gitDir, "for-each-ref", "--format=delete %(refname)", gitBundleFetchRefs)
+		if fetched != "" {
+			gitRun(gitDir, []byte(fetched+"\n"), "update-ref", "--stdin")
+		}
+	}()
+	if _, err := gitOutput(gitDir, "fetch", "-q", "--no-tags", bundle, "+refs/*:"+gitBundleFetchRefs+"*"); err != nil {
+		return err
+	}
+
+	refs := make([]string, 0, len(meta.Refs))
+	for ref := range meta.Refs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		object := meta.Refs[ref]
+		local, err := gitOutput(gitDir, "rev-parse", "-q", "--verify", ref)
+		switch {
+		case err != nil:
+			_, err = gitOutput(gitDir, "update-ref", ref, object, "")
+		case local == object:
+		case fastForwards(gitDir, local, object):
+			_, err = gitOutput(gitDir, "update-ref", ref, object, local)
+		default:
+			result.Diverged = append(result.Diverged, divergedRef(r.home, dst, ref, local, object))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastForwards reports whether moving from the commit local to object
+// keeps local in the history, local being empty for none.
+func fastForwards(gitDir, local, object string) bool {
+	if local == "" || local == object {
+		return true
+	}
+	_, err := gitOutput(gitDir, "merge-base", "--is-ancestor", local, object)
+	return err == nil
+}
+
+// divergedRef describes a ref of the repository at dst kept at local
+// instead of moving to object, the bundle's.
+func divergedRef(home, dst, ref, local, object string) string {
+	return fmt.Sprintf("%s: %s kept at %.7s, the vault has %.7s", displayPath(home, dst), ref, local, object)
+}
+
+// plainBundle returns the path of the bundle stored in src, decrypted
+// if needed to a temporary directory only the user can read, and a func
+// removing that directory.
+func (r *Restorer) plainBundle(src string) (string, func(), error) {
+	path := filepath.Join(src, gitBundleName)
+	if _, err := os.Stat(path); err == nil {
+		return path, func() {}, nil
+	}
+
+	plaintext, err := r.cipher.decryptFile(path + EncryptedExt)
+	if err != nil {
+		return "", nil, err
+	}
+	// MkdirTemp creates the directory with mode 0700
+	tmp, err := os.MkdirTemp("", "snapfig-bundle-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	bundle := filepath.Join(tmp, gitBundleName)
+	if err := os.WriteFile(bundle, plaintext, 0600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return bundle, cleanup, nil
+}
+
+// sameGitState reports whether a repository already holds the recorded
+// refs, HEAD and remotes. Refs it has beyond those do not count.
+func sameGitState(current, recorded gitBundleMeta) bool {
+	if current.Head != recorded.Head {
+		return false
+	}
+	for ref, object := range recorded.Refs {
+		if current.Refs[ref] != object {
+			return false
+		}
+	}
+	urls := make(map[string]string, len(current.Remotes))
+	for _, remote := range current.Remotes {
+		urls[remote.Name] = remote.URL
+	}
+	for _, remote := range recorded.Remotes {
+		if urls[remote.Name] != remote.URL {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,258 @@
+package snapfig
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// gitIn runs git in dir and returns its trimmed output.
+func gitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// makeNestedRepo creates a repository in dir with two commits on main,
+// a feature branch, a remote and an uncommitted change.
+func makeNestedRepo(t *testing.T, dir string) {
+	t.Helper()
+	os.MkdirAll(dir, 0755)
+	gitIn(t, dir, "init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "init.lua"), []byte("-- v1"), 0644)
+	gitIn(t, dir, "add", "-A")
+	gitIn(t, dir, "commit", "-q", "-m", "first")
+	gitIn(t, dir, "branch", "feature")
+	os.WriteFile(filepath.Join(dir, "init.lua"), []byte("-- v2"), 0644)
+	gitIn(t, dir, "commit", "-q", "-am", "second")
+	gitIn(t, dir, "remote", "add", "origin", "https://example.com/nvim.git")
+	os.WriteFile(filepath.Join(dir, "init.lua"), []byte("-- local edit"), 0644)
+}
+
+func TestCopyGitBundle(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	repo := filepath.Join(homeDir, ".config", "nvim")
+	makeNestedRepo(t, repo)
+
+	cfg := &config.Config{
+		Git:       config.GitModeBundle,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	stored := filepath.Join(vaultDir, ".config", "nvim")
+	if _, err := os.Stat(filepath.Join(stored, ".git")); !os.IsNotExist(err) {
+		t.Error("the .git tree should not be copied in bundle mode")
+	}
+	if _, err := os.Stat(filepath.Join(stored, gitBundleName)); err != nil {
+		t.Errorf("bundle not written: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(stored, gitBundleMetaName))
+	if err != nil {
+		t.Fatalf("bundle metadata not written: %v", err)
+	}
+	for _, want := range []string{`"head": "refs/heads/main"`, `"refs/heads/feature"`, `"url": "https://example.com/nvim.git"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metadata should contain %s, got %s", want, data)
+		}
+	}
+
+	// Unchanged refs: the bundle is not rebuilt
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if result.FilesUpdated != 0 {
+		t.Errorf("FilesUpdated = %d on an unchanged repository, want 0", result.FilesUpdated)
+	}
+
+	gitIn(t, repo, "commit", "-q", "-am", "third")
+	result, err = copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if result.FilesUpdated != 1 {
+		t.Errorf("FilesUpdated = %d after a commit, want the bundle updated", result.FilesUpdated)
+	}
+}
+
+func TestRestoreGitBundle(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	repo := filepath.Join(srcHome, ".config", "nvim")
+	makeNestedRepo(t, repo)
+
+	cfg := &config.Config{
+		Git:       config.GitModeBundle,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: srcHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	os.MkdirAll(dstHome, 0755)
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	restored := filepath.Join(dstHome, ".config", "nvim")
+	if _, err := os.Stat(filepath.Join(restored, gitBundleMetaName)); !os.IsNotExist(err) {
+		t.Error("bundle files should not be restored as files")
+	}
+	if got, want := gitIn(t, restored, "rev-parse", "HEAD"), gitIn(t, repo, "rev-parse", "HEAD"); got != want {
+		t.Errorf("HEAD = %s, want %s", got, want)
+	}
+	if got := gitIn(t, restored, "symbolic-ref", "HEAD"); got != "refs/heads/main" {
+		t.Errorf("HEAD should point at main, got %s", got)
+	}
+	if got, want := gitIn(t, restored, "rev-parse", "feature"), gitIn(t, repo, "rev-parse", "feature"); got != want {
+		t.Errorf("feature = %s, want %s", got, want)
+	}
+	if got := gitIn(t, restored, "remote", "get-url", "origin"); got != "https://example.com/nvim.git" {
+		t.Errorf("origin = %s", got)
+	}
+	// The working tree comes from the vault, the uncommitted edit included
+	if got := gitIn(t, restored, "status", "--porcelain"); got != "M init.lua" {
+		t.Errorf("status = %q, want the local edit only", got)
+	}
+
+	// A repository in the recorded state is left alone
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if result.FilesUpdated != 0 {
+		t.Errorf("FilesUpdated = %d on a second restore, want 0", result.FilesUpdated)
+	}
+}
+
+func TestRestoreGitBundleKeepsLocalCommits(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	repo := filepath.Join(srcHome, ".config", "nvim")
+	makeNestedRepo(t, repo)
+
+	cfg := &config.Config{
+		Git:       config.GitModeBundle,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: srcHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	// main gets a local commit ahead of the vault, feature moves on in the vault
+	restored := filepath.Join(dstHome, ".config", "nvim")
+	gitIn(t, restored, "commit", "-q", "-am", "local")
+	local := gitIn(t, restored, "rev-parse", "main")
+	work := gitIn(t, repo, "commit-tree", "feature^{tree}", "-p", "feature", "-m", "feature work")
+	gitIn(t, repo, "update-ref", "refs/heads/feature", work)
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if got := gitIn(t, restored, "rev-parse", "main"); got != local {
+		t.Errorf("main = %s, want the local commit %s kept", got, local)
+	}
+	if len(result.Diverged) != 1 || !strings.Contains(result.Diverged[0], "refs/heads/main") {
+		t.Errorf("Diverged = %v, want main reported", result.Diverged)
+	}
+	if got, want := gitIn(t, restored, "rev-parse", "feature"), gitIn(t, repo, "rev-parse", "feature"); got != want {
+		t.Errorf("feature = %s, want it fast-forwarded to %s", got, want)
+	}
+	if got := gitIn(t, restored, "for-each-ref", "refs/snapfig/"); got != "" {
+		t.Errorf("fetched refs left behind: %s", got)
+	}
+}
+
+func TestGitBundleEncryptedAndEmpty(t *testing.T) {
+	setupTestGitConfig(t)
+	t.Setenv(PassphraseEnv, "test-passphrase")
+
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	makeNestedRepo(t, filepath.Join(srcHome, "secret"))
+	empty := filepath.Join(srcHome, "empty")
+	os.MkdirAll(empty, 0755)
+	gitIn(t, empty, "init", "-q", "-b", "trunk")
+
+	cfg := &config.Config{
+		Git:       config.GitModeBundle,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: "secret", Enabled: true, Encrypt: true},
+			{Path: "empty", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: srcHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), cipher: newVaultCipher(cfg)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "secret", gitBundleName+EncryptedExt)); err != nil {
+		t.Errorf("bundle of an encrypted path should be encrypted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "empty", gitBundleName)); !os.IsNotExist(err) {
+		t.Error("a repository without commits should have no bundle")
+	}
+
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), cipher: newVaultCipher(cfg)}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if got := gitIn(t, filepath.Join(dstHome, "secret"), "log", "--format=%s", "-1"); got != "second" {
+		t.Errorf("last commit = %q, want second", got)
+	}
+	if got := gitIn(t, filepath.Join(dstHome, "empty"), "symbolic-ref", "HEAD"); got != "refs/heads/trunk" {
+		t.Errorf("HEAD of the empty repository = %s", got)
+	}
+
+	// The decrypted bundle is only readable by the user, and removed
+	bundle, cleanup, err := restorer.plainBundle(filepath.Join(vaultDir, "secret"))
+	if err != nil {
+		t.Fatalf("plainBundle() error: %v", err)
+	}
+	if info, err := os.Stat(filepath.Dir(bundle)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("decrypted bundle directory = %v, %v, want mode 0700", info, err)
+	}
+	cleanup()
+	if _, err := os.Stat(filepath.Dir(bundle)); !os.IsNotExist(err) {
+		t.Error("decrypted bundle should be removed")
+	}
+}
@@ -0,0 +1,273 @@
+package snapfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// Triggers of a copy, recorded in the Snapfig-Trigger commit trailer.
+const (
+	TriggerCLI    = "cli"
+	TriggerTUI    = "tui"
+	TriggerDaemon = "daemon"
+)
+
+// DefaultCommitTemplate renders the vault commit message when
+// commit_template is unset.
+const DefaultCommitTemplate = "{{ .Summary }}\n\n{{ .Body }}"
+
+// commitSummaryPaths is how many changed paths the summary line names.
+const commitSummaryPaths = 3
+
+// commitFilesLimit caps the files listed per watched path.
+const commitFilesLimit = 50
+
+// otherChanges groups changed vault files outside every watched path.
+const otherChanges = "(other)"
+
+type triggerKey struct{}
+
+// WithTrigger returns a copy of ctx recording what started the operation,
+// one of the Trigger constants.
+func WithTrigger(ctx context.Context, trigger string) context.Context {
+	return context.WithValue(ctx, triggerKey{}, trigger)
+}
+
+// triggerOf returns the trigger recorded in ctx, empty if none.
+func triggerOf(ctx context.Context) string {
+	trigger, _ := ctx.Value(triggerKey{}).(string)
+	return trigger
+}
+
+// CommitData is the data available to commit_template, e.g.
+// "{{ .Summary }} from {{ .Host }}" or "{{ range .Paths }}...{{ end }}".
+// The Snapfig-Host and Snapfig-Trigger trailers are always appended.
+type CommitData struct {
+	Summary  string       // default summary line
+	Body     string       // default body: changed files by watched path
+	Host     string       // host that made the copy
+	Trigger  string       // cli, tui or daemon
+	Paths    []CommitPath // changed watched paths, in config order
+	Added    int          // files added, over all paths
+	Modified int
+	Removed  int
+}
+
+// CommitPath lists the changed files of one watched path.
+type CommitPath struct {
+	Path     string
+	Added    []string
+	Modified []string
+	Removed  []string
+}
+
+// Changes returns the number of files changed under the path.
+func (p CommitPath) Changes() int {
+	return len(p.Added) + len(p.Modified) + len(p.Removed)
+}
+
+// commitData groups the staged vault changes by the watched path they
+// belong to. Files are shown as their watched path form: no host layer,
+// no encryption suffix. Files written by snapfig itself, such as the
+// manifest, are left out.
+func (c *Copier) commitData(ctx context.Context, changes []vaultChange) CommitData {
+	data := CommitData{Host: c.host, Trigger: triggerOf(ctx)}
+
+	groups := make(map[string]*CommitPath)
+	var order []string
+	for _, change := range changes {
+		item, display, ok := c.changedItem(change.Path)
+		if !ok {
+			continue
+		}
+		group := groups[item]
+		if group == nil {
+			group = &CommitPath{Path: item}
+			groups[item] = group
+			order = append(order, item)
+		}
+		switch change.Status {
+		case 'A':
+			group.Added = append(group.Added, display)
+			data.Added++
+		case 'D':
+			group.Removed = append(group.Removed, display)
+			data.Removed++
+		default:
+			group.Modified = append(group.Modified, display)
+			data.Modified++
+		}
+	}
+
+	// Config order, anything outside the watched paths last
+	rank := make(map[string]int, len(c.copiedItems))
+	for i, item := range c.copiedItems {
+		rank[item.Path] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		ri, iok := rank[order[i]]
+		rj, jok := rank[order[j]]
+		if iok != jok {
+			return iok
+		}
+		return ri < rj
+	})
+	for _, p := range order {
+		data.Paths = append(data.Paths, *groups[p])
+	}
+
+	data.Summary = commitSummary(data.Paths)
+	data.Body = commitBody(data.Paths)
+	return data
+}
+
+// changedItem returns the watched path a changed vault file belongs to
+// and how to show the file. The deepest watched path holding it wins.
+func (c *Copier) changedItem(vaultPath string) (item, display string, ok bool) {
+	rel := plainRel(filepath.FromSlash(vaultPath))
+
+	best := -1
+	for _, it := range c.copiedItems {
+		prefix := vaultRel(config.Watched{Path: it.Path})
+		if it.HostSpecific {
+			prefix = filepath.Join(HostsDir, it.Host, prefix)
+		}
+		if rel != prefix && !strings.HasPrefix(rel, prefix+string(filepath.Separator)) &&
+			strings.TrimSuffix(rel, templateExt) != prefix {
+			continue
+		}
+		if len(prefix) > best {
+			best = len(prefix)
+			item = it.Path
+			display = filepath.Join(it.Path, strings.TrimSuffix(rel[min(len(rel), len(prefix)):], templateExt))
+		}
+	}
+	if best >= 0 {
+		return item, display, true
+	}
+
+	top := firstSegment(rel)
+	if reservedVaultNames[top] && top != HostsDir && top != RootDir {
+		return "", "", false
+	}
+	return otherChanges, rel, true
+}
+
+// commitSummary names the paths with the most changed files, e.g.
+// "snapfig: backup .config/nvim, .bashrc and 2 more".
+func commitSummary(paths []CommitPath) string {
+	if len(paths) == 0 {
+		return "snapfig: update vault metadata"
+	}
+
+	top := make([]CommitPath, len(paths))
+	copy(top, paths)
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Changes() > top[j].Changes()
+	})
+
+	var names []string
+	for _, p := range top {
+		if len(names) == commitSummaryPaths {
+			break
+		}
+		names = append(names, p.Path)
+	}
+
+	s := "snapfig: backup "
+	switch rest := len(paths) - len(names); {
+	case rest > 0:
+		s += strings.Join(names, ", ") + fmt.Sprintf(" and %d more", rest)
+	case len(names) > 1:
+		s += strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	default:
+		s += names[0]
+	}
+	return s
+}
+
+// commitBody lists the changed files under each watched path, e.g.
+//
+//	.config/nvim: 1 added, 1 modified
+//	  A .config/nvim/lua/plugins.lua
+//	  M .config/nvim/init.lua
+func commitBody(paths []CommitPath) string {
+	var b strings.Builder
+	for i, p := range paths {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		var counts []string
+		for _, n := range []struct {
+			files []string
+			verb  string
+		}{{p.Added, "added"}, {p.Modified, "modified"}, {p.Removed, "removed"}} {
+			if len(n.files) > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", len(n.files), n.verb))
+			}
+		}
+		fmt.Fprintf(&b, "%s: %s\n", p.Path, strings.Join(counts, ", "))
+
+		listed := 0
+		for _, group := range []struct {
+			files  []string
+			status string
+		}{{p.Added, "A"}, {p.Modified, "M"}, {p.Removed, "D"}} {
+			for _, f := range group.files {
+				if listed == commitFilesLimit {
+					break
+				}
+				fmt.Fprintf(&b, "  %s %s\n", group.status, f)
+				listed++
+			}
+		}
+		if more := p.Changes() - listed; more > 0 {
+			fmt.Fprintf(&b, "  ... and %d more\n", more)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// commitMessage renders data with the configured template, or the
+// default one, and appends the trailers. A template that fails to
+// render is reported and the default message used instead.
+func commitMessage(tmpl string, data CommitData) (string, error) {
+	var renderErr error
+	msg := ""
+	if tmpl != "" {
+		msg, renderErr = renderCommitTemplate(tmpl, data)
+	}
+	if strings.TrimSpace(msg) == "" {
+		// The default template always renders
+		msg, _ = renderCommitTemplate(DefaultCommitTemplate, data)
+	}
+
+	msg = strings.TrimSpace(msg) + "\n\n"
+	if data.Host != "" {
+		msg += "Snapfig-Host: " + data.Host + "\n"
+	}
+	if data.Trigger != "" {
+		msg += "Snapfig-Trigger: " + data.Trigger + "\n"
+	}
+	return strings.TrimSpace(msg), renderErr
+}
+
+// renderCommitTemplate executes a commit_template.
+func renderCommitTemplate(tmpl string, data CommitData) (string, error) {
+	t, err := template.New("commit").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid commit_template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render commit_template: %w", err)
+	}
+	return buf.String(), nil
+}
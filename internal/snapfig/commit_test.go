@@ -0,0 +1,155 @@
+package snapfig
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestCommitSummary(t *testing.T) {
+	paths := []CommitPath{
+		{Path: ".bashrc", Modified: []string{".bashrc"}},
+		{Path: ".config/nvim", Added: []string{"a", "b"}, Removed: []string{"c"}},
+		{Path: ".zshrc", Modified: []string{".zshrc"}},
+		{Path: ".gitconfig", Modified: []string{".gitconfig"}},
+		{Path: ".tmux.conf", Modified: []string{".tmux.conf"}},
+	}
+
+	tests := []struct {
+		paths []CommitPath
+		want  string
+	}{
+		{nil, "snapfig: update vault metadata"},
+		{paths[:1], "snapfig: backup .bashrc"},
+		{paths[:2], "snapfig: backup .config/nvim and .bashrc"},
+		{paths[:3], "snapfig: backup .config/nvim, .bashrc and .zshrc"},
+		{paths, "snapfig: backup .config/nvim, .bashrc, .zshrc and 2 more"},
+	}
+	for _, tt := range tests {
+		if got := commitSummary(tt.paths); got != tt.want {
+			t.Errorf("commitSummary(%d paths) = %q, want %q", len(tt.paths), got, tt.want)
+		}
+	}
+}
+
+func TestCommitMessageTemplate(t *testing.T) {
+	data := CommitData{Summary: "snapfig: backup .bashrc", Body: ".bashrc: 1 modified", Host: "laptop", Trigger: TriggerDaemon, Modified: 1}
+
+	msg, err := commitMessage("", data)
+	if err != nil {
+		t.Fatalf("commitMessage() error: %v", err)
+	}
+	want := "snapfig: backup .bashrc\n\n.bashrc: 1 modified\n\nSnapfig-Host: laptop\nSnapfig-Trigger: daemon"
+	if msg != want {
+		t.Errorf("default message = %q, want %q", msg, want)
+	}
+
+	msg, err = commitMessage("[{{ .Host }}] {{ .Modified }} changed", data)
+	if err != nil {
+		t.Fatalf("commitMessage() error: %v", err)
+	}
+	if msg != "[laptop] 1 changed\n\nSnapfig-Host: laptop\nSnapfig-Trigger: daemon" {
+		t.Errorf("templated message = %q", msg)
+	}
+
+	// A template failing at render time falls back to the default
+	msg, err = commitMessage("{{ .Nope }}", data)
+	if err == nil {
+		t.Error("commitMessage() should report a failing template")
+	}
+	if msg != want {
+		t.Errorf("fallback message = %q, want %q", msg, want)
+	}
+}
+
+func TestCopyCommitMessage(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(filepath.Join(homeDir, ".config", "nvim", "lua"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "nvim", "init.lua"), []byte("-- init"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".config", "nvim", "lua", "old.lua"), []byte("-- old"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bash"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/nvim", Enabled: true},
+			{Path: ".bashrc", Enabled: true, HostSpecific: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, host: "laptop", meta: loadMetadata(vaultDir, false)}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	msg := lastCommitMessage(t, vaultDir)
+	if !strings.HasPrefix(msg, "snapfig: backup .config/nvim and .bashrc\n") {
+		t.Errorf("first commit = %q", msg)
+	}
+	if !strings.Contains(msg, "\n.bashrc: 1 added\n  A .bashrc\n") {
+		t.Errorf("host-specific file should be listed under its watched path, got %q", msg)
+	}
+
+	os.WriteFile(filepath.Join(homeDir, ".config", "nvim", "init.lua"), []byte("-- changed"), 0644)
+	os.Remove(filepath.Join(homeDir, ".config", "nvim", "lua", "old.lua"))
+	os.WriteFile(filepath.Join(homeDir, ".config", "nvim", "lua", "new.lua"), []byte("-- new"), 0644)
+
+	result, err := copier.CopyContext(WithTrigger(context.Background(), TriggerTUI), nil)
+	if err != nil || result.GitError != nil {
+		t.Fatalf("CopyContext() error: %v, git error: %v", err, result.GitError)
+	}
+	want := "snapfig: backup .config/nvim\n\n" +
+		".config/nvim: 1 added, 1 modified, 1 removed\n" +
+		"  A .config/nvim/lua/new.lua\n" +
+		"  M .config/nvim/init.lua\n" +
+		"  D .config/nvim/lua/old.lua\n\n" +
+		"Snapfig-Host: laptop\n" +
+		"Snapfig-Trigger: tui"
+	if msg := lastCommitMessage(t, vaultDir); msg != want {
+		t.Errorf("commit message = %q, want %q", msg, want)
+	}
+}
+
+func TestCopyCommitTemplate(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(homeDir, 0755)
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bash"), 0644)
+
+	cfg := &config.Config{
+		Git:            config.GitModeDisable,
+		VaultPath:      vaultDir,
+		CommitTemplate: "backup from {{ .Host }}{{ range .Paths }}\n- {{ .Path }}{{ end }}",
+		Watching:       []config.Watched{{Path: ".bashrc", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, host: "laptop", meta: loadMetadata(vaultDir, false)}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	want := "backup from laptop\n- .bashrc\n\nSnapfig-Host: laptop"
+	if msg := lastCommitMessage(t, vaultDir); msg != want {
+		t.Errorf("commit message = %q, want %q", msg, want)
+	}
+}
+
+func lastCommitMessage(t *testing.T, dir string) string {
+	t.Helper()
+	out, err := exec.Command("git", "-C", dir, "log", "-1", "--format=%B").Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -2,6 +2,8 @@
 package snapfig
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,13 +20,54 @@ type CopyResult struct {
 	FilesSkipped int   // files skipped (unchanged)
 	FilesRemoved int   // stale files removed from vault
 	GitError     error // non-fatal git error
+
+	Findings    []SecretFinding // suspected secrets in changed files
+	Quarantined []string        // files kept out of the vault by the quarantine policy
+	Unscanned   []string        // changed files too large to scan past their first MiB
+
+	TemplateDrift []string // rendered files edited locally; edit the template instead
+	Loops         []string // symlinks not followed because they lead back up the tree
+	Special       []string // fifos, sockets and devices left out, as "path (kind)"
+
+	Errors []CopyError // files and paths that failed, when continuing on errors
+
+	HookErrors []HookError // hooks that failed; the copy went on
+	changed    []string    // watched paths with files written or removed
+	repos      []RepoRef   // nested repositories stored by reference
+
+	// Planned changes, filled in on a dry run
+	changes []PlanEntry
+	gitDirs []GitDirPlan
+}
+
+// add merges the result of a file job, or what the walk recorded
+// between jobs, into r.
+func (r *CopyResult) add(o *CopyResult) {
+	r.FilesUpdated += o.FilesUpdated
+	r.FilesSkipped += o.FilesSkipped
+	r.FilesRemoved += o.FilesRemoved
+	r.Findings = append(r.Findings, o.Findings...)
+	r.Quarantined = append(r.Quarantined, o.Quarantined...)
+	r.Unscanned = append(r.Unscanned, o.Unscanned...)
+	r.TemplateDrift = append(r.TemplateDrift, o.TemplateDrift...)
+	r.Loops = append(r.Loops, o.Loops...)
+	r.Special = append(r.Special, o.Special...)
+	r.Errors = append(r.Errors, o.Errors...)
+	r.repos = append(r.repos, o.repos...)
+	r.changes = append(r.changes, o.changes...)
+	r.gitDirs = append(r.gitDirs, o.gitDirs...)
 }
 
 // CopiedItem represents an item that was copied with its git mode.
 type CopiedItem struct {
-	Path    string
-	GitMode config.GitMode
-	IsDir   bool
+	Path         string
+	GitMode      config.GitMode
+	IsDir        bool
+	Encrypted    bool
+	Host         string    // host that wrote the item
+	HostSpecific bool      // stored in the host layer
+	Pattern      string    // glob the path was matched by, if any
+	Repos        []RepoRef // nested repositories stored by reference
 }
 
 // Copier handles copying watched paths to the vault.
@@ -33,6 +76,20 @@ type Copier struct {
 	home        string
 	vaultDir    string
 	snapfigDir  string
+	host        string
+	index       *HashIndex
+	meta        *metadataStore
+	scanner     *secretScanner
+	cipher      *vaultCipher
+	templates   *templateEngine
+	hooks       *hookRunner
+	ctx         context.Context   // of the running copy
+	progress    *progressReporter // of the running copy
+	keepGoing   bool              // failures are recorded and the running copy goes on
+	workers     int
+	queue       *workQueue[CopyResult] // file jobs of the watched path being copied
+	dryRun      bool                   // plan changes instead of making them
+	stage       string                 // staging directory written instead of the vault, transactional copy only
 	copiedItems []CopiedItem
 }
 
@@ -50,71 +107,371 @@ func NewCopier(cfg *config.Config) (*Copier, error) {
 
 	snapfigDir := filepath.Dir(vaultDir)
 
+	host, err := cfg.Host()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	scanner, err := newSecretScanner(cfg, snapfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secrets allowlist: %w", err)
+	}
+
 	return &Copier{
 		cfg:        cfg,
 		home:       home,
 		vaultDir:   vaultDir,
 		snapfigDir: snapfigDir,
+		host:       host,
+		index:      LoadHashIndex(IndexPath(snapfigDir, vaultDir)),
+		meta:       loadMetadata(vaultDir, cfg.Metadata.Xattrs),
+		scanner:    scanner,
+		cipher:     newVaultCipher(cfg),
+		templates:  newTemplateEngine(cfg, vaultDir, host, home),
+		hooks:      newHookRunner(cfg, home),
+		workers:    cfg.EffectiveWorkers(),
 	}, nil
 }
 
 // Copy copies all enabled watched paths to the vault.
+// Changed files are scanned for secrets first; under the block policy
+// the result is returned together with ErrCommitBlocked and nothing is committed.
+// With transactional set in the config, see copyStaged.
+// The pre_copy and post_copy hooks run around it; post_copy only after
+// a copy that did not fail.
+// With on_error set to continue, files and paths that fail are recorded
+// in the result's Errors instead, and the rest is copied and committed.
 func (c *Copier) Copy() (*CopyResult, error) {
+	return c.CopyContext(context.Background(), nil)
+}
+
+// CopyContext is Copy reporting its progress to progress, if not nil.
+// Cancelling ctx stops the copy between files, before the commit, and
+// fails it with ctx's error: every file in the vault is whole, and a
+// transactional copy leaves the vault as it was.
+func (c *Copier) CopyContext(ctx context.Context, progress ProgressFunc) (*CopyResult, error) {
+	c.ctx = ctx
+	c.progress = newProgress(progress, "copy")
+	c.keepGoing = c.continueOnError()
+	defer func() {
+		c.ctx = nil
+		c.progress = nil
+		c.keepGoing = false
+	}()
+
+	pre := c.hooks.run(ctx, "pre_copy", c.cfg.Hooks.PreCopy, c.hookEnv("pre", ""))
+
+	copyFn := c.copyInPlace
+	if c.cfg.Transactional {
+		copyFn = c.copyStaged
+	}
+	result, err := copyFn()
+	if result == nil {
+		return nil, err
+	}
+	if pre != nil {
+		result.HookErrors = append([]HookError{*pre}, result.HookErrors...)
+	}
+	if err == nil {
+		env := c.hookEnv("post", "")
+		env.changed = result.changed
+		if post := c.hooks.run(ctx, "post_copy", c.cfg.Hooks.PostCopy, env); post != nil {
+			result.HookErrors = append(result.HookErrors, *post)
+		}
+	}
+	return result, err
+}
+
+// copyInPlace copies straight into the vault.
+func (c *Copier) copyInPlace() (*CopyResult, error) {
 	result := &CopyResult{}
-	c.copiedItems = nil
 
 	if err := os.MkdirAll(c.vaultDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create vault directory: %w", err)
 	}
+	removeAtomicTemps(c.vaultDir)
 
-	for _, w := range c.cfg.Watching {
-		if !w.Enabled {
-			continue
+	if err := c.write(result); err != nil {
+		return nil, err
+	}
+
+	c.index.Prune()
+	if err := c.index.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save hash index: %w", err)
+	}
+
+	if err := c.blocked(result); err != nil {
+		return result, err
+	}
+
+	c.commit(result)
+	return result, nil
+}
+
+// copyStaged copies into a staging directory cloned from the vault and
+// swaps it in only when every watched path succeeded, so a failed run,
+// or one blocked by secrets, leaves the vault as it was.
+func (c *Copier) copyStaged() (*CopyResult, error) {
+	result := &CopyResult{}
+
+	if err := os.MkdirAll(c.vaultDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create vault directory: %w", err)
+	}
+	if err := recoverVault(c.vaultDir); err != nil {
+		return nil, fmt.Errorf("failed to recover interrupted copy: %w", err)
+	}
+	removeAtomicTemps(c.vaultDir)
+
+	staging, err := stageVault(c.vaultDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage vault: %w", err)
+	}
+
+	meta := c.meta
+	c.stage = staging
+	c.meta = loadMetadata(staging, c.cfg.Metadata.Xattrs)
+	defer func() {
+		c.stage = ""
+		c.meta = meta
+	}()
+
+	err = c.write(result)
+	if err == nil {
+		err = c.blocked(result)
+	}
+	if err == nil {
+		// Last chance to back out with the vault untouched
+		err = c.cancelled()
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+		c.index.Forget(staging)
+		if errors.Is(err, ErrCommitBlocked) {
+			return result, err
 		}
+		return nil, err
+	}
+
+	if err := swapVault(c.vaultDir, staging); err != nil {
+		return nil, fmt.Errorf("failed to swap in staged vault: %w", err)
+	}
+	c.index.Rebase(staging, c.vaultDir)
+	c.index.Prune()
+	if err := c.index.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save hash index: %w", err)
+	}
+
+	c.commit(result)
+	return result, nil
+}
 
-		srcPath := filepath.Join(c.home, w.Path)
-		dstPath := filepath.Join(c.vaultDir, w.Path)
+// root returns the directory a copy writes to: the vault, or its
+// staging directory during a transactional copy.
+func (c *Copier) root() string {
+	if c.stage != "" {
+		return c.stage
+	}
+	return c.vaultDir
+}
+
+// write copies the watched paths and writes the manifest and metadata.
+func (c *Copier) write(result *CopyResult) error {
+	if err := c.copyWatched(result); err != nil {
+		return err
+	}
 
-		info, err := os.Stat(srcPath)
+	// Write manifest
+	if err := c.writeManifest(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	c.meta.prune()
+	if err := c.meta.save(); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// blocked returns ErrCommitBlocked when flagged files are pending
+// under the block policy.
+func (c *Copier) blocked(result *CopyResult) error {
+	if c.scanner != nil && c.scanner.policy == config.SecretsBlock && len(result.Findings) > 0 {
+		return fmt.Errorf("%w: %d finding(s)", ErrCommitBlocked, len(result.Findings))
+	}
+	return nil
+}
+
+// commit records the copy in the vault's git repository, with a
+// message describing the changes, see commitData.
+// Git errors are non-fatal and reported in the result.
+// It is not cancelled: a killed git could leave the repository locked.
+func (c *Copier) commit(result *CopyResult) {
+	c.progress.phase(PhaseCommitting)
+	// Initialize git repo if needed and commit
+	if err := InitVaultRepo(c.vaultDir); err != nil {
+		// Non-fatal: git might not be installed
+		result.GitError = err
+		return
+	}
+
+	changes, err := stageChanges(c.vaultDir)
+	if err != nil || len(changes) == 0 {
+		result.GitError = err
+		return
+	}
+	msg, tmplErr := commitMessage(c.cfg.CommitTemplate, c.commitData(c.context(), changes))
+	if err := commitStaged(c.vaultDir, msg); err != nil {
+		result.GitError = err
+		return
+	}
+	if tmplErr != nil {
+		// Committed with the default message instead
+		result.GitError = tmplErr
+	}
+}
+
+// copyWatched copies every enabled watched path into the vault.
+// Glob patterns are expanded first, each match copied as its own path.
+func (c *Copier) copyWatched(result *CopyResult) error {
+	c.copiedItems = nil
+
+	matches, unmatched, err := sourceMatches(c.home, c.cfg.Watching)
+	if err != nil {
+		return err
+	}
+	result.Skipped = append(result.Skipped, unmatched...)
+
+	c.progress.phase(PhaseCopying)
+	for i, m := range matches {
+		w := m.Watched
+		if err := c.cancelled(); err != nil {
+			return err
+		}
+		c.progress.path(w.Path, i, len(matches))
+		c.pathHook(result, "pre_copy", w.Hooks.PreCopy, w.Path, false)
+
+		srcPath := sourcePath(c.home, w)
+		dstPath, err := vaultTarget(c.root(), c.host, w)
+		if err != nil {
+			return err
+		}
+
+		// A watched path that is itself a symlink is taken as copyPath
+		// takes it: the link itself under preserve, even dangling, and
+		// its target otherwise
+		spec := newWalkSpec(c.cfg, w, srcPath)
+		info, err := os.Lstat(srcPath)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 && spec.symlinks != config.SymlinksPreserve {
+			info, err = os.Stat(srcPath)
+		}
 		if os.IsNotExist(err) {
 			result.Skipped = append(result.Skipped, w.Path)
 			continue
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to stat %s: %w", w.Path, err)
+			if err := c.tolerate(result, srcPath, "stat", err); err != nil {
+				return fmt.Errorf("failed to stat %s: %w", w.Path, err)
+			}
+			continue
 		}
 
-		// Smart copy: no RemoveAll, copyPath handles incremental updates
-		gitMode := w.EffectiveGitMode(c.cfg.Git)
-		if err := c.copyPath(srcPath, dstPath, gitMode, result); err != nil {
-			return nil, fmt.Errorf("failed to copy %s: %w", w.Path, err)
+		// Smart copy: no RemoveAll, copyPath handles incremental updates.
+		// Files are copied on the worker pool while the walk goes on.
+		written := result.FilesUpdated + result.FilesRemoved
+		repos := len(result.repos)
+		c.queue = newWorkQueue[CopyResult](c.workers)
+		err = c.finish(c.copyPath(srcPath, dstPath, spec, &c.queue.walked), result)
+		if err != nil {
+			if err := c.tolerate(result, srcPath, "copy", err); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", w.Path, err)
+			}
+		}
+		if result.FilesUpdated+result.FilesRemoved > written {
+			result.changed = append(result.changed, w.Path)
+			c.pathHook(result, "post_copy", w.Hooks.PostCopy, w.Path, true)
 		}
 
 		c.copiedItems = append(c.copiedItems, CopiedItem{
-			Path:    w.Path,
-			GitMode: gitMode,
-			IsDir:   info.IsDir(),
+			Path:         w.Path,
+			GitMode:      spec.gitMode,
+			IsDir:        info.IsDir(),
+			Encrypted:    spec.encrypt,
+			Host:         c.host,
+			HostSpecific: w.HostSpecific,
+			Pattern:      m.Pattern,
+			Repos:        result.repos[repos:],
 		})
-		result.Copied = append(result.Copied, w.Path)
+		// A failed path stays in the manifest: the vault keeps what it had
+		if err == nil {
+			result.Copied = append(result.Copied, w.Path)
+		}
 	}
+	c.progress.path("", len(matches), len(matches))
+	return nil
+}
 
-	// Write manifest
-	if err := c.writeManifest(); err != nil {
-		return nil, fmt.Errorf("failed to write manifest: %w", err)
+// hookEnv returns the environment of a copy hook.
+func (c *Copier) hookEnv(phase, path string) hookEnv {
+	return hookEnv{operation: "copy", phase: phase, vaultDir: c.vaultDir, host: c.host, path: path}
+}
+
+// pathHook runs a per-path copy hook, recording its failure in result.
+// A dry run runs no hooks.
+func (c *Copier) pathHook(result *CopyResult, hook, command, path string, post bool) {
+	if c.dryRun {
+		return
+	}
+	env := c.hookEnv("pre", path)
+	if post {
+		env.phase = "post"
+		env.changed = []string{path}
 	}
+	if herr := c.hooks.run(c.context(), hook, command, env); herr != nil {
+		result.HookErrors = append(result.HookErrors, *herr)
+	}
+}
 
-	// Initialize git repo if needed and commit
-	if err := InitVaultRepo(c.vaultDir); err != nil {
-		// Non-fatal: git might not be installed
-		result.GitError = err
-	} else {
-		msg := fmt.Sprintf("snapfig: backup %d paths", len(result.Copied))
-		if err := CommitVault(c.vaultDir, msg); err != nil {
-			result.GitError = err
+// context returns the context of the running copy.
+func (c *Copier) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// cancelled returns the error of the running copy's context, if done.
+func (c *Copier) cancelled() error {
+	return c.context().Err()
+}
+
+// run executes a file job for path: on the worker pool while a watched
+// path is being copied, inline otherwise. Jobs queued when the copy is
+// cancelled do nothing. op names the job in the errors tolerated.
+func (c *Copier) run(result *CopyResult, path, op string, fn func(*CopyResult) error) error {
+	job := func(result *CopyResult) error {
+		if err := c.cancelled(); err != nil {
+			return err
 		}
+		return c.tolerate(result, path, op, fn(result))
+	}
+	if c.queue == nil {
+		return job(result)
 	}
+	return c.queue.submit(job)
+}
 
-	return result, nil
+// finish waits for the file jobs of the watched path being copied and
+// merges their results in walk order. A walk error takes precedence.
+func (c *Copier) finish(walkErr error, result *CopyResult) error {
+	q := c.queue
+	c.queue = nil
+	if q == nil {
+		return walkErr
+	}
+	if err := q.wait(result.add); walkErr == nil {
+		return err
+	}
+	return walkErr
 }
 
 // writeManifest creates both files inside the vault:
@@ -124,8 +481,13 @@ func (c *Copier) Copy() (*CopyResult, error) {
 func (c *Copier) writeManifest() error {
 	entries := FromWatching(c.cfg.Watching, c.copiedItems)
 
+	// Keep the host-specific entries written by other hosts
+	if existing, err := LoadManifest(c.root()); err == nil {
+		entries = mergeHostEntries(existing.Entries, entries, c.host)
+	}
+
 	// Write YAML manifest (for machine use)
-	if err := WriteManifest(c.vaultDir, entries); err != nil {
+	if err := WriteManifest(c.root(), entries); err != nil {
 		return err
 	}
 
@@ -135,7 +497,7 @@ func (c *Copier) writeManifest() error {
 
 // writeReadme creates a human-readable README for the vault.
 func (c *Copier) writeReadme() error {
-	readmePath := filepath.Join(c.vaultDir, "README.md")
+	readmePath := filepath.Join(c.root(), "README.md")
 
 	var content string
 	content += "# Snapfig Backup\n\n"
@@ -149,12 +511,22 @@ func (c *Copier) writeReadme() error {
 		if item.IsDir {
 			itemType = "dir"
 		}
+		if item.Encrypted {
+			itemType += ", encrypted"
+		}
+		if item.HostSpecific {
+			itemType += ", host " + item.Host
+		}
 
 		gitModeStr := string(item.GitMode)
 		if item.GitMode == config.GitModeDisable {
 			gitModeStr = "disable (.git → .git_disabled)"
 		} else if item.GitMode == config.GitModeRemove {
 			gitModeStr = "remove (.git deleted)"
+		} else if item.GitMode == config.GitModeBundle {
+			gitModeStr = "bundle (.git → " + gitBundleName + ")"
+		} else if item.GitMode == config.GitModeReference {
+			gitModeStr = "reference (cloned on restore)"
 		}
 
 		content += fmt.Sprintf("| `%s` | %s | %s |\n", item.Path, itemType, gitModeStr)
@@ -163,5 +535,5 @@ func (c *Copier) writeReadme() error {
 	content += fmt.Sprintf("\n## Summary\n\n- **Total items**: %d\n", len(c.copiedItems))
 	content += fmt.Sprintf("- **Vault location**: `%s`\n", c.vaultDir)
 
-	return os.WriteFile(readmePath, []byte(content), 0644)
+	return writeFileAtomic(readmePath, []byte(content), 0644)
 }
@@ -401,6 +401,17 @@ func TestShouldCopy(t *testing.T) {
 			},
 			wantCopy: true,
 		},
+		{
+			name: "same size and mod time but content differs",
+			setup: func() {
+				os.WriteFile(src, []byte("content A"), 0644)
+				os.WriteFile(dst, []byte("content B"), 0644)
+				now := time.Now()
+				os.Chtimes(src, now, now)
+				os.Chtimes(dst, now, now)
+			},
+			wantCopy: true,
+		},
 		{
 			name: "size differs",
 			setup: func() {
@@ -423,7 +434,7 @@ func TestShouldCopy(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setup()
 
-			needsCopy, err := shouldCopy(src, dst)
+			needsCopy, err := shouldCopy(nil, src, dst)
 			if tt.wantErr {
 				if err == nil {
 					t.Error("shouldCopy() expected error, got nil")
@@ -660,9 +671,12 @@ func TestCopySymlinkCreatesMarker(t *testing.T) {
 		t.Fatalf("marker file not created: %v", err)
 	}
 
-	expected := "ln -s " + targetDir + " current\n"
-	if string(content) != expected {
-		t.Errorf("marker content = %q, want %q", string(content), expected)
+	marker, legacy, err := decodeSymlinkMarker(content, "current.snapfig-symlink")
+	if err != nil || legacy {
+		t.Fatalf("marker content = %q, legacy %v, err %v", string(content), legacy, err)
+	}
+	if marker.Name != "current" || marker.Target != targetDir || marker.Relative {
+		t.Errorf("marker = %+v, want current -> %s", marker, targetDir)
 	}
 
 	targetCopied := filepath.Join(vaultDir, ".config", "themes", "current", "theme.yml")
@@ -1,65 +1,162 @@
 package snapfig
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/adrianpk/snapfig/internal/config"
 )
 
-const symlinkMarkerExt = ".snapfig-symlink"
-
 // copyPath copies a file or directory from src to dst, handling .git according to mode.
-// Uses smart copy: only copies files that have changed (by ModTime/Size).
-func (c *Copier) copyPath(src, dst string, gitMode config.GitMode, result *CopyResult) error {
-	info, err := os.Stat(src)
+// Uses smart copy: only copies files whose content has changed.
+// A watched path that is itself a symlink is followed, unless the policy
+// is preserve: a marker would lose the content of a target kept elsewhere.
+func (c *Copier) copyPath(src, dst string, spec *walkSpec, result *CopyResult) error {
+	info, err := os.Lstat(src)
 	if err != nil {
 		return err
 	}
+	preserve := info.Mode()&os.ModeSymlink != 0 && spec.symlinks == config.SymlinksPreserve
+	if info.Mode()&os.ModeSymlink != 0 && !preserve {
+		if info, err = os.Stat(src); err != nil {
+			return err
+		}
+	}
+
+	if kind := specialKind(info.Mode()); kind != "" && !preserve {
+		c.skipSpecial(src, kind, result)
+		return nil
+	}
 
 	if !info.IsDir() {
-		return c.copyFile(src, dst, info.Mode(), result)
+		// Drop other representations left by toggling encrypt or template
+		target := dst + spec.vaultSuffix(filepath.Base(dst))
+		if preserve {
+			target = dst
+		}
+		for _, suffix := range []string{"", EncryptedExt, templateExt, templateExt + EncryptedExt} {
+			stale := dst + suffix
+			if stale == target {
+				continue
+			}
+			if c.dryRun {
+				if _, err := os.Lstat(stale); err == nil {
+					if err := c.planRemove(stale, result); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := os.Remove(stale); err == nil {
+				c.index.Forget(stale)
+				result.FilesRemoved++
+			}
+		}
+		if preserve {
+			return c.copyLink(src, dst, result)
+		}
+		return c.copyRegular(src, dst, info, spec, result)
 	}
 
-	return c.copyDir(src, dst, gitMode, result)
+	return c.copyDir(src, dst, "", spec, result)
 }
 
 // copyDir recursively copies a directory, handling .git according to mode.
-// Removes files from dst that no longer exist in src.
-func (c *Copier) copyDir(src, dst string, gitMode config.GitMode, result *CopyResult) error {
+// rel is the path of src relative to the watched root, used for filtering.
+// Removes files from dst that no longer exist in src or are filtered out.
+func (c *Copier) copyDir(src, dst, rel string, spec *walkSpec, result *CopyResult) error {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
-		return err
+	defer spec.enter(src)()
+
+	if !c.dryRun {
+		if err := c.clearLink(dst); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
+			return err
+		}
+		c.meta.record(dst, src, srcInfo)
 	}
 
-	// Build set of source entries for stale detection
-	srcEntries := make(map[string]bool)
 	entries, err := os.ReadDir(src)
 	if err != nil {
 		return err
 	}
+	if err := c.keepDir(dst, len(entries) == 0); err != nil {
+		return err
+	}
+
+	// Rendered output of a template marker is not backed up: the
+	// template next to it is the source
+	templates := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), templateExt) {
+			templates[strings.TrimSuffix(entry.Name(), templateExt)] = true
+		}
+	}
 
+	// Drop filtered entries up front so they are treated as stale
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Name() == keepMarker || spec.skip(filepath.Join(rel, entry.Name()), entry.IsDir()) {
+			continue
+		}
+		// Restore's backups are not part of the configuration
+		if entry.Type().IsRegular() && isBackupFile(entry.Name()) {
+			continue
+		}
+		// Left out, and dropped from the vault like a deleted file
+		if kind := specialKind(entry.Type()); kind != "" {
+			c.skipSpecial(filepath.Join(src, entry.Name()), kind, result)
+			continue
+		}
+		if !spec.template && entry.Type().IsRegular() && templates[entry.Name()] {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	entries = kept
+
+	// Build set of source entries for stale detection
+	srcEntries := make(map[string]bool)
+	links := make(map[string]linkKind)
 	for _, entry := range entries {
 		name := entry.Name()
 
 		// Track the destination name (for .git -> .git_disabled mapping)
 		dstName := name
 		if name == ".git" && entry.IsDir() {
-			switch gitMode {
+			switch spec.gitMode {
 			case config.GitModeRemove:
 				continue
 			case config.GitModeDisable:
 				dstName = ".git_disabled"
+			case config.GitModeBundle:
+				srcEntries[gitBundleName+spec.bundleSuffix()] = true
+				dstName = gitBundleMetaName + spec.bundleSuffix()
+			case config.GitModeReference:
+				dstName = gitDiffName + spec.bundleSuffix()
 			}
 		}
 		if entry.Type()&os.ModeSymlink != 0 {
-			dstName = name + symlinkMarkerExt
+			kind := classifyLink(filepath.Join(src, name), spec)
+			links[name] = kind
+			if kind == linkLoop {
+				continue
+			}
+			dstName = kind.vaultName(name, spec)
+		} else if entry.Type().IsRegular() {
+			dstName = name + spec.vaultSuffix(name)
 		}
 		srcEntries[dstName] = true
 	}
@@ -71,12 +168,35 @@ func (c *Copier) copyDir(src, dst string, gitMode config.GitMode, result *CopyRe
 
 	// Copy entries
 	for _, entry := range entries {
+		if err := c.cancelled(); err != nil {
+			return err
+		}
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
+		entryRel := filepath.Join(rel, entry.Name())
 
-		// Handle symlinks: create marker file with ln command
+		// Handle symlinks as their watched path's policy says
 		if entry.Type()&os.ModeSymlink != 0 {
-			if err := c.copySymlinkMarker(srcPath, dstPath+symlinkMarkerExt, entry.Name(), result); err != nil {
+			var err error
+			op := "link"
+			switch links[entry.Name()] {
+			case linkLoop:
+				result.Loops = append(result.Loops, displayPath(c.home, srcPath))
+			case linkMarker:
+				err = c.copySymlinkMarker(srcPath, dstPath+symlinkMarkerExt, entry.Name(), result)
+			case linkPreserve:
+				err = c.copyLink(srcPath, dstPath, result)
+			case linkDir:
+				op = "copy"
+				err = c.copyDir(srcPath, dstPath, entryRel, spec, result)
+			case linkFile:
+				op = "copy"
+				var info os.FileInfo
+				if info, err = os.Stat(srcPath); err == nil {
+					err = c.copyRegular(srcPath, dstPath, info, spec, result)
+				}
+			}
+			if err := c.tolerate(result, srcPath, op, err); err != nil {
 				return err
 			}
 			continue
@@ -84,27 +204,39 @@ func (c *Copier) copyDir(src, dst string, gitMode config.GitMode, result *CopyRe
 
 		// Handle .git directories
 		if entry.Name() == ".git" && entry.IsDir() {
-			switch gitMode {
+			if c.dryRun {
+				result.gitDirs = append(result.gitDirs, GitDirPlan{Path: displayPath(c.home, srcPath), Mode: spec.gitMode})
+			}
+			switch spec.gitMode {
 			case config.GitModeRemove:
 				continue
 			case config.GitModeDisable:
 				dstPath = filepath.Join(dst, ".git_disabled")
+			case config.GitModeBundle:
+				if err := c.copyGitBundle(srcPath, dst, spec, result); err != nil {
+					return err
+				}
+				continue
+			case config.GitModeReference:
+				if err := c.copyGitReference(srcPath, dst, spec, result); err != nil {
+					return err
+				}
+				continue
 			}
 		}
 
+		var err error
 		if entry.IsDir() {
-			if err := c.copyDir(srcPath, dstPath, gitMode, result); err != nil {
-				return err
-			}
+			err = c.copyDir(srcPath, dstPath, entryRel, spec, result)
 		} else {
-			info, err := entry.Info()
-			if err != nil {
-				return err
-			}
-			if err := c.copyFile(srcPath, dstPath, info.Mode(), result); err != nil {
-				return err
+			var info os.FileInfo
+			if info, err = entry.Info(); err == nil {
+				err = c.copyRegular(srcPath, dstPath, info, spec, result)
 			}
 		}
+		if err := c.tolerate(result, srcPath, "copy", err); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -121,11 +253,24 @@ func (c *Copier) removeStale(dst string, srcEntries map[string]bool, result *Cop
 	}
 
 	for _, entry := range dstEntries {
+		if entry.Name() == keepMarker {
+			continue
+		}
 		if !srcEntries[entry.Name()] {
 			stalePath := filepath.Join(dst, entry.Name())
+			if c.dryRun {
+				if err := c.planRemove(stalePath, result); err != nil {
+					return err
+				}
+				continue
+			}
 			if err := os.RemoveAll(stalePath); err != nil {
-				return err
+				if err := c.tolerate(result, stalePath, "remove", err); err != nil {
+					return err
+				}
+				continue
 			}
+			c.index.Forget(stalePath)
 			result.FilesRemoved++
 		}
 	}
@@ -134,24 +279,35 @@ func (c *Copier) removeStale(dst string, srcEntries map[string]bool, result *Cop
 }
 
 func (c *Copier) copySymlinkMarker(srcPath, dstPath, name string, result *CopyResult) error {
-	target, err := os.Readlink(srcPath)
+	target, err := linkTarget(c.home, srcPath)
 	if err != nil {
 		return err
 	}
 
-	content := fmt.Sprintf("ln -s %s %s\n", target, name)
+	var mode os.FileMode
+	if info, err := os.Lstat(srcPath); err == nil {
+		mode = info.Mode()
+	}
+	content, err := newSymlinkMarker(name, target, mode).encode()
+	if err != nil {
+		return err
+	}
 
 	existing, err := os.ReadFile(dstPath)
-	if err == nil && string(existing) == content {
+	if err == nil && bytes.Equal(existing, content) {
 		result.FilesSkipped++
 		return nil
 	}
+	if c.dryRun {
+		c.planWrite(dstPath, int64(len(content)), target, result)
+		return nil
+	}
 
 	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(dstPath, []byte(content), 0644); err != nil {
+	if err := writeFileAtomic(dstPath, content, 0644); err != nil {
 		return err
 	}
 
@@ -159,9 +315,11 @@ func (c *Copier) copySymlinkMarker(srcPath, dstPath, name string, result *CopyRe
 	return nil
 }
 
-// shouldCopy checks if a file needs to be copied by comparing ModTime and Size.
-// Returns true if the file should be copied (destination doesn't exist or differs).
-func shouldCopy(src, dst string) (bool, error) {
+// shouldCopy checks if a file needs to be copied.
+// Returns true if the destination doesn't exist or its content differs.
+// Content is compared through the hash index, so files whose size and
+// mtime are unchanged since the last run are not read again.
+func shouldCopy(idx *HashIndex, src, dst string) (bool, error) {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return false, err
@@ -175,21 +333,135 @@ func shouldCopy(src, dst string) (bool, error) {
 		return false, err
 	}
 
-	// Copy if size differs or source is newer
-	if srcInfo.Size() != dstInfo.Size() {
-		return true, nil
+	return contentDiffers(idx, src, srcInfo, dst, dstInfo)
+}
+
+// copyRegular copies a file in the form its watched path asks for,
+// and records its metadata for restore.
+// Runs on the worker pool while a watched path is being copied.
+func (c *Copier) copyRegular(src, dst string, info os.FileInfo, spec *walkSpec, result *CopyResult) error {
+	suffix := spec.vaultSuffix(filepath.Base(dst))
+	target := dst + suffix
+	if err := c.clearLink(target); err != nil {
+		return err
 	}
-	if srcInfo.ModTime().After(dstInfo.ModTime()) {
-		return true, nil
+
+	return c.run(result, src, "copy", func(result *CopyResult) error {
+		updated := result.FilesUpdated
+		var err error
+		kept := false
+		if strings.HasPrefix(suffix, templateExt) {
+			kept, err = c.keepTemplate(src, target, result)
+		}
+		if err == nil && !kept {
+			if strings.HasSuffix(suffix, EncryptedExt) {
+				err = c.copyEncrypted(src, target, info.Mode(), result)
+			} else {
+				err = c.copyFile(src, target, info.Mode(), result)
+			}
+		}
+		if err != nil || c.dryRun {
+			return err
+		}
+		c.progress.file(result.FilesUpdated > updated, info.Size())
+
+		c.meta.record(target, src, info)
+		return nil
+	})
+}
+
+// keepTemplate protects the template source of a file in a template path.
+// The file in home is rendered output, so once the vault holds a source
+// it is never overwritten; when the output no longer matches the rendered
+// source, the path is reported as drifted. Returns false when there is
+// no source yet, so the file is copied to seed one.
+func (c *Copier) keepTemplate(src, target string, result *CopyResult) (bool, error) {
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		return false, nil
 	}
 
-	return false, nil
+	source, err := readVaultFile(c.cipher, target)
+	if err != nil {
+		return false, err
+	}
+	rendered, err := c.templates.render(filepath.Base(target), source)
+	if err != nil {
+		return false, fmt.Errorf("failed to render %s: %w", filepath.Base(target), err)
+	}
+	current, err := os.ReadFile(src)
+	if err != nil {
+		return false, err
+	}
+
+	if !bytes.Equal(current, rendered) {
+		result.TemplateDrift = append(result.TemplateDrift, displayPath(c.home, src))
+	}
+	result.FilesSkipped++
+	return true, nil
+}
+
+// copyEncrypted stores a file as an encrypted blob.
+// Unchanged files are detected by plaintext hash, so blobs are only
+// rewritten (with a fresh nonce) when the content actually changed.
+// Encrypted files are not secret-scanned: plaintext never reaches the vault.
+func (c *Copier) copyEncrypted(src, dst string, mode os.FileMode, result *CopyResult) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	srcHash, err := c.index.Hash(src, srcInfo)
+	if err != nil {
+		return err
+	}
+
+	if dstInfo, err := os.Stat(dst); err == nil {
+		dstHash, err := plainHash(c.index, c.cipher, dst, dstInfo)
+		if err != nil {
+			return err
+		}
+		if dstHash == srcHash {
+			result.FilesSkipped++
+			return nil
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if c.dryRun {
+		c.planWrite(dst, srcInfo.Size(), "", result)
+		return nil
+	}
+
+	plaintext, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	blob, err := c.cipher.encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dst, blob, mode); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(plaintext)
+	hash := hex.EncodeToString(sum[:])
+	c.index.Record(src, srcInfo, hash)
+	if dstInfo, err := os.Stat(dst); err == nil {
+		c.index.Record(dst, dstInfo, hash)
+	}
+
+	result.FilesUpdated++
+	return nil
 }
 
 // copyFile copies a single file preserving permissions.
-// Skips copy if file hasn't changed (same ModTime and Size).
+// Skips copy if the content hasn't changed.
 func (c *Copier) copyFile(src, dst string, mode os.FileMode, result *CopyResult) error {
-	needsCopy, err := shouldCopy(src, dst)
+	needsCopy, err := shouldCopy(c.index, src, dst)
 	if err != nil {
 		return err
 	}
@@ -198,6 +470,18 @@ func (c *Copier) copyFile(src, dst string, mode os.FileMode, result *CopyResult)
 		return nil
 	}
 
+	if ok, err := c.checkSecrets(src, result); err != nil || !ok {
+		return err
+	}
+	if c.dryRun {
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		c.planWrite(dst, srcInfo.Size(), "", result)
+		return nil
+	}
+
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
 	}
@@ -208,15 +492,70 @@ func (c *Copier) copyFile(src, dst string, mode os.FileMode, result *CopyResult)
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstFile, err := createAtomic(dst)
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	if err == nil {
-		result.FilesUpdated++
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dstFile, h), srcFile); err != nil {
+		dstFile.abort()
+		return err
+	}
+	if err := dstFile.commit(mode); err != nil {
+		return err
+	}
+
+	// Record both sides so the next run takes the fast path
+	if dstInfo, err := os.Stat(dst); err == nil {
+		hash := hex.EncodeToString(h.Sum(nil))
+		c.index.Record(src, srcInfo, hash)
+		c.index.Record(dst, dstInfo, hash)
+	}
+
+	result.FilesUpdated++
+	return nil
+}
+
+// checkSecrets scans a changed file before it is written to the vault.
+// Returns false when the policy keeps the file out of the vault.
+func (c *Copier) checkSecrets(src string, result *CopyResult) (bool, error) {
+	if c.scanner == nil {
+		return true, nil
+	}
+
+	rel := displayPath(c.home, src)
+	findings, complete, err := c.scanner.scanFile(src, rel)
+	if err != nil {
+		return false, err
+	}
+	if !complete {
+		result.Unscanned = append(result.Unscanned, rel)
+	}
+	if len(findings) == 0 {
+		return true, nil
+	}
+	result.Findings = append(result.Findings, findings...)
+
+	switch c.scanner.policy {
+	case config.SecretsQuarantine:
+		if c.dryRun {
+			result.Quarantined = append(result.Quarantined, rel)
+			return false, nil
+		}
+		if err := c.scanner.quarantineFile(src, rel); err != nil {
+			return false, fmt.Errorf("failed to quarantine %s: %w", rel, err)
+		}
+		result.Quarantined = append(result.Quarantined, rel)
+		return false, nil
+	case config.SecretsBlock:
+		return false, nil
+	default:
+		return true, nil
 	}
-	return err
 }
@@ -0,0 +1,72 @@
+package snapfig
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// CopyError records a file or watched path that a copy continuing on
+// errors could not back up. The rest of the copy went on.
+type CopyError struct {
+	Path string // relative to home, or absolute outside it
+	Op   string // what failed: stat, copy, link, remove, bundle or reference
+	Err  error
+}
+
+func (e *CopyError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *CopyError) Unwrap() error {
+	return e.Err
+}
+
+// continueOnError reports whether a copy records failures and goes on
+// instead of stopping: the daemon's on_error applies to its own copies,
+// the global one to the others. A transactional copy always stops, as
+// it only swaps in a vault where every path succeeded.
+func (c *Copier) continueOnError() bool {
+	if c.cfg.Transactional {
+		return false
+	}
+	policy := c.cfg.EffectiveOnError()
+	if triggerOf(c.context()) == TriggerDaemon {
+		policy = c.cfg.Daemon.EffectiveOnError()
+	}
+	return policy == config.OnErrorContinue
+}
+
+// tolerate records err against path and returns nil when the running
+// copy continues on errors. Otherwise, or once the copy is cancelled,
+// err is returned as is.
+func (c *Copier) tolerate(result *CopyResult, path, op string, err error) error {
+	if err == nil || !c.keepGoing || c.cancelled() != nil {
+		return err
+	}
+	result.Errors = append(result.Errors, CopyError{Path: displayPath(c.home, path), Op: op, Err: err})
+	return nil
+}
+
+// specialKind names the kind of a file that cannot be backed up, such
+// as a fifo, whose open would block, or a socket. It is empty for
+// regular files, directories and symlinks.
+func specialKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode&os.ModeIrregular != 0:
+		return "irregular file"
+	}
+	return ""
+}
+
+// skipSpecial records the special file at path as left out.
+func (c *Copier) skipSpecial(path, kind string, result *CopyResult) {
+	result.Special = append(result.Special, fmt.Sprintf("%s (%s)", displayPath(c.home, path), kind))
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package snapfig
+
+import "errors"
+
+// mkfifo fails: named pipes are not supported here.
+func mkfifo(path string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,114 @@
+package snapfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// makeFailingHome creates a home where .config/app/a.conf cannot be
+// copied, its vault copy being in the way as a directory, next to a
+// fifo and files that copy fine.
+func makeFailingHome(t *testing.T, homeDir, vaultDir string) {
+	t.Helper()
+	app := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(app, 0755)
+	os.WriteFile(filepath.Join(app, "a.conf"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(app, "b.conf"), []byte("b"), 0644)
+	if err := mkfifo(filepath.Join(app, "pipe")); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bash"), 0644)
+
+	blocker := filepath.Join(vaultDir, ".config", "app", "a.conf")
+	os.MkdirAll(blocker, 0755)
+	os.WriteFile(filepath.Join(blocker, "in-the-way"), []byte("x"), 0644)
+}
+
+func TestCopyContinueOnError(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	makeFailingHome(t, homeDir, vaultDir)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		OnError:   config.OnErrorContinue,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+			{Path: ".bashrc", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("Errors = %v, want one", result.Errors)
+	}
+	if e := result.Errors[0]; e.Path != ".config/app/a.conf" || e.Op != "copy" || e.Err == nil {
+		t.Errorf("error = %+v, want a failed copy of .config/app/a.conf", e)
+	}
+	if len(result.Special) != 1 || result.Special[0] != ".config/app/pipe (fifo)" {
+		t.Errorf("Special = %v, want the fifo", result.Special)
+	}
+
+	for _, p := range []string{".config/app/b.conf", ".bashrc"} {
+		if _, err := os.Stat(filepath.Join(vaultDir, p)); err != nil {
+			t.Errorf("%s should be copied despite the failure: %v", p, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(vaultDir, ".config", "app", "pipe")); !os.IsNotExist(err) {
+		t.Error("the fifo should not reach the vault")
+	}
+	if !ManifestExists(vaultDir) {
+		t.Error("the manifest should be written")
+	}
+	if n := commitCount(t, vaultDir); n != 1 {
+		t.Errorf("commits = %d, want what succeeded committed", n)
+	}
+}
+
+func TestCopyStopsOnError(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	makeFailingHome(t, homeDir, vaultDir)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+			{Path: ".bashrc", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	if _, err := copier.Copy(); err == nil {
+		t.Fatal("Copy() should fail by default")
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".bashrc")); !os.IsNotExist(err) {
+		t.Error("the paths after the failure should not be copied")
+	}
+
+	// The daemon continues unless told otherwise
+	result, err := copier.CopyContext(WithTrigger(context.Background(), TriggerDaemon), nil)
+	if err != nil {
+		t.Fatalf("CopyContext() from the daemon error: %v", err)
+	}
+	if len(result.Errors) != 1 {
+		t.Errorf("Errors = %v, want one", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".bashrc")); err != nil {
+		t.Errorf(".bashrc should be copied by the daemon: %v", err)
+	}
+}
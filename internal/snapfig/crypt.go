@@ -0,0 +1,251 @@
+package snapfig
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adrianpk/snapfig/internal/config"
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptedExt marks vault files that hold an encrypted blob.
+const EncryptedExt = ".snapfig-enc"
+
+// PassphraseEnv is read for the vault passphrase when no keyfile is configured.
+const PassphraseEnv = "SNAPFIG_PASSPHRASE"
+
+var (
+	// ErrNoEncryptionKey is returned when an encrypted path is copied or
+	// restored without a keyfile or passphrase.
+	ErrNoEncryptionKey = errors.New("no encryption key: set encryption.keyfile or " + PassphraseEnv)
+
+	// ErrDecrypt is returned when a blob fails authentication,
+	// usually because the key is wrong.
+	ErrDecrypt = errors.New("failed to decrypt vault file: wrong key or corrupted data")
+)
+
+// Blob layout: magic | salt | nonce | AES-256-GCM ciphertext.
+var encMagic = []byte("SNAPFIG-ENC1\n")
+
+const (
+	encSaltSize = 16
+	keySize     = 32
+
+	// scrypt parameters, as recommended for interactive use
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// vaultCipher encrypts and decrypts vault blobs.
+// The secret is loaded on first use, so configs without encrypted paths
+// never need a key. Derived keys are cached per salt: one derivation
+// per run for writing, one per distinct salt for reading.
+type vaultCipher struct {
+	keyfile string
+
+	mu     sync.Mutex
+	secret []byte
+	salt   []byte // used for new blobs
+	aeads  map[string]cipher.AEAD
+}
+
+// newVaultCipher creates a cipher using the key source from config.
+func newVaultCipher(cfg *config.Config) *vaultCipher {
+	return &vaultCipher{
+		keyfile: cfg.Encryption.Keyfile,
+		aeads:   make(map[string]cipher.AEAD),
+	}
+}
+
+// loadSecret reads the keyfile or passphrase. Caller holds mu.
+func (v *vaultCipher) loadSecret() ([]byte, error) {
+	if v.secret != nil {
+		return v.secret, nil
+	}
+
+	if v.keyfile != "" {
+		path := v.keyfile
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyfile: %w", err)
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			return nil, fmt.Errorf("keyfile %s is empty", path)
+		}
+		v.secret = data
+		return v.secret, nil
+	}
+
+	if pass := os.Getenv(PassphraseEnv); pass != "" {
+		v.secret = []byte(pass)
+		return v.secret, nil
+	}
+
+	return nil, ErrNoEncryptionKey
+}
+
+// aead returns the cipher for salt, deriving the key if needed.
+func (v *vaultCipher) aead(salt []byte) (cipher.AEAD, error) {
+	if v == nil {
+		return nil, ErrNoEncryptionKey
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if a, ok := v.aeads[string(salt)]; ok {
+		return a, nil
+	}
+
+	secret, err := v.loadSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(secret, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	a, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	v.aeads[string(salt)] = a
+	return a, nil
+}
+
+// writeSalt returns the salt used for blobs written in this run.
+func (v *vaultCipher) writeSalt() ([]byte, error) {
+	if v == nil {
+		return nil, ErrNoEncryptionKey
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.salt == nil {
+		salt := make([]byte, encSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		v.salt = salt
+	}
+	return v.salt, nil
+}
+
+// encrypt seals plaintext into a self-describing blob.
+func (v *vaultCipher) encrypt(plaintext []byte) ([]byte, error) {
+	salt, err := v.writeSalt()
+	if err != nil {
+		return nil, err
+	}
+	a, err := v.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	blob := make([]byte, 0, len(encMagic)+len(salt)+len(nonce)+len(plaintext)+a.Overhead())
+	blob = append(blob, encMagic...)
+	blob = append(blob, salt...)
+	blob = append(blob, nonce...)
+	// The header is authenticated along with the content
+	return a.Seal(blob, nonce, plaintext, blob), nil
+}
+
+// decrypt opens a blob written by encrypt.
+func (v *vaultCipher) decrypt(blob []byte) ([]byte, error) {
+	if !bytes.HasPrefix(blob, encMagic) || len(blob) < len(encMagic)+encSaltSize {
+		return nil, fmt.Errorf("not an encrypted vault file")
+	}
+	salt := blob[len(encMagic) : len(encMagic)+encSaltSize]
+
+	a, err := v.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(encMagic) + encSaltSize + a.NonceSize()
+	if len(blob) < headerLen+a.Overhead() {
+		return nil, fmt.Errorf("not an encrypted vault file")
+	}
+	header := blob[:headerLen]
+	nonce := blob[len(encMagic)+encSaltSize : headerLen]
+
+	plaintext, err := a.Open(nil, nonce, blob[headerLen:], header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// decryptFile reads and decrypts the blob at path.
+func (v *vaultCipher) decryptFile(path string) ([]byte, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := v.decrypt(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return plaintext, nil
+}
+
+// readVaultFile returns the plaintext content of a vault file,
+// decrypting it if it is an encrypted blob.
+func readVaultFile(v *vaultCipher, path string) ([]byte, error) {
+	if strings.HasSuffix(path, EncryptedExt) {
+		return v.decryptFile(path)
+	}
+	return os.ReadFile(path)
+}
+
+// plainHash returns the plaintext hash of the blob at path. The index
+// records plaintext hashes for blobs, so the blob is only decrypted when
+// its stat data is unknown, e.g. right after a clone.
+func plainHash(idx *HashIndex, v *vaultCipher, path string, info os.FileInfo) (string, error) {
+	if hash, ok := idx.cached(path, info); ok {
+		return hash, nil
+	}
+
+	plaintext, err := v.decryptFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(plaintext)
+	hash := hex.EncodeToString(sum[:])
+	idx.Record(path, info, hash)
+	return hash, nil
+}
+
+// plainRel strips the encrypted suffix so vault paths show original names.
+func plainRel(rel string) string {
+	return strings.TrimSuffix(rel, EncryptedExt)
+}
@@ -0,0 +1,283 @@
+package snapfig
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestVaultCipherRoundTrip(t *testing.T) {
+	t.Setenv(PassphraseEnv, "correct horse battery staple")
+
+	v := newVaultCipher(&config.Config{})
+	plaintext := []byte("Host work\n  IdentityFile ~/.ssh/work\n")
+
+	blob, err := v.encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("encrypt() error: %v", err)
+	}
+	if bytes.Contains(blob, plaintext) {
+		t.Fatal("blob contains plaintext")
+	}
+
+	got, err := v.decrypt(blob)
+	if err != nil {
+		t.Fatalf("decrypt() error: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypt() = %q, want %q", got, plaintext)
+	}
+
+	// A fresh cipher derives the key from the salt in the blob
+	got, err = newVaultCipher(&config.Config{}).decrypt(blob)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypt() with new cipher = %q, %v", got, err)
+	}
+
+	tampered := append([]byte(nil), blob...)
+	tampered[len(tampered)-1] ^= 0xff
+	if _, err := v.decrypt(tampered); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("decrypt(tampered) error = %v, want ErrDecrypt", err)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong")
+	if _, err := newVaultCipher(&config.Config{}).decrypt(blob); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("decrypt() with wrong passphrase error = %v, want ErrDecrypt", err)
+	}
+
+	if _, err := v.decrypt([]byte("plain text")); err == nil {
+		t.Error("decrypt() should reject non-blob content")
+	}
+}
+
+func TestVaultCipherKeySources(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+
+	if _, err := newVaultCipher(&config.Config{}).encrypt([]byte("x")); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("encrypt() without key error = %v, want ErrNoEncryptionKey", err)
+	}
+
+	var nilCipher *vaultCipher
+	if _, err := nilCipher.encrypt([]byte("x")); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("nil cipher error = %v, want ErrNoEncryptionKey", err)
+	}
+
+	keyfile := filepath.Join(t.TempDir(), "vault.key")
+	os.WriteFile(keyfile, []byte("c2VjcmV0LWtleS1tYXRlcmlhbA==\n"), 0600)
+
+	cfg := &config.Config{Encryption: config.EncryptionConfig{Keyfile: keyfile}}
+	blob, err := newVaultCipher(cfg).encrypt([]byte("data"))
+	if err != nil {
+		t.Fatalf("encrypt() with keyfile error: %v", err)
+	}
+
+	// Keyfile takes precedence over the passphrase
+	t.Setenv(PassphraseEnv, "other")
+	if got, err := newVaultCipher(cfg).decrypt(blob); err != nil || string(got) != "data" {
+		t.Errorf("decrypt() with keyfile = %q, %v", got, err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.key")
+	os.WriteFile(empty, []byte("\n"), 0600)
+	cfg.Encryption.Keyfile = empty
+	if _, err := newVaultCipher(cfg).encrypt([]byte("x")); err == nil {
+		t.Error("encrypt() with empty keyfile should fail")
+	}
+}
+
+func TestCopyRestoreEncrypted(t *testing.T) {
+	setupTestGitConfig(t)
+	t.Setenv(PassphraseEnv, "test-passphrase")
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	sshConfig := []byte("Host prod\n  HostName 10.0.0.1\n")
+	kubeConfig := []byte("token: very-secret\n")
+	os.MkdirAll(filepath.Join(homeDir, ".ssh"), 0700)
+	os.MkdirAll(filepath.Join(homeDir, ".kube"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".ssh", "config"), sshConfig, 0600)
+	os.WriteFile(filepath.Join(homeDir, ".kube", "config"), kubeConfig, 0600)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".ssh", Enabled: true, Encrypt: true},
+			{Path: ".kube/config", Enabled: true, Encrypt: true},
+		},
+	}
+
+	copier := &Copier{
+		cfg:        cfg,
+		home:       homeDir,
+		vaultDir:   vaultDir,
+		snapfigDir: tmpDir,
+		index:      LoadHashIndex(filepath.Join(tmpDir, "index.json")),
+		cipher:     newVaultCipher(cfg),
+	}
+
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if result.FilesUpdated != 2 {
+		t.Errorf("FilesUpdated = %d, want 2", result.FilesUpdated)
+	}
+
+	for _, rel := range []string{".ssh/config", ".kube/config"} {
+		if _, err := os.Stat(filepath.Join(vaultDir, rel)); !os.IsNotExist(err) {
+			t.Errorf("plaintext %s should not be in vault", rel)
+		}
+		blob, err := os.ReadFile(filepath.Join(vaultDir, rel+EncryptedExt))
+		if err != nil {
+			t.Fatalf("encrypted %s missing: %v", rel, err)
+		}
+		if bytes.Contains(blob, []byte("prod")) || bytes.Contains(blob, []byte("very-secret")) {
+			t.Errorf("%s blob leaks plaintext", rel)
+		}
+	}
+
+	// Unchanged plaintext: nothing rewritten
+	blobPath := filepath.Join(vaultDir, ".ssh", "config"+EncryptedExt)
+	before, _ := os.ReadFile(blobPath)
+	result, err = copier.Copy()
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if result.FilesUpdated != 0 || result.FilesSkipped != 2 {
+		t.Errorf("second Copy() updated %d, skipped %d; want 0, 2", result.FilesUpdated, result.FilesSkipped)
+	}
+	after, _ := os.ReadFile(blobPath)
+	if !bytes.Equal(before, after) {
+		t.Error("unchanged file should keep its blob")
+	}
+
+	// Restore on a fresh machine: empty index, decrypts to compare
+	newHome := filepath.Join(tmpDir, "newhome")
+	restorer := &Restorer{
+		cfg:      cfg,
+		home:     newHome,
+		vaultDir: vaultDir,
+		index:    LoadHashIndex(filepath.Join(tmpDir, "other-index.json")),
+		cipher:   newVaultCipher(cfg),
+	}
+
+	entries, err := restorer.ListVaultEntries()
+	if err != nil {
+		t.Fatalf("ListVaultEntries() error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ListVaultEntries() returned %d entries, want 2", len(entries))
+	}
+	if len(entries[0].Children) != 1 || entries[0].Children[0] != filepath.Join(".ssh", "config") {
+		t.Errorf("Children = %v, want original names", entries[0].Children)
+	}
+	if entries[1].Path != ".kube/config" || entries[1].IsDir {
+		t.Errorf("entry = %+v, want single file .kube/config", entries[1])
+	}
+
+	if _, err := restorer.RestoreSelective([]string{filepath.Join(".ssh", "config")}); err != nil {
+		t.Fatalf("RestoreSelective() error: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(newHome, ".ssh", "config"))
+	if err != nil || !bytes.Equal(got, sshConfig) {
+		t.Errorf("selective restore = %q, %v", got, err)
+	}
+
+	result2, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if result2.FilesUpdated != 1 || result2.FilesSkipped != 1 {
+		t.Errorf("Restore() updated %d, skipped %d; want 1, 1", result2.FilesUpdated, result2.FilesSkipped)
+	}
+	got, err = os.ReadFile(filepath.Join(newHome, ".kube", "config"))
+	if err != nil || !bytes.Equal(got, kubeConfig) {
+		t.Errorf("restored .kube/config = %q, %v", got, err)
+	}
+	info, _ := os.Stat(filepath.Join(newHome, ".kube", "config"))
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("restored mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestCopyEncryptToggleReplacesPlaintext(t *testing.T) {
+	setupTestGitConfig(t)
+	t.Setenv(PassphraseEnv, "test-passphrase")
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	os.MkdirAll(filepath.Join(homeDir, ".gnupg"), 0700)
+	os.WriteFile(filepath.Join(homeDir, ".gnupg", "gpg.conf"), []byte("keyserver x"), 0600)
+	os.WriteFile(filepath.Join(homeDir, ".netrc"), []byte("machine x"), 0600)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".gnupg", Enabled: true},
+			{Path: ".netrc", Enabled: true},
+		},
+	}
+
+	copier := &Copier{
+		cfg:        cfg,
+		home:       homeDir,
+		vaultDir:   vaultDir,
+		snapfigDir: tmpDir,
+		cipher:     newVaultCipher(cfg),
+	}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("first Copy() error: %v", err)
+	}
+
+	cfg.Watching[0].Encrypt = true
+	cfg.Watching[1].Encrypt = true
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+
+	for _, rel := range []string{".gnupg/gpg.conf", ".netrc"} {
+		if _, err := os.Stat(filepath.Join(vaultDir, rel)); !os.IsNotExist(err) {
+			t.Errorf("plaintext %s should be removed once encrypted", rel)
+		}
+		if _, err := os.Stat(filepath.Join(vaultDir, rel+EncryptedExt)); err != nil {
+			t.Errorf("encrypted %s missing: %v", rel, err)
+		}
+	}
+}
+
+func TestCopyEncryptedWithoutKey(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	os.MkdirAll(homeDir, 0755)
+	os.WriteFile(filepath.Join(homeDir, ".netrc"), []byte("machine x"), 0600)
+
+	cfg := &config.Config{
+		Git:      config.GitModeDisable,
+		Watching: []config.Watched{{Path: ".netrc", Enabled: true, Encrypt: true}},
+	}
+
+	copier := &Copier{
+		cfg:        cfg,
+		home:       homeDir,
+		vaultDir:   filepath.Join(tmpDir, "vault"),
+		snapfigDir: tmpDir,
+		cipher:     newVaultCipher(cfg),
+	}
+
+	if _, err := copier.Copy(); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("Copy() error = %v, want ErrNoEncryptionKey", err)
+	}
+}
@@ -0,0 +1,158 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrianpk/snapfig/internal/config"
+	"github.com/adrianpk/snapfig/internal/paths"
+)
+
+// pathFilter decides which entries below a watched path are backed up.
+// Patterns are matched against paths relative to the watched root.
+// A nil *pathFilter lets everything through.
+type pathFilter struct {
+	include []string
+	exclude []string
+}
+
+// newPathFilter builds the filter for a watched path from the global
+// and per-path include/exclude lists.
+func newPathFilter(cfg *config.Config, w config.Watched) *pathFilter {
+	include := w.EffectiveInclude(cfg.Include)
+	exclude := w.EffectiveExclude(cfg.Exclude)
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	return &pathFilter{include: include, exclude: exclude}
+}
+
+// skip reports whether rel should be left out of the backup.
+// Directories are only skipped when excluded, so includes can still
+// match files further down.
+func (f *pathFilter) skip(rel string, isDir bool) bool {
+	if f == nil || rel == "" {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, p := range f.exclude {
+		if paths.MatchOrParent(p, rel) {
+			return true
+		}
+	}
+
+	if isDir || len(f.include) == 0 {
+		return false
+	}
+
+	for _, p := range f.include {
+		if paths.MatchOrParent(p, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkSpec carries the settings of one watched path down a tree walk.
+type walkSpec struct {
+	gitMode  config.GitMode
+	encrypt  bool
+	template bool
+	symlinks config.SymlinkPolicy
+	filter   *pathFilter
+	ignores  *ignoreSet
+	shadows  []string // higher-priority layers of the same path, on restore
+
+	// Directories being walked, by real path, to catch followed
+	// symlinks that lead back up the tree
+	ancestors map[string]bool
+}
+
+// newWalkSpec resolves the effective settings for a watched path.
+// root is the tree being walked: the source for copy, the vault for
+// restore. Its .snapfigignore files are honored along the way.
+func newWalkSpec(cfg *config.Config, w config.Watched, root string) *walkSpec {
+	return &walkSpec{
+		gitMode:  w.EffectiveGitMode(cfg.Git),
+		encrypt:  w.Encrypt,
+		template: w.Template,
+		symlinks: w.EffectiveSymlinks(),
+		filter:   newPathFilter(cfg, w),
+		ignores:  newIgnoreSet(root),
+
+		ancestors: make(map[string]bool),
+	}
+}
+
+// skip reports whether rel is left out by config patterns or ignore files.
+func (s *walkSpec) skip(rel string, isDir bool) bool {
+	return s.filter.skip(rel, isDir) || s.ignores.ignored(rel, isDir)
+}
+
+// vaultSuffix returns the suffix a regular file named name gets in the vault.
+// Ignore files get none: restore reads their rules from the vault.
+func (s *walkSpec) vaultSuffix(name string) string {
+	if name == ignoreFilename {
+		return ""
+	}
+	var suffix string
+	if s.template && !strings.HasSuffix(name, templateExt) {
+		suffix = templateExt
+	}
+	if s.encrypt {
+		suffix += EncryptedExt
+	}
+	return suffix
+}
+
+// displayRel maps a vault-relative file path to the name shown and
+// selected for restore: the original name, without storage suffixes.
+// Template markers stay visible unless the whole path is templated.
+func (s *walkSpec) displayRel(rel string) string {
+	rel = plainRel(rel)
+	if s.template {
+		rel = strings.TrimSuffix(rel, templateExt)
+	}
+	return rel
+}
+
+// srcRel maps a vault-relative path to its name in the source tree,
+// for matching filters.
+func (s *walkSpec) srcRel(rel string) string {
+	rel = sourceRel(rel)
+	if s.template {
+		rel = strings.TrimSuffix(rel, templateExt)
+	}
+	return rel
+}
+
+// shadowed reports whether a file at rel is overridden by a
+// higher-priority layer, in either its plain or encrypted form.
+func (s *walkSpec) shadowed(rel string) bool {
+	plain := plainRel(rel)
+	for _, root := range s.shadows {
+		for _, name := range []string{plain, plain + EncryptedExt} {
+			if info, err := os.Lstat(filepath.Join(root, name)); err == nil && !info.IsDir() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sourceRel maps a vault-relative path back to the name it has in the
+// source tree, so filters written against source names apply in the vault.
+func sourceRel(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, p := range parts {
+		if p == ".git_disabled" {
+			parts[i] = ".git"
+		}
+	}
+	last := len(parts) - 1
+	parts[last] = strings.TrimSuffix(parts[last], symlinkMarkerExt)
+	parts[last] = strings.TrimSuffix(parts[last], EncryptedExt)
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,226 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestNewPathFilter(t *testing.T) {
+	cfg := &config.Config{}
+	if f := newPathFilter(cfg, config.Watched{Path: ".zshrc"}); f != nil {
+		t.Error("newPathFilter() should be nil without patterns")
+	}
+
+	cfg.Exclude = []string{"*.swp"}
+	f := newPathFilter(cfg, config.Watched{Path: ".config/nvim", Exclude: []string{"lazy-lock.json"}})
+	if f == nil {
+		t.Fatal("newPathFilter() = nil, want filter")
+	}
+	if len(f.exclude) != 2 {
+		t.Errorf("exclude = %v, want global and per-path patterns", f.exclude)
+	}
+}
+
+func TestPathFilterSkip(t *testing.T) {
+	f := &pathFilter{
+		include: []string{"User/**", "*.json"},
+		exclude: []string{"**/node_modules", "User/workspaceStorage", "*.swp"},
+	}
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"User/settings.json", false, false},
+		{"User/keybindings.json", false, false},
+		{"User/snippets/go.json", false, false},
+		{"User/workspaceStorage", true, true},
+		{"User/workspaceStorage/abc/state.vscdb", false, true},
+		{"extensions/foo/node_modules", true, true},
+		{"Cache", true, false}, // dirs are traversed for includes
+		{"Cache/data_0", false, true},
+		{"argv.json", false, false},
+		{"User/.settings.json.swp", false, true},
+		{"", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := f.skip(tt.rel, tt.isDir); got != tt.want {
+				t.Errorf("skip(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+			}
+		})
+	}
+
+	var nilFilter *pathFilter
+	if nilFilter.skip("anything", false) {
+		t.Error("nil filter should not skip")
+	}
+}
+
+func TestSourceRel(t *testing.T) {
+	tests := map[string]string{
+		"init.lua":                               "init.lua",
+		"pack/foo/.git_disabled/HEAD":            "pack/foo/.git/HEAD",
+		"lua/link" + symlinkMarkerExt:            "lua/link",
+		"a/.git_disabled":                        "a/.git",
+		filepath.Join("x", "y"+symlinkMarkerExt): "x/y",
+	}
+	for in, want := range tests {
+		if got := sourceRel(in); got != want {
+			t.Errorf("sourceRel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCopyHonorsIncludeExclude(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	srcDir := filepath.Join(homeDir, ".config", "nvim")
+	os.MkdirAll(filepath.Join(srcDir, "lua", "plugins"), 0755)
+	os.MkdirAll(filepath.Join(srcDir, "node_modules", "pkg"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "init.lua"), []byte("init"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "lazy-lock.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "lua", "plugins", "a.lua"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "lua", "plugins", ".a.lua.swp"), []byte("swap"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "node_modules", "pkg", "index.js"), []byte("js"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Exclude:   []string{"*.swp"},
+		Watching: []config.Watched{
+			{
+				Path:    ".config/nvim",
+				Enabled: true,
+				Exclude: []string{"lazy-lock.json", "**/node_modules"},
+			},
+		},
+	}
+
+	copier := &Copier{
+		cfg:        cfg,
+		home:       homeDir,
+		vaultDir:   vaultDir,
+		snapfigDir: filepath.Dir(vaultDir),
+	}
+
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if result.FilesUpdated != 2 {
+		t.Errorf("Copy() updated %d files, want 2", result.FilesUpdated)
+	}
+
+	dst := filepath.Join(vaultDir, ".config", "nvim")
+	for _, rel := range []string{"init.lua", "lua/plugins/a.lua"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("expected %s in vault: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"lazy-lock.json", "lua/plugins/.a.lua.swp", "node_modules"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("excluded %s should not be in vault", rel)
+		}
+	}
+}
+
+func TestCopyRemovesNewlyExcludedFiles(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	srcDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(srcDir, 0755)
+	os.WriteFile(filepath.Join(srcDir, "config"), []byte("cfg"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "cache.db"), []byte("cache"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+		},
+	}
+
+	copier := &Copier{
+		cfg:        cfg,
+		home:       homeDir,
+		vaultDir:   vaultDir,
+		snapfigDir: filepath.Dir(vaultDir),
+	}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("first Copy() error: %v", err)
+	}
+
+	cfg.Watching[0].Exclude = []string{"*.db"}
+
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if result.FilesRemoved != 1 {
+		t.Errorf("Copy() removed %d files, want 1", result.FilesRemoved)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "app", "cache.db")); !os.IsNotExist(err) {
+		t.Error("newly excluded file should be removed from vault")
+	}
+}
+
+func TestRestoreAndListHonorExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	vaultApp := filepath.Join(vaultDir, ".config", "app")
+	os.MkdirAll(filepath.Join(vaultApp, "Cache"), 0755)
+	os.WriteFile(filepath.Join(vaultApp, "settings.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(vaultApp, "Cache", "blob"), []byte("x"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true, Exclude: []string{"Cache"}},
+		},
+	}
+
+	restorer := &Restorer{
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
+	}
+
+	entries, err := restorer.ListVaultEntries()
+	if err != nil {
+		t.Fatalf("ListVaultEntries() error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("ListVaultEntries() returned %d entries, want 1", len(entries))
+	}
+	if len(entries[0].Children) != 1 || entries[0].Children[0] != ".config/app/settings.json" {
+		t.Errorf("Children = %v, want only settings.json", entries[0].Children)
+	}
+
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".config", "app", "settings.json")); err != nil {
+		t.Errorf("settings.json not restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".config", "app", "Cache")); !os.IsNotExist(err) {
+		t.Error("excluded Cache should not be restored")
+	}
+}
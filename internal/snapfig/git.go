@@ -2,6 +2,8 @@
 package snapfig
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -62,22 +64,51 @@ func InitVaultRepo(vaultDir string) error {
 
 // CommitVault commits all changes in the vault with the given message.
 func CommitVault(vaultDir, message string) error {
-	// Add all
+	changes, err := stageChanges(vaultDir)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	return commitStaged(vaultDir, message)
+}
+
+// vaultChange is a file added, modified or removed in the next commit.
+type vaultChange struct {
+	Status byte   // 'A', 'M' or 'D'
+	Path   string // relative to the vault, slash separated
+}
+
+// stageChanges stages every change in the vault and returns them,
+// none when there is nothing to commit.
+func stageChanges(vaultDir string) ([]vaultChange, error) {
 	addCmd := exec.Command("git", "add", "-A")
 	addCmd.Dir = vaultDir
 	if err := addCmd.Run(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Check if there are changes to commit
-	diffCmd := exec.Command("git", "diff", "--cached", "--quiet")
+	// Renames are listed as a removal and an addition
+	diffCmd := exec.Command("git", "diff", "--cached", "--name-status", "--no-renames", "-z")
 	diffCmd.Dir = vaultDir
-	if err := diffCmd.Run(); err == nil {
-		// No changes to commit
-		return nil
+	out, err := diffCmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []vaultChange
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status := fields[i][0]
+		if status != 'A' && status != 'D' {
+			// Type changes count as modifications
+			status = 'M'
+		}
+		changes = append(changes, vaultChange{Status: status, Path: fields[i+1]})
 	}
+	return changes, nil
+}
 
-	// Commit
+// commitStaged commits what is staged in the vault.
+func commitStaged(vaultDir, message string) error {
 	commitCmd := exec.Command("git", "commit", "-m", message)
 	commitCmd.Dir = vaultDir
 	return commitCmd.Run()
@@ -103,6 +134,12 @@ func PushVault(vaultDir string) error {
 // PushVaultWithToken pushes the vault to the configured remote using token auth if provided.
 // If token is empty, uses the configured remote URL directly (SSH or other).
 func PushVaultWithToken(vaultDir, token string) error {
+	return pushVault(context.Background(), vaultDir, token)
+}
+
+// pushVault does the work of PushVaultWithToken. Cancelling ctx kills
+// git: the remote updates its refs all at once, so nothing is half pushed.
+func pushVault(ctx context.Context, vaultDir, token string) error {
 	hasRemote, remoteURL, err := HasRemote(vaultDir)
 	if err != nil {
 		return err
@@ -127,12 +164,15 @@ func PushVaultWithToken(vaultDir, token string) error {
 	var pushCmd *exec.Cmd
 	if token != "" {
 		authURL := urlWithToken(remoteURL, token)
-		pushCmd = exec.Command("git", "push", "-u", authURL, branch)
+		pushCmd = exec.CommandContext(ctx, "git", "push", "-u", authURL, branch)
 	} else {
-		pushCmd = exec.Command("git", "push", "-u", "origin", branch)
+		pushCmd = exec.CommandContext(ctx, "git", "push", "-u", "origin", branch)
 	}
 	pushCmd.Dir = vaultDir
 	if output, err := pushCmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("push cancelled: %w", ctx.Err())
+		}
 		return fmt.Errorf("push failed: %s", strings.TrimSpace(string(output)))
 	}
 
@@ -141,7 +181,8 @@ func PushVaultWithToken(vaultDir, token string) error {
 
 // PullResult contains the result of a pull operation.
 type PullResult struct {
-	Cloned bool
+	Cloned     bool
+	HookErrors []HookError // pre_pull and post_pull hooks that failed
 }
 
 // PullVault pulls from the configured remote.
@@ -158,6 +199,13 @@ func PullVaultWithRemote(vaultDir, remoteURL string) (*PullResult, error) {
 // PullVaultWithToken pulls from remote using token auth if provided.
 // If token is empty, uses SSH or configured credentials.
 func PullVaultWithToken(vaultDir, remoteURL, token string) (*PullResult, error) {
+	return pullVault(context.Background(), vaultDir, remoteURL, token, nil)
+}
+
+// pullVault does the work of PullVaultWithToken. Cancelling ctx stops
+// the network part: a cancelled clone is removed, and a pull is only
+// cancelled while fetching, as the merge into the vault is never cut short.
+func pullVault(ctx context.Context, vaultDir, remoteURL, token string, progress *progressReporter) (*PullResult, error) {
 	result := &PullResult{}
 
 	// Check if vault exists
@@ -178,11 +226,20 @@ func PullVaultWithToken(vaultDir, remoteURL, token string) (*PullResult, error)
 		if err := os.MkdirAll(snapfigDir, 0755); err != nil {
 			return nil, fmt.Errorf("failed to create directory: %w", err)
 		}
+		_, statErr := os.Stat(vaultDir)
 
 		// Clone - use token-embedded URL if token provided
+		progress.phase(PhaseCloning)
 		cloneURL := urlWithToken(remoteURL, token)
-		cloneCmd := exec.Command("git", "clone", cloneURL, vaultDir)
+		cloneCmd := exec.CommandContext(ctx, "git", "clone", cloneURL, vaultDir)
 		if output, err := cloneCmd.CombinedOutput(); err != nil {
+			if ctx.Err() != nil {
+				// Drop what the clone wrote, but never a directory it found
+				if errors.Is(statErr, os.ErrNotExist) {
+					os.RemoveAll(vaultDir)
+				}
+				return nil, fmt.Errorf("clone cancelled: %w", ctx.Err())
+			}
 			return nil, fmt.Errorf("clone failed: %s", strings.TrimSpace(string(output)))
 		}
 
@@ -199,16 +256,25 @@ func PullVaultWithToken(vaultDir, remoteURL, token string) (*PullResult, error)
 		return nil, fmt.Errorf("no remote configured")
 	}
 
-	// Pull - use token-embedded URL if token provided
-	var pullCmd *exec.Cmd
+	// Fetch, then merge: use token-embedded URL if token provided
+	progress.phase(PhasePulling)
+	fetchArgs := []string{"fetch"}
+	mergeArgs := []string{"merge"}
 	if token != "" {
-		authURL := urlWithToken(currentRemoteURL, token)
-		pullCmd = exec.Command("git", "pull", authURL)
-	} else {
-		pullCmd = exec.Command("git", "pull")
+		fetchArgs = append(fetchArgs, urlWithToken(currentRemoteURL, token))
+		mergeArgs = append(mergeArgs, "FETCH_HEAD")
+	}
+	fetchCmd := exec.CommandContext(ctx, "git", fetchArgs...)
+	fetchCmd.Dir = vaultDir
+	if output, err := fetchCmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("pull cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("pull failed: %s", strings.TrimSpace(string(output)))
 	}
-	pullCmd.Dir = vaultDir
-	if output, err := pullCmd.CombinedOutput(); err != nil {
+	mergeCmd := exec.Command("git", mergeArgs...)
+	mergeCmd.Dir = vaultDir
+	if output, err := mergeCmd.CombinedOutput(); err != nil {
 		return nil, fmt.Errorf("pull failed: %s", strings.TrimSpace(string(output)))
 	}
 
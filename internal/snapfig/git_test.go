@@ -1,6 +1,8 @@
 package snapfig
 
 import (
+	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -621,3 +623,64 @@ func TestUrlWithTokenParseError(t *testing.T) {
 		t.Errorf("urlWithToken() should return original URL on parse error, got %q", result)
 	}
 }
+
+func TestPullVaultMergesRemoteChanges(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+
+	bareDir := filepath.Join(tmpDir, "remote.git")
+	exec.Command("git", "init", "--bare", "-b", "main", bareDir).Run()
+
+	vaultDir := filepath.Join(tmpDir, "vault")
+	InitVaultRepo(vaultDir)
+	os.WriteFile(filepath.Join(vaultDir, "test.txt"), []byte("v1"), 0644)
+	CommitVault(vaultDir, "initial")
+	SetRemote(vaultDir, bareDir)
+	if err := PushVault(vaultDir); err != nil {
+		t.Fatalf("PushVault() error: %v", err)
+	}
+
+	// Another machine pushes a change
+	otherDir := filepath.Join(tmpDir, "other")
+	exec.Command("git", "clone", bareDir, otherDir).Run()
+	os.WriteFile(filepath.Join(otherDir, "test.txt"), []byte("v2"), 0644)
+	CommitVault(otherDir, "update")
+	if err := PushVault(otherDir); err != nil {
+		t.Fatalf("PushVault() error: %v", err)
+	}
+
+	var phases []string
+	progress := newProgress(func(p Progress) { phases = append(phases, p.Phase) }, "pull")
+	if _, err := pullVault(context.Background(), vaultDir, bareDir, "", progress); err != nil {
+		t.Fatalf("pullVault() error: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(vaultDir, "test.txt"))
+	if string(data) != "v2" {
+		t.Errorf("pulled content = %q, want %q", data, "v2")
+	}
+	if len(phases) != 1 || phases[0] != PhasePulling {
+		t.Errorf("phases = %v, want [%s]", phases, PhasePulling)
+	}
+}
+
+func TestPullVaultCancelledClone(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+
+	sourceDir := filepath.Join(tmpDir, "source")
+	InitVaultRepo(sourceDir)
+	os.WriteFile(filepath.Join(sourceDir, "test.txt"), []byte("hello"), 0644)
+	CommitVault(sourceDir, "initial")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vaultDir := filepath.Join(tmpDir, "vault")
+	_, err := pullVault(ctx, vaultDir, sourceDir, "", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("pullVault() error = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(vaultDir); !os.IsNotExist(err) {
+		t.Error("a cancelled clone should leave no vault behind")
+	}
+}
@@ -0,0 +1,173 @@
+package snapfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// ErrHookFailed matches every HookError with errors.Is.
+var ErrHookFailed = errors.New("hook failed")
+
+// hookOutputLimit caps the output kept from a failed hook.
+const hookOutputLimit = 4096
+
+// hookWaitDelay bounds the wait for a hook's output once it was killed.
+const hookWaitDelay = time.Second
+
+// HookError records a hook that failed or timed out. Hooks never stop
+// the operation they run around: their failures are reported with its result.
+type HookError struct {
+	Hook    string // e.g. "pre_copy"
+	Path    string // watched path of a per-path hook, empty for a global one
+	Command string
+	Output  string // combined output, truncated
+	Err     error
+}
+
+func (e *HookError) Error() string {
+	name := e.Hook
+	if e.Path != "" {
+		name = e.Path + " " + e.Hook
+	}
+	msg := fmt.Sprintf("%s hook %q: %v", name, e.Command, e.Err)
+	if e.Output != "" {
+		msg += ": " + e.Output
+	}
+	return msg
+}
+
+func (e *HookError) Unwrap() error {
+	return ErrHookFailed
+}
+
+// hookEnv describes the operation a hook runs around.
+type hookEnv struct {
+	operation string // copy, restore, push or pull
+	phase     string // pre or post
+	vaultDir  string
+	host      string
+	path      string   // watched path of a per-path hook
+	changed   []string // watched paths with changes, post hooks only
+}
+
+// vars returns the environment variables passed to the hook.
+func (e hookEnv) vars() []string {
+	return []string{
+		"SNAPFIG_OPERATION=" + e.operation,
+		"SNAPFIG_PHASE=" + e.phase,
+		"SNAPFIG_VAULT=" + e.vaultDir,
+		"SNAPFIG_HOST=" + e.host,
+		"SNAPFIG_PATH=" + e.path,
+		"SNAPFIG_CHANGED=" + strings.Join(e.changed, "\n"),
+	}
+}
+
+// hookRunner runs the configured hooks with the shell.
+// A nil *hookRunner runs nothing.
+type hookRunner struct {
+	home    string
+	timeout time.Duration
+}
+
+func newHookRunner(cfg *config.Config, home string) *hookRunner {
+	return &hookRunner{home: home, timeout: cfg.Hooks.EffectiveTimeout()}
+}
+
+// run executes command, if any, from the home directory.
+// It returns nil on success and the failure otherwise. Nothing runs
+// once ctx is done: the operation was cancelled, the hook did not fail.
+func (h *hookRunner) run(ctx context.Context, hook, command string, env hookEnv) *HookError {
+	if h == nil || strings.TrimSpace(command) == "" || ctx.Err() != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = h.home
+	cmd.Env = append(os.Environ(), env.vars()...)
+	// Do not wait on children left holding the output open
+	cmd.WaitDelay = hookWaitDelay
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", h.timeout)
+	}
+
+	output := strings.TrimSpace(string(out))
+	if len(output) > hookOutputLimit {
+		output = output[:hookOutputLimit] + "..."
+	}
+	return &HookError{Hook: hook, Path: env.path, Command: command, Output: output, Err: err}
+}
+
+// PushWithHooks pushes the vault between the pre_push and post_push hooks.
+// A failed push is returned as is; otherwise failed hooks are returned
+// joined, matching ErrHookFailed. Cancelling ctx stops the push.
+func PushWithHooks(ctx context.Context, cfg *config.Config, vaultDir string, progress ProgressFunc) error {
+	hooks, env, err := operationHooks(cfg, vaultDir, "push")
+	if err != nil {
+		return err
+	}
+
+	var failed []error
+	if herr := hooks.run(ctx, "pre_push", cfg.Hooks.PrePush, env); herr != nil {
+		failed = append(failed, herr)
+	}
+	newProgress(progress, "push").phase(PhasePushing)
+	if err := pushVault(ctx, vaultDir, cfg.GitToken); err != nil {
+		return err
+	}
+	env.phase = "post"
+	if herr := hooks.run(ctx, "post_push", cfg.Hooks.PostPush, env); herr != nil {
+		failed = append(failed, herr)
+	}
+	return errors.Join(failed...)
+}
+
+// PullWithHooks pulls the vault between the pre_pull and post_pull hooks.
+// Failed hooks are reported in the result. Cancelling ctx stops the pull,
+// see pullVault.
+func PullWithHooks(ctx context.Context, cfg *config.Config, vaultDir string, progress ProgressFunc) (*PullResult, error) {
+	hooks, env, err := operationHooks(cfg, vaultDir, "pull")
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []HookError
+	if herr := hooks.run(ctx, "pre_pull", cfg.Hooks.PrePull, env); herr != nil {
+		failed = append(failed, *herr)
+	}
+	result, err := pullVault(ctx, vaultDir, cfg.Remote, cfg.GitToken, newProgress(progress, "pull"))
+	if err != nil {
+		return nil, err
+	}
+	env.phase = "post"
+	if herr := hooks.run(ctx, "post_pull", cfg.Hooks.PostPull, env); herr != nil {
+		failed = append(failed, *herr)
+	}
+	result.HookErrors = failed
+	return result, nil
+}
+
+// operationHooks returns the runner and pre-phase environment for a
+// push or pull.
+func operationHooks(cfg *config.Config, vaultDir, operation string) (*hookRunner, hookEnv, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, hookEnv{}, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	host, _ := cfg.Host()
+	env := hookEnv{operation: operation, phase: "pre", vaultDir: vaultDir, host: host}
+	return newHookRunner(cfg, home), env, nil
+}
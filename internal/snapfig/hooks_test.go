@@ -0,0 +1,174 @@
+package snapfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestHookRunnerEnv(t *testing.T) {
+	home := t.TempDir()
+	hooks := &hookRunner{home: home, timeout: time.Minute}
+	env := hookEnv{operation: "copy", phase: "post", vaultDir: "/vault", host: "laptop", changed: []string{".bashrc", ".config/nvim"}}
+
+	herr := hooks.run(context.Background(), "post_copy", `echo "$SNAPFIG_OPERATION $SNAPFIG_PHASE $SNAPFIG_VAULT $SNAPFIG_HOST" > env.txt; echo "$SNAPFIG_CHANGED" >> env.txt`, env)
+	if herr != nil {
+		t.Fatalf("run() error: %v", herr)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, "env.txt"))
+	if err != nil {
+		t.Fatalf("hook should run from home: %v", err)
+	}
+	want := "copy post /vault laptop\n.bashrc\n.config/nvim\n"
+	if string(data) != want {
+		t.Errorf("hook env = %q, want %q", data, want)
+	}
+}
+
+func TestHookRunnerFailure(t *testing.T) {
+	hooks := &hookRunner{home: t.TempDir(), timeout: time.Minute}
+
+	herr := hooks.run(context.Background(), "pre_push", "echo boom; exit 3", hookEnv{operation: "push", phase: "pre"})
+	if herr == nil {
+		t.Fatal("run() should report a failing hook")
+	}
+	if !errors.Is(herr, ErrHookFailed) {
+		t.Errorf("error %v should match ErrHookFailed", herr)
+	}
+	if herr.Hook != "pre_push" || herr.Output != "boom" {
+		t.Errorf("HookError = %+v", herr)
+	}
+}
+
+func TestHookRunnerTimeout(t *testing.T) {
+	hooks := &hookRunner{home: t.TempDir(), timeout: 100 * time.Millisecond}
+
+	herr := hooks.run(context.Background(), "pre_copy", "sleep 5", hookEnv{})
+	if herr == nil {
+		t.Fatal("run() should report a hook that times out")
+	}
+	if !strings.Contains(herr.Error(), "timed out") {
+		t.Errorf("error = %v, want a timeout", herr)
+	}
+}
+
+func TestHookRunnerNothingToRun(t *testing.T) {
+	var hooks *hookRunner
+	if herr := hooks.run(context.Background(), "pre_copy", "exit 1", hookEnv{}); herr != nil {
+		t.Errorf("a nil runner should run nothing, got %v", herr)
+	}
+
+	hooks = &hookRunner{home: t.TempDir(), timeout: time.Minute}
+	if herr := hooks.run(context.Background(), "pre_copy", "  ", hookEnv{}); herr != nil {
+		t.Errorf("an empty command should run nothing, got %v", herr)
+	}
+}
+
+func TestCopyRunsHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(homeDir, 0755)
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bash"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Hooks: config.HooksConfig{
+			PostCopy: `echo "$SNAPFIG_CHANGED" >> post.log`,
+		},
+		Watching: []config.Watched{
+			{Path: ".bashrc", Enabled: true},
+			{
+				Path:    "packages.txt",
+				Enabled: true,
+				Hooks: config.PathHooks{
+					// Export state right before the path is copied
+					PreCopy:  "echo pkgs > packages.txt",
+					PostCopy: `echo "$SNAPFIG_PATH" >> path.log`,
+				},
+			},
+			{Path: ".profile", Enabled: true, Hooks: config.PathHooks{PreCopy: "exit 1"}},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), hooks: newHookRunner(cfg, homeDir)}
+
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(vaultDir, "packages.txt"))
+	if err != nil || string(data) != "pkgs\n" {
+		t.Errorf("a file written by pre_copy should be copied, got %q, %v", data, err)
+	}
+	if len(result.HookErrors) != 1 || result.HookErrors[0].Path != ".profile" {
+		t.Errorf("HookErrors = %+v, want the failing .profile hook", result.HookErrors)
+	}
+
+	// Nothing changed on the second copy: only the global hook runs
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	postLog, _ := os.ReadFile(filepath.Join(homeDir, "post.log"))
+	if string(postLog) != ".bashrc\npackages.txt\n\n" {
+		t.Errorf("post.log = %q", postLog)
+	}
+	pathLog, _ := os.ReadFile(filepath.Join(homeDir, "path.log"))
+	if string(pathLog) != "packages.txt\n" {
+		t.Errorf("per-path post_copy should only run when the path changed, path.log = %q", pathLog)
+	}
+}
+
+func TestRestoreRunsHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(homeDir, 0755)
+	os.MkdirAll(filepath.Join(vaultDir, ".config", "nvim"), 0755)
+	os.WriteFile(filepath.Join(vaultDir, ".config", "nvim", "init.lua"), []byte("-- init"), 0644)
+	os.WriteFile(filepath.Join(vaultDir, ".bashrc"), []byte("bash"), 0644)
+
+	cfg := &config.Config{
+		VaultPath: vaultDir,
+		Hooks: config.HooksConfig{
+			PreRestore:  "exit 2",
+			PostRestore: `echo "$SNAPFIG_CHANGED" >> post.log`,
+		},
+		Watching: []config.Watched{
+			{Path: ".config/nvim", Enabled: true, Hooks: config.PathHooks{PostRestore: `echo "$SNAPFIG_PATH" >> path.log`}},
+			{Path: ".bashrc", Enabled: true},
+		},
+	}
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), hooks: newHookRunner(cfg, homeDir)}
+
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result.HookErrors) != 1 || result.HookErrors[0].Hook != "pre_restore" {
+		t.Errorf("HookErrors = %+v, want the failing pre_restore", result.HookErrors)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".bashrc")); err != nil {
+		t.Errorf("a failing hook should not stop the restore: %v", err)
+	}
+
+	if _, err := restorer.RestoreSelective([]string{".bashrc"}); err != nil {
+		t.Fatalf("RestoreSelective() error: %v", err)
+	}
+	postLog, _ := os.ReadFile(filepath.Join(homeDir, "post.log"))
+	if string(postLog) != ".config/nvim\n.bashrc\n\n" {
+		t.Errorf("post.log = %q", postLog)
+	}
+	pathLog, _ := os.ReadFile(filepath.Join(homeDir, "path.log"))
+	if string(pathLog) != ".config/nvim\n" {
+		t.Errorf("path.log = %q", pathLog)
+	}
+}
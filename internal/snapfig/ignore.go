@@ -0,0 +1,141 @@
+package snapfig
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adrianpk/snapfig/internal/paths"
+)
+
+// ignoreFilename is the per-directory ignore file honored inside watched trees.
+const ignoreFilename = ".snapfigignore"
+
+// ignoreRule is a single line of an ignore file.
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// match reports whether the rule applies to rel, a path relative to
+// the directory holding the ignore file.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return paths.Match(r.pattern, rel)
+}
+
+// parseIgnore parses ignore file content using gitignore syntax:
+// comments, "!" negation, trailing "/" for directories only, leading
+// "/" or an inner "/" to anchor, and "**" for any depth.
+func parseIgnore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		switch {
+		case strings.HasPrefix(line, "!"):
+			rule.negate = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// An inner slash anchors the pattern just like a leading one
+		if strings.Contains(line, "/") && !strings.HasPrefix(line, "/") {
+			line = "/" + line
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// ignoreSet lazily loads the ignore files of one watched tree.
+// Directories are keyed by their slash-separated path relative to root.
+type ignoreSet struct {
+	root  string
+	mu    sync.Mutex
+	files map[string][]ignoreRule
+}
+
+func newIgnoreSet(root string) *ignoreSet {
+	return &ignoreSet{
+		root:  root,
+		files: make(map[string][]ignoreRule),
+	}
+}
+
+// rules returns the rules of the ignore file in dir, if any.
+func (s *ignoreSet) rules(dir string) []ignoreRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rules, ok := s.files[dir]; ok {
+		return rules
+	}
+
+	var rules []ignoreRule
+	data, err := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(dir), ignoreFilename))
+	if err == nil {
+		rules = parseIgnore(data)
+	}
+	s.files[dir] = rules
+	return rules
+}
+
+// ignored reports whether rel is ignored by the ignore files on its way
+// from the root. As with git, deeper files take precedence and within a
+// file the last matching rule wins.
+func (s *ignoreSet) ignored(rel string, isDir bool) bool {
+	if s == nil || rel == "" {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	dir := path.Dir(rel)
+	for {
+		if dir == "." {
+			dir = ""
+		}
+
+		sub := rel
+		if dir != "" {
+			sub = strings.TrimPrefix(rel, dir+"/")
+		}
+
+		rules := s.rules(dir)
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].match(sub, isDir) {
+				return !rules[i].negate
+			}
+		}
+
+		if dir == "" {
+			return false
+		}
+		dir = path.Dir(dir)
+	}
+}
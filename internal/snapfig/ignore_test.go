@@ -0,0 +1,232 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestParseIgnore(t *testing.T) {
+	content := `# comment
+
+*.log
+!keep.log
+cache/
+/plugin/packer_compiled.lua
+doc/*.txt
+\#literal
+trailing
+`
+	rules := parseIgnore([]byte(content))
+
+	want := []ignoreRule{
+		{pattern: "*.log"},
+		{pattern: "keep.log", negate: true},
+		{pattern: "cache", dirOnly: true},
+		{pattern: "/plugin/packer_compiled.lua"},
+		{pattern: "/doc/*.txt"},
+		{pattern: "#literal"},
+		{pattern: "trailing"},
+	}
+
+	if len(rules) != len(want) {
+		t.Fatalf("parseIgnore() returned %d rules, want %d: %+v", len(rules), len(want), rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+}
+
+func TestIgnoreSetIgnored(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "lua", "plugins"), 0755)
+	os.WriteFile(filepath.Join(root, ignoreFilename), []byte("*.log\n!keep.log\ncache/\n/plugin/\n"), 0644)
+	os.WriteFile(filepath.Join(root, "lua", ignoreFilename), []byte("*.bak\n!debug.log\n"), 0644)
+
+	s := newIgnoreSet(root)
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"init.lua", false, false},
+		{"error.log", false, true},
+		{"keep.log", false, false},
+		{"cache", true, true},
+		{"cache", false, false}, // dir-only rule
+		{"lua/cache", true, true},
+		{"plugin", true, true},
+		{"lua/plugin", true, false}, // anchored to root
+		{"lua/old.bak", false, true},
+		{"old.bak", false, false}, // rule lives in lua/
+		{"lua/debug.log", false, false},
+		{"lua/plugins/other.log", false, true},
+		{"lua/plugins/x.bak", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := s.ignored(tt.rel, tt.isDir); got != tt.want {
+				t.Errorf("ignored(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+			}
+		})
+	}
+
+	var nilSet *ignoreSet
+	if nilSet.ignored("error.log", false) {
+		t.Error("nil ignoreSet should not ignore")
+	}
+}
+
+func TestCopyHonorsSnapfigignore(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	srcDir := filepath.Join(homeDir, ".config", "nvim")
+	os.MkdirAll(filepath.Join(srcDir, "plugin"), 0755)
+	os.MkdirAll(filepath.Join(srcDir, "spell"), 0755)
+	os.WriteFile(filepath.Join(srcDir, ignoreFilename), []byte("plugin/\n"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "init.lua"), []byte("init"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "plugin", "packer_compiled.lua"), []byte("gen"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "spell", ignoreFilename), []byte("*.spl\n!en.utf-8.spl\n"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "spell", "de.utf-8.spl"), []byte("de"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "spell", "en.utf-8.spl"), []byte("en"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/nvim", Enabled: true},
+		},
+	}
+
+	copier := &Copier{
+		cfg:        cfg,
+		home:       homeDir,
+		vaultDir:   vaultDir,
+		snapfigDir: filepath.Dir(vaultDir),
+	}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	dst := filepath.Join(vaultDir, ".config", "nvim")
+	for _, rel := range []string{ignoreFilename, "init.lua", "spell/" + ignoreFilename, "spell/en.utf-8.spl"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err != nil {
+			t.Errorf("expected %s in vault: %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"plugin", "spell/de.utf-8.spl"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !os.IsNotExist(err) {
+			t.Errorf("ignored %s should not be in vault", rel)
+		}
+	}
+}
+
+func TestRestoreHonorsVaultSnapfigignore(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	// A vault written before the ignore rule was added
+	vaultApp := filepath.Join(vaultDir, ".config", "app")
+	os.MkdirAll(vaultApp, 0755)
+	os.WriteFile(filepath.Join(vaultApp, ignoreFilename), []byte("*.tmp\n"), 0644)
+	os.WriteFile(filepath.Join(vaultApp, "app.conf"), []byte("conf"), 0644)
+	os.WriteFile(filepath.Join(vaultApp, "state.tmp"), []byte("tmp"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+		},
+	}
+
+	restorer := &Restorer{
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
+	}
+
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	homeApp := filepath.Join(homeDir, ".config", "app")
+	if _, err := os.Stat(filepath.Join(homeApp, ignoreFilename)); err != nil {
+		t.Errorf("ignore file should be restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(homeApp, "state.tmp")); !os.IsNotExist(err) {
+		t.Error("ignored state.tmp should not be restored")
+	}
+
+	entries, err := restorer.ListVaultEntries()
+	if err != nil {
+		t.Fatalf("ListVaultEntries() error: %v", err)
+	}
+	for _, c := range entries[0].Children {
+		if filepath.Base(c) == "state.tmp" {
+			t.Error("ListVaultEntries() should not list ignored files")
+		}
+	}
+}
+
+func TestEncryptedPathKeepsIgnoreFilePlain(t *testing.T) {
+	setupTestGitConfig(t)
+	t.Setenv(PassphraseEnv, "test-passphrase")
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	srcDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(srcDir, 0755)
+	os.WriteFile(filepath.Join(srcDir, ignoreFilename), []byte("*.tmp\n"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "app.conf"), []byte("conf"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true, Encrypt: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, cipher: newVaultCipher(cfg)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	vaultApp := filepath.Join(vaultDir, ".config", "app")
+	if data, err := os.ReadFile(filepath.Join(vaultApp, ignoreFilename)); err != nil || string(data) != "*.tmp\n" {
+		t.Errorf("vault %s = %q, %v, want it in plaintext", ignoreFilename, data, err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultApp, "app.conf"+EncryptedExt)); err != nil {
+		t.Errorf("app.conf should still be encrypted: %v", err)
+	}
+
+	// A file stored before the rule was added is left out on restore
+	blob, _ := copier.cipher.encrypt([]byte("tmp"))
+	os.WriteFile(filepath.Join(vaultApp, "state.tmp"+EncryptedExt), blob, 0644)
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: vaultDir, cipher: newVaultCipher(cfg)}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	homeApp := filepath.Join(newHome, ".config", "app")
+	for _, name := range []string{ignoreFilename, "app.conf"} {
+		if _, err := os.Stat(filepath.Join(homeApp, name)); err != nil {
+			t.Errorf("%s should be restored: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(homeApp, "state.tmp")); !os.IsNotExist(err) {
+		t.Error("ignored state.tmp should not be restored")
+	}
+}
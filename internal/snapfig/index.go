@@ -0,0 +1,283 @@
+package snapfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const indexVersion = 1
+
+// indexEntry records the content hash of a file together with the
+// stat data it had when it was hashed.
+type indexEntry struct {
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mtime"` // UnixNano
+	ChangeTime int64  `json:"ctime"` // UnixNano, 0 where unsupported
+	Hash       string `json:"hash"`
+}
+
+// matches reports whether info still describes the file that was hashed.
+func (e indexEntry) matches(info os.FileInfo) bool {
+	return e.Size == info.Size() &&
+		e.ModTime == info.ModTime().UnixNano() &&
+		e.ChangeTime == changeTime(info)
+}
+
+type indexFile struct {
+	Version int                   `json:"version"`
+	Entries map[string]indexEntry `json:"entries"`
+}
+
+// HashIndex is a persistent cache of content hashes keyed by absolute path.
+// A cached hash is trusted while the file's size, mtime and ctime still
+// match, so unchanged files are never read twice. Checking ctime catches
+// edits made by tools that restore the original mtime.
+// A nil *HashIndex is valid and simply hashes every file it is asked about.
+type HashIndex struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]indexEntry
+	seen    map[string]bool // paths looked up or recorded since loading or pruning
+	dirty   bool
+}
+
+// IndexPath returns the index file location for a vault.
+// Each vault gets its own file under <snapfigDir>/index/.
+func IndexPath(snapfigDir, vaultDir string) string {
+	abs, err := filepath.Abs(vaultDir)
+	if err != nil {
+		abs = vaultDir
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(snapfigDir, "index", hex.EncodeToString(sum[:8])+".json")
+}
+
+// LoadHashIndex reads the index at path.
+// A missing or unreadable index yields an empty one: it is only a cache.
+func LoadHashIndex(path string) *HashIndex {
+	idx := &HashIndex{
+		path:    path,
+		entries: make(map[string]indexEntry),
+		seen:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return idx
+	}
+
+	var f indexFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != indexVersion {
+		return idx
+	}
+	if f.Entries != nil {
+		idx.entries = f.Entries
+	}
+	return idx
+}
+
+// Hash returns the content hash of path, using the cached value when
+// the recorded stat data matches info.
+func (x *HashIndex) Hash(path string, info os.FileInfo) (string, error) {
+	if hash, ok := x.cached(path, info); ok {
+		return hash, nil
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	x.Record(path, info, hash)
+	return hash, nil
+}
+
+// cached returns the recorded hash of path if its stat data still matches info.
+func (x *HashIndex) cached(path string, info os.FileInfo) (string, bool) {
+	if x == nil {
+		return "", false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.seen[path] = true
+	e, ok := x.entries[path]
+	if !ok || !e.matches(info) {
+		return "", false
+	}
+	return e.Hash, true
+}
+
+// Record stores a known hash for path.
+func (x *HashIndex) Record(path string, info os.FileInfo, hash string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.seen[path] = true
+	x.entries[path] = indexEntry{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		ChangeTime: changeTime(info),
+		Hash:       hash,
+	}
+	x.dirty = true
+}
+
+// Refresh re-records the stat data of path after a change that kept its
+// content, such as a new mode or mtime. The hash is only kept if it was
+// current for before, the stat data path had until then.
+func (x *HashIndex) Refresh(path string, before os.FileInfo) {
+	if x == nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.seen[path] = true
+	e, ok := x.entries[path]
+	if !ok || !e.matches(before) || e.matches(info) {
+		return
+	}
+	x.entries[path] = indexEntry{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		ChangeTime: changeTime(info),
+		Hash:       e.Hash,
+	}
+	x.dirty = true
+}
+
+// Forget drops path and everything below it from the index.
+func (x *HashIndex) Forget(path string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	prefix := path + string(filepath.Separator)
+	for p := range x.entries {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(x.entries, p)
+			x.dirty = true
+		}
+	}
+}
+
+// Rebase moves the entries below from to the same paths below to,
+// replacing those recorded there.
+func (x *HashIndex) Rebase(from, to string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	fromPrefix := from + string(filepath.Separator)
+	toPrefix := to + string(filepath.Separator)
+	for p := range x.entries {
+		if p == to || strings.HasPrefix(p, toPrefix) {
+			delete(x.entries, p)
+			x.dirty = true
+		}
+	}
+	moved := make(map[string]indexEntry)
+	for p, e := range x.entries {
+		if p == from || strings.HasPrefix(p, fromPrefix) {
+			delete(x.entries, p)
+			moved[to+strings.TrimPrefix(p, from)] = e
+			if x.seen[p] {
+				x.seen[to+strings.TrimPrefix(p, from)] = true
+			}
+		}
+	}
+	for p, e := range moved {
+		x.entries[p] = e
+		x.dirty = true
+	}
+}
+
+// Prune drops the entries of paths not looked up or recorded since the
+// index was loaded or last pruned: files deleted, moved or no longer
+// watched. Only a run going through every watched path prunes, before
+// saving.
+func (x *HashIndex) Prune() {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for p := range x.entries {
+		if !x.seen[p] {
+			delete(x.entries, p)
+			x.dirty = true
+		}
+	}
+	x.seen = make(map[string]bool)
+}
+
+// Save writes the index to disk if it changed.
+func (x *HashIndex) Save() error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(indexFile{Version: indexVersion, Entries: x.entries})
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(x.path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(x.path, data, 0644); err != nil {
+		return err
+	}
+	x.dirty = false
+	return nil
+}
+
+// hashFile returns the hex-encoded SHA-256 of a file's content.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contentDiffers reports whether two existing files have different content.
+// Size is compared first; hashes are only consulted when sizes match.
+func contentDiffers(idx *HashIndex, a string, aInfo os.FileInfo, b string, bInfo os.FileInfo) (bool, error) {
+	if aInfo.Size() != bInfo.Size() {
+		return true, nil
+	}
+
+	ha, err := idx.Hash(a, aInfo)
+	if err != nil {
+		return false, err
+	}
+	hb, err := idx.Hash(b, bInfo)
+	if err != nil {
+		return false, err
+	}
+	return ha != hb, nil
+}
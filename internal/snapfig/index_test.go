@@ -0,0 +1,330 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestIndexPath(t *testing.T) {
+	a := IndexPath("/home/u/.snapfig", "/home/u/.snapfig/vault")
+	b := IndexPath("/home/u/.snapfig", "/mnt/other/vault")
+
+	if a == b {
+		t.Error("IndexPath() should differ per vault")
+	}
+	if !strings.HasPrefix(a, filepath.Join("/home/u/.snapfig", "index")) {
+		t.Errorf("IndexPath() = %q, want it under snapfig index dir", a)
+	}
+	if a != IndexPath("/home/u/.snapfig", "/home/u/.snapfig/vault") {
+		t.Error("IndexPath() should be stable")
+	}
+}
+
+func TestHashIndexRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "file.txt")
+	os.WriteFile(file, []byte("content"), 0644)
+	info, _ := os.Stat(file)
+
+	idxPath := filepath.Join(tmpDir, "index", "test.json")
+	idx := LoadHashIndex(idxPath)
+
+	hash, err := idx.Hash(file, info)
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	loaded := LoadHashIndex(idxPath)
+	entry, ok := loaded.entries[file]
+	if !ok {
+		t.Fatal("loaded index missing entry")
+	}
+	if entry.Hash != hash {
+		t.Errorf("loaded hash = %q, want %q", entry.Hash, hash)
+	}
+}
+
+func TestHashIndexFastPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "file.txt")
+	os.WriteFile(file, []byte("content"), 0644)
+	info, _ := os.Stat(file)
+
+	idx := LoadHashIndex(filepath.Join(tmpDir, "index.json"))
+	idx.Record(file, info, "cached-hash")
+
+	hash, err := idx.Hash(file, info)
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	if hash != "cached-hash" {
+		t.Errorf("Hash() = %q, want cached value when size and mtime match", hash)
+	}
+
+	// Touching the file invalidates the entry
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(file, later, later)
+	info, _ = os.Stat(file)
+
+	hash, err = idx.Hash(file, info)
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	if hash == "cached-hash" {
+		t.Error("Hash() returned stale cached value after mtime change")
+	}
+}
+
+func TestHashIndexForget(t *testing.T) {
+	idx := LoadHashIndex(filepath.Join(t.TempDir(), "index.json"))
+	idx.entries["/vault/dir/a"] = indexEntry{Hash: "a"}
+	idx.entries["/vault/dir/sub/b"] = indexEntry{Hash: "b"}
+	idx.entries["/vault/dirx"] = indexEntry{Hash: "c"}
+
+	idx.Forget("/vault/dir")
+
+	if _, ok := idx.entries["/vault/dir/a"]; ok {
+		t.Error("Forget() kept child entry")
+	}
+	if _, ok := idx.entries["/vault/dir/sub/b"]; ok {
+		t.Error("Forget() kept nested entry")
+	}
+	if _, ok := idx.entries["/vault/dirx"]; !ok {
+		t.Error("Forget() removed sibling with shared prefix")
+	}
+}
+
+func TestHashIndexRebase(t *testing.T) {
+	idx := LoadHashIndex(filepath.Join(t.TempDir(), "index.json"))
+	idx.entries["/vault.staging/a"] = indexEntry{Hash: "new"}
+	idx.entries["/vault/a"] = indexEntry{Hash: "old"}
+	idx.entries["/vault/gone"] = indexEntry{Hash: "gone"}
+	idx.entries["/home/a"] = indexEntry{Hash: "src"}
+
+	idx.Rebase("/vault.staging", "/vault")
+
+	if e := idx.entries["/vault/a"]; e.Hash != "new" {
+		t.Errorf("Rebase() /vault/a hash = %q, want %q", e.Hash, "new")
+	}
+	if _, ok := idx.entries["/vault/gone"]; ok {
+		t.Error("Rebase() kept an entry not in the moved tree")
+	}
+	if _, ok := idx.entries["/vault.staging/a"]; ok {
+		t.Error("Rebase() kept the old path")
+	}
+	if _, ok := idx.entries["/home/a"]; !ok {
+		t.Error("Rebase() removed an unrelated entry")
+	}
+}
+
+func TestHashIndexPrune(t *testing.T) {
+	tmpDir := t.TempDir()
+	idxPath := filepath.Join(tmpDir, "index.json")
+	kept := filepath.Join(tmpDir, "kept")
+	gone := filepath.Join(tmpDir, "gone")
+	for _, file := range []string{kept, gone} {
+		os.WriteFile(file, []byte(file), 0644)
+	}
+
+	idx := LoadHashIndex(idxPath)
+	for _, file := range []string{kept, gone} {
+		info, _ := os.Stat(file)
+		idx.Hash(file, info)
+	}
+	idx.Save()
+
+	// The next run only looks up one of them
+	idx = LoadHashIndex(idxPath)
+	info, _ := os.Stat(kept)
+	idx.Hash(kept, info)
+	idx.Prune()
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	loaded := LoadHashIndex(idxPath)
+	if _, ok := loaded.entries[kept]; !ok {
+		t.Error("Prune() dropped an entry looked up")
+	}
+	if _, ok := loaded.entries[gone]; ok {
+		t.Error("Prune() kept an entry not looked up")
+	}
+}
+
+func TestCopyPrunesHashIndex(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	for _, name := range []string{"a.conf", "b.conf"} {
+		os.WriteFile(filepath.Join(homeDir, ".config", "app", name), []byte(name), 0644)
+	}
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	idxPath := IndexPath(tmpDir, vaultDir)
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, index: LoadHashIndex(idxPath)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("first Copy() error: %v", err)
+	}
+	// Unchanged files are hashed on both sides
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+
+	os.Remove(filepath.Join(homeDir, ".config", "app", "b.conf"))
+	copier.index = LoadHashIndex(idxPath)
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("third Copy() error: %v", err)
+	}
+
+	loaded := LoadHashIndex(idxPath)
+	for _, path := range []string{
+		filepath.Join(homeDir, ".config", "app", "b.conf"),
+		filepath.Join(vaultDir, ".config", "app", "b.conf"),
+	} {
+		if _, ok := loaded.entries[path]; ok {
+			t.Errorf("entry of removed file %s kept", path)
+		}
+	}
+	if _, ok := loaded.entries[filepath.Join(homeDir, ".config", "app", "a.conf")]; !ok {
+		t.Error("entry of a copied file dropped")
+	}
+}
+
+func TestHashIndexCorruptFile(t *testing.T) {
+	idxPath := filepath.Join(t.TempDir(), "index.json")
+	os.WriteFile(idxPath, []byte("not json"), 0644)
+
+	idx := LoadHashIndex(idxPath)
+	if len(idx.entries) != 0 {
+		t.Errorf("LoadHashIndex() on corrupt file has %d entries, want 0", len(idx.entries))
+	}
+}
+
+func TestNilHashIndex(t *testing.T) {
+	var idx *HashIndex
+	file := filepath.Join(t.TempDir(), "file.txt")
+	os.WriteFile(file, []byte("content"), 0644)
+	info, _ := os.Stat(file)
+
+	if _, err := idx.Hash(file, info); err != nil {
+		t.Errorf("nil Hash() error: %v", err)
+	}
+	idx.Record(file, info, "x")
+	idx.Forget(file)
+	idx.Prune()
+	if err := idx.Save(); err != nil {
+		t.Errorf("nil Save() error: %v", err)
+	}
+}
+
+func TestCopyDetectsSameSizeEditWithPreservedMtime(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(homeDir, 0755)
+
+	srcFile := filepath.Join(homeDir, ".testrc")
+	os.WriteFile(srcFile, []byte("value=1"), 0644)
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(srcFile, mtime, mtime)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".testrc", Enabled: true},
+		},
+	}
+
+	copier := &Copier{
+		cfg:        cfg,
+		home:       homeDir,
+		vaultDir:   vaultDir,
+		snapfigDir: tmpDir,
+		index:      LoadHashIndex(IndexPath(tmpDir, vaultDir)),
+	}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("first Copy() error: %v", err)
+	}
+
+	// Same-size edit that keeps the original mtime
+	os.WriteFile(srcFile, []byte("value=2"), 0644)
+	os.Chtimes(srcFile, mtime, mtime)
+
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if result.FilesUpdated != 1 {
+		t.Errorf("Copy() updated %d files, want 1", result.FilesUpdated)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(vaultDir, ".testrc"))
+	if string(content) != "value=2" {
+		t.Errorf("vault content = %q, want %q", content, "value=2")
+	}
+}
+
+func TestRestoreSkipsAfterFreshClone(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	os.MkdirAll(filepath.Join(vaultDir, ".config", "app"), 0755)
+
+	// Vault files carry fresh mtimes, as git checkout would leave them
+	for _, name := range []string{"a.conf", "b.conf"} {
+		os.WriteFile(filepath.Join(homeDir, ".config", "app", name), []byte(name), 0644)
+		old := time.Now().Add(-24 * time.Hour)
+		os.Chtimes(filepath.Join(homeDir, ".config", "app", name), old, old)
+		os.WriteFile(filepath.Join(vaultDir, ".config", "app", name), []byte(name), 0644)
+	}
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+		},
+	}
+
+	restorer := &Restorer{
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
+		index:    LoadHashIndex(IndexPath(tmpDir, vaultDir)),
+	}
+
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if result.FilesUpdated != 0 {
+		t.Errorf("Restore() updated %d files, want 0 for identical content", result.FilesUpdated)
+	}
+	if result.FilesSkipped != 2 {
+		t.Errorf("Restore() skipped %d files, want 2", result.FilesSkipped)
+	}
+
+	if _, err := os.Stat(IndexPath(tmpDir, vaultDir)); err != nil {
+		t.Errorf("Restore() did not persist hash index: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// keepMarker is placed in vault directories whose source is empty, so
+// git keeps them. Restore recreates the directory but not the marker.
+const keepMarker = ".snapfig-keep"
+
+// keepDir places the keep marker in dst when its source is empty, and
+// removes it once the directory has other content. The marker is not
+// counted as a file.
+func (c *Copier) keepDir(dst string, empty bool) error {
+	if c.dryRun {
+		return nil
+	}
+
+	path := filepath.Join(dst, keepMarker)
+	if !empty {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	return writeFileAtomic(path, nil, 0644)
+}
@@ -0,0 +1,134 @@
+package snapfig
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestEmptyDirSurvivesClone(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	os.MkdirAll(filepath.Join(homeDir, ".config", "foo", "plugins"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "foo", "foo.conf"), []byte("x = 1\n"), 0644)
+	os.MkdirAll(filepath.Join(homeDir, ".gnupg", "private-keys-v1.d"), 0700)
+	os.Chmod(filepath.Join(homeDir, ".gnupg"), 0700)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/foo", Enabled: true},
+			{Path: ".gnupg", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, meta: loadMetadata(vaultDir, false)}
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if result.GitError != nil {
+		t.Fatalf("Copy() git error: %v", result.GitError)
+	}
+	if result.FilesUpdated != 1 {
+		t.Errorf("FilesUpdated = %d, want 1: keep markers are not counted", result.FilesUpdated)
+	}
+
+	for _, dir := range []string{".config/foo/plugins", ".gnupg/private-keys-v1.d"} {
+		if _, err := os.Stat(filepath.Join(vaultDir, dir, keepMarker)); err != nil {
+			t.Errorf("%s should hold a keep marker: %v", dir, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "foo", keepMarker)); !os.IsNotExist(err) {
+		t.Error("a directory with files needs no keep marker")
+	}
+
+	// What a pull on another machine gets
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if out, err := exec.Command("git", "clone", "-q", vaultDir, cloneDir).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v: %s", err, out)
+	}
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: cloneDir, meta: loadMetadata(cloneDir, false)}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(newHome, ".gnupg", "private-keys-v1.d"))
+	if err != nil || !info.IsDir() {
+		t.Fatalf("empty directory not restored: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("restored mode = %o, want 700", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(newHome, ".config", "foo", "plugins")); err != nil {
+		t.Errorf("empty plugins directory not restored: %v", err)
+	}
+
+	filepath.Walk(newHome, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Name() == keepMarker {
+			t.Errorf("keep marker restored at %s", path)
+		}
+		return nil
+	})
+
+	entries, err := restorer.ListVaultEntries()
+	if err != nil {
+		t.Fatalf("ListVaultEntries() error: %v", err)
+	}
+	for _, e := range entries {
+		for _, c := range e.Children {
+			if strings.HasSuffix(c, keepMarker) {
+				t.Errorf("ListVaultEntries() lists %s", c)
+			}
+		}
+	}
+}
+
+func TestKeepMarkerRemovedWhenDirFills(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	plugins := filepath.Join(homeDir, ".config", "foo", "plugins")
+	os.MkdirAll(plugins, 0755)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/foo", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(plugins, "a.lua"), []byte("return {}\n"), 0644)
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if result.FilesRemoved != 0 {
+		t.Errorf("FilesRemoved = %d, want 0: the marker is not a stale file", result.FilesRemoved)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "foo", "plugins", keepMarker)); !os.IsNotExist(err) {
+		t.Error("keep marker should be removed once the directory has files")
+	}
+
+	// Emptied again
+	os.Remove(filepath.Join(plugins, "a.lua"))
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("third Copy() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "foo", "plugins", keepMarker)); err != nil {
+		t.Errorf("keep marker should be back: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package snapfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// HostsDir holds the per-host override layers inside the vault.
+// Everything else in the vault is the shared layer.
+const HostsDir = "hosts"
+
+// RootDir holds watched paths outside $HOME inside a vault layer:
+// /etc/hosts is stored as _root/etc/hosts.
+const RootDir = "_root"
+
+// HostLayer returns the root of a host's override layer.
+func HostLayer(vaultDir, host string) string {
+	return filepath.Join(vaultDir, HostsDir, host)
+}
+
+// vaultRel returns where a watched path lives inside a vault layer.
+func vaultRel(w config.Watched) string {
+	if w.IsSystem() {
+		return filepath.Join(RootDir, w.Path)
+	}
+	return w.Path
+}
+
+// sourcePath returns the location of a watched path on this machine.
+func sourcePath(home string, w config.Watched) string {
+	if w.IsSystem() {
+		return filepath.Clean(w.Path)
+	}
+	return filepath.Join(home, w.Path)
+}
+
+// displayPath returns path relative to home for reporting,
+// or as is when it is outside home.
+func displayPath(home, path string) string {
+	rel, err := filepath.Rel(home, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// vaultTarget returns where a watched path is written in the vault:
+// the host layer for host-specific paths, the shared layer otherwise.
+func vaultTarget(vaultDir, host string, w config.Watched) (string, error) {
+	if !w.HostSpecific {
+		return filepath.Join(vaultDir, vaultRel(w)), nil
+	}
+	if host == "" {
+		return "", fmt.Errorf("%s is host-specific but the hostname is unknown", w.Path)
+	}
+	return filepath.Join(HostLayer(vaultDir, host), vaultRel(w)), nil
+}
+
+// layer is one existing copy of a watched path in the vault.
+type layer struct {
+	path string
+	info os.FileInfo
+}
+
+// vaultLayers returns the copies of a watched path in the vault, highest
+// priority first: the current host's layer, then the shared layer.
+// Layers of a different kind than the first (file vs dir) are dropped.
+func vaultLayers(vaultDir, host string, w config.Watched) ([]layer, error) {
+	var candidates []string
+	if host != "" {
+		candidates = append(candidates, filepath.Join(HostLayer(vaultDir, host), vaultRel(w)))
+	}
+	candidates = append(candidates, filepath.Join(vaultDir, vaultRel(w)))
+
+	// A single file may be stored with an encrypted or template suffix
+	suffixes := []string{EncryptedExt}
+	if w.Template {
+		suffixes = append(suffixes, templateExt, templateExt+EncryptedExt)
+	}
+
+	var layers []layer
+	// Lstat: a symlink stored by the preserve policy is restored as such
+	for _, path := range candidates {
+		info, err := os.Lstat(path)
+		for _, suffix := range suffixes {
+			if !os.IsNotExist(err) {
+				break
+			}
+			if sInfo, sErr := os.Lstat(path + suffix); sErr == nil {
+				path, info, err = path+suffix, sInfo, nil
+			}
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(layers) > 0 && layers[0].info.IsDir() != info.IsDir() {
+			continue
+		}
+		layers = append(layers, layer{path: path, info: info})
+	}
+	return layers, nil
+}
+
+// layerRoots returns the paths of layers, for shadowing lower ones.
+func layerRoots(layers []layer) []string {
+	roots := make([]string, len(layers))
+	for i, l := range layers {
+		roots[i] = l.path
+	}
+	return roots
+}
@@ -0,0 +1,319 @@
+package snapfig
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestVaultTarget(t *testing.T) {
+	vaultDir := "/vault"
+
+	got, err := vaultTarget(vaultDir, "laptop", config.Watched{Path: ".zshrc"})
+	if err != nil || got != filepath.Join(vaultDir, ".zshrc") {
+		t.Errorf("vaultTarget(shared) = %q, %v", got, err)
+	}
+
+	got, err = vaultTarget(vaultDir, "laptop", config.Watched{Path: ".config/hypr", HostSpecific: true})
+	if err != nil || got != filepath.Join(vaultDir, HostsDir, "laptop", ".config/hypr") {
+		t.Errorf("vaultTarget(host-specific) = %q, %v", got, err)
+	}
+
+	if _, err := vaultTarget(vaultDir, "", config.Watched{Path: ".gitconfig", HostSpecific: true}); err == nil {
+		t.Error("vaultTarget() without host should fail for host-specific paths")
+	}
+}
+
+func TestVaultLayers(t *testing.T) {
+	vaultDir := t.TempDir()
+	os.MkdirAll(filepath.Join(vaultDir, ".config", "hypr"), 0755)
+	os.MkdirAll(filepath.Join(HostLayer(vaultDir, "laptop"), ".config", "hypr"), 0755)
+	os.WriteFile(filepath.Join(HostLayer(vaultDir, "laptop"), ".gitconfig"), []byte("x"), 0644)
+	os.MkdirAll(filepath.Join(vaultDir, ".gitconfig"), 0755) // mismatched kind
+
+	w := config.Watched{Path: ".config/hypr"}
+
+	layers, err := vaultLayers(vaultDir, "laptop", w)
+	if err != nil {
+		t.Fatalf("vaultLayers() error: %v", err)
+	}
+	if len(layers) != 2 || layers[0].path != filepath.Join(HostLayer(vaultDir, "laptop"), ".config/hypr") {
+		t.Errorf("vaultLayers() = %+v, want host layer first", layers)
+	}
+
+	layers, _ = vaultLayers(vaultDir, "desktop", w)
+	if len(layers) != 1 || layers[0].path != filepath.Join(vaultDir, ".config/hypr") {
+		t.Errorf("vaultLayers(other host) = %+v, want shared only", layers)
+	}
+
+	layers, _ = vaultLayers(vaultDir, "laptop", config.Watched{Path: ".gitconfig"})
+	if len(layers) != 1 || layers[0].info.IsDir() {
+		t.Errorf("vaultLayers() should drop layers of a different kind, got %+v", layers)
+	}
+
+	layers, _ = vaultLayers(vaultDir, "laptop", config.Watched{Path: ".missing"})
+	if len(layers) != 0 {
+		t.Errorf("vaultLayers(missing) = %+v, want none", layers)
+	}
+}
+
+func TestHostLayersCopyAndRestore(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	write := func(home, rel, content string) {
+		path := filepath.Join(home, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	laptopHome := filepath.Join(tmpDir, "laptop")
+	write(laptopHome, ".config/hypr/hyprland.conf", "source = monitors.conf\n")
+	write(laptopHome, ".config/hypr/monitors.conf", "monitor = eDP-1\n")
+	write(laptopHome, ".gitconfig", "email = me@home\n")
+
+	workHome := filepath.Join(tmpDir, "work")
+	write(workHome, ".config/hypr/monitors.conf", "monitor = DP-1\n")
+	write(workHome, ".gitconfig", "email = me@work\n")
+
+	// The laptop writes the shared hypr config; both hosts keep their own
+	// monitors and gitconfig
+	laptopCfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/hypr", Enabled: true},
+			{Path: ".gitconfig", Enabled: true, HostSpecific: true},
+		},
+	}
+	laptop := &Copier{cfg: laptopCfg, home: laptopHome, vaultDir: vaultDir, snapfigDir: tmpDir, host: "laptop"}
+	if _, err := laptop.Copy(); err != nil {
+		t.Fatalf("laptop Copy() error: %v", err)
+	}
+
+	workCfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/hypr", Enabled: true, HostSpecific: true},
+			{Path: ".gitconfig", Enabled: true, HostSpecific: true},
+		},
+	}
+	work := &Copier{cfg: workCfg, home: workHome, vaultDir: vaultDir, snapfigDir: tmpDir, host: "work"}
+	if _, err := work.Copy(); err != nil {
+		t.Fatalf("work Copy() error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(vaultDir, ".gitconfig")); !os.IsNotExist(err) {
+		t.Error("host-specific .gitconfig should not be in the shared layer")
+	}
+	for _, rel := range []string{"hosts/laptop/.gitconfig", "hosts/work/.gitconfig", "hosts/work/.config/hypr/monitors.conf", ".config/hypr/hyprland.conf"} {
+		if _, err := os.Stat(filepath.Join(vaultDir, rel)); err != nil {
+			t.Errorf("expected %s in vault: %v", rel, err)
+		}
+	}
+
+	// Manifest keeps both hosts' entries
+	manifest, err := LoadManifest(vaultDir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error: %v", err)
+	}
+	hosts := map[string]bool{}
+	for _, e := range manifest.Entries {
+		if e.Path == ".gitconfig" {
+			hosts[e.Host] = true
+		}
+	}
+	if !hosts["laptop"] || !hosts["work"] {
+		t.Errorf("manifest .gitconfig hosts = %v, want laptop and work", hosts)
+	}
+
+	// Restoring on the workstation merges shared and host layers
+	restoreHome := filepath.Join(tmpDir, "restore")
+	restorer := &Restorer{cfg: workCfg, home: restoreHome, vaultDir: vaultDir, host: "work"}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	checks := map[string]string{
+		".config/hypr/hyprland.conf": "source = monitors.conf\n", // shared
+		".config/hypr/monitors.conf": "monitor = DP-1\n",         // host override
+		".gitconfig":                 "email = me@work\n",
+	}
+	for rel, want := range checks {
+		got, err := os.ReadFile(filepath.Join(restoreHome, rel))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", rel, got, err, want)
+		}
+	}
+
+	// A second restore finds nothing to do
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("second Restore() error: %v", err)
+	}
+	if result.FilesUpdated != 0 {
+		t.Errorf("second Restore() updated %d files, want 0", result.FilesUpdated)
+	}
+
+	entries, err := restorer.ListVaultEntries()
+	if err != nil {
+		t.Fatalf("ListVaultEntries() error: %v", err)
+	}
+	want := []string{
+		filepath.Join(".config/hypr", "hyprland.conf"),
+		filepath.Join(".config/hypr", "monitors.conf"),
+	}
+	if len(entries) != 2 || len(entries[0].Children) != 2 ||
+		entries[0].Children[0] != want[0] || entries[0].Children[1] != want[1] {
+		t.Errorf("ListVaultEntries() = %+v, want merged children %v", entries, want)
+	}
+
+	// Selective restore picks the host version of an overridden file
+	os.Remove(filepath.Join(restoreHome, ".config/hypr/monitors.conf"))
+	if _, err := restorer.RestoreSelective([]string{want[1]}); err != nil {
+		t.Fatalf("RestoreSelective() error: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(restoreHome, ".config/hypr/monitors.conf"))
+	if string(got) != "monitor = DP-1\n" {
+		t.Errorf("selective monitors.conf = %q, want host version", got)
+	}
+}
+
+func TestSystemPaths(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	sysDir := filepath.Join(tmpDir, "etc", "X11")
+	os.MkdirAll(homeDir, 0755)
+	os.MkdirAll(sysDir, 0755)
+	os.WriteFile(filepath.Join(sysDir, "xorg.conf"), []byte("Section \"Device\"\n"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: sysDir, Enabled: true}},
+	}
+
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, RootDir, sysDir, "xorg.conf")); err != nil {
+		t.Errorf("system path should be stored under %s: %v", RootDir, err)
+	}
+
+	os.Remove(filepath.Join(sysDir, "xorg.conf"))
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(sysDir, "xorg.conf")); err != nil {
+		t.Errorf("system file not restored to its absolute path: %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	// A path the user cannot write is reported, the rest still restored
+	os.WriteFile(filepath.Join(homeDir, ".zshrc"), []byte("export EDITOR=vim\n"), 0644)
+	cfg.Watching = append(cfg.Watching, config.Watched{Path: ".zshrc", Enabled: true})
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	os.Remove(filepath.Join(sysDir, "xorg.conf"))
+	os.Remove(filepath.Join(homeDir, ".zshrc"))
+	os.Chmod(sysDir, 0555)
+	defer os.Chmod(sysDir, 0755)
+
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result.Denied) != 1 || result.Denied[0] != sysDir {
+		t.Errorf("Denied = %v, want [%s]", result.Denied, sysDir)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".zshrc")); err != nil {
+		t.Errorf(".zshrc should still be restored: %v", err)
+	}
+
+	// As when selecting a file below it
+	os.Remove(filepath.Join(homeDir, ".zshrc"))
+	result, err = restorer.RestoreSelective([]string{filepath.Join(sysDir, "xorg.conf"), ".zshrc"})
+	if err != nil {
+		t.Fatalf("RestoreSelective() error: %v", err)
+	}
+	if len(result.Denied) != 1 || result.Denied[0] != sysDir {
+		t.Errorf("Denied = %v, want [%s]", result.Denied, sysDir)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".zshrc")); err != nil {
+		t.Errorf(".zshrc should still be restored: %v", err)
+	}
+
+	// A file the user can write in that directory is not rewritten in place
+	os.Chmod(sysDir, 0755)
+	os.WriteFile(filepath.Join(sysDir, "xorg.conf"), []byte("local"), 0644)
+	os.Chmod(sysDir, 0555)
+	result, err = restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result.Denied) != 1 || result.Denied[0] != sysDir {
+		t.Errorf("Denied = %v, want [%s]", result.Denied, sysDir)
+	}
+	if data, _ := os.ReadFile(filepath.Join(sysDir, "xorg.conf")); string(data) != "local" {
+		t.Errorf("xorg.conf = %q, want it left as it was", data)
+	}
+}
+
+func TestPrivilegeHelper(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	tmpDir := t.TempDir()
+	etcDir := filepath.Join(tmpDir, "etc")
+	dst := filepath.Join(etcDir, "hosts")
+	os.MkdirAll(etcDir, 0755)
+	os.WriteFile(dst, []byte("old\n"), 0444)
+	// A directory the user cannot write, as /etc
+	os.Chmod(etcDir, 0555)
+	t.Cleanup(func() { os.Chmod(etcDir, 0755) })
+
+	// Stand-in for sudo: logs the command, then makes the directory writable
+	logPath := filepath.Join(tmpDir, "helper.log")
+	helper := filepath.Join(tmpDir, "fake-sudo")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n[ \"$1\" = tee ] && chmod u+w " + etcDir + "\nexec \"$@\"\n"
+	os.WriteFile(helper, []byte(script), 0755)
+
+	r := &Restorer{helper: newPrivilegeHelper(helper)}
+	if err := r.writeFile(dst, strings.NewReader("127.0.0.1 localhost\n"), 0600, time.Time{}); err != nil {
+		t.Fatalf("writeFile() through helper error: %v", err)
+	}
+	got, _ := os.ReadFile(dst)
+	if string(got) != "127.0.0.1 localhost\n" {
+		t.Errorf("content = %q", got)
+	}
+	log, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(log), "tee ") || !strings.Contains(string(log), "chmod 600 ") || !strings.Contains(string(log), "mv -f ") {
+		t.Errorf("helper log = %q, want tee, chmod and mv", log)
+	}
+
+	os.Chmod(dst, 0444)
+	os.Chmod(etcDir, 0555)
+	err := (&Restorer{}).writeFile(dst, strings.NewReader("x"), 0644, time.Time{})
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), "privilege_helper") {
+		t.Errorf("writeFile() without helper error = %v, want permission error with hint", err)
+	}
+}
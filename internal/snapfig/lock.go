@@ -0,0 +1,144 @@
+package snapfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrVaultBusy is returned when another snapfig process holds the vault
+// lock for longer than the configured wait.
+var ErrVaultBusy = errors.New("vault busy")
+
+// lockPoll is how often a busy lock is retried.
+const lockPoll = 100 * time.Millisecond
+
+// LockHolder describes the process holding the vault lock.
+type LockHolder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+// BusyError reports the holder of a vault lock that could not be taken.
+// It matches ErrVaultBusy with errors.Is.
+type BusyError struct {
+	Holder *LockHolder // nil if the holder did not record itself yet
+}
+
+func (e *BusyError) Error() string {
+	if e.Holder == nil {
+		return ErrVaultBusy.Error() + ": locked by another snapfig process"
+	}
+	return fmt.Sprintf("%s: locked by pid %d (%s) since %s",
+		ErrVaultBusy, e.Holder.PID, e.Holder.Command, e.Holder.Since.Local().Format("15:04:05"))
+}
+
+func (e *BusyError) Unwrap() error {
+	return ErrVaultBusy
+}
+
+// VaultLock is an advisory lock serializing the operations that change
+// a vault, so the daemon, the CLI and the TUI never run them at once.
+type VaultLock struct {
+	f *os.File
+}
+
+// LockPath returns the lock file of a vault. It sits next to the vault,
+// not inside it, so it is never committed and survives a transactional swap.
+func LockPath(vaultDir string) string {
+	return filepath.Clean(vaultDir) + ".lock"
+}
+
+// LockVault takes the vault lock, waiting up to timeout for the current
+// holder to release it. A lock held by a process that died is released
+// by the system, so it never goes stale.
+func LockVault(vaultDir string, timeout time.Duration) (*VaultLock, error) {
+	path := LockPath(vaultDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vault lock: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock vault: %w", err)
+		}
+		if ok {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, &BusyError{Holder: readLockHolder(path)}
+		}
+		time.Sleep(lockPoll)
+	}
+
+	l := &VaultLock{f: f}
+	if err := l.record(); err != nil {
+		l.Unlock()
+		return nil, fmt.Errorf("failed to record vault lock holder: %w", err)
+	}
+	return l, nil
+}
+
+// record writes this process into the lock file for waiters to report.
+func (l *VaultLock) record() error {
+	data, err := json.Marshal(LockHolder{
+		PID:     os.Getpid(),
+		Command: lockCommand(),
+		Since:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = l.f.WriteAt(data, 0)
+	return err
+}
+
+// Unlock clears the holder and releases the lock.
+// The file itself is kept: removing it would let two processes lock
+// different files under the same name.
+func (l *VaultLock) Unlock() error {
+	l.f.Truncate(0)
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readLockHolder returns the holder recorded in the lock file, or nil.
+func readLockHolder(path string) *LockHolder {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var h LockHolder
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil
+	}
+	return &h
+}
+
+// lockCommand describes this process, e.g. "snapfig daemon run".
+func lockCommand() string {
+	if len(os.Args) == 0 {
+		return "snapfig"
+	}
+	args := append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...)
+	return strings.Join(args, " ")
+}
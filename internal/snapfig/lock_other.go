@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package snapfig
+
+import "os"
+
+// tryLockFile is not available on this platform: the lock always succeeds.
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is not available on this platform.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package snapfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestLockVaultBusyNamesHolder(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+
+	held, err := LockVault(vaultDir, 0)
+	if err != nil {
+		t.Fatalf("LockVault() error: %v", err)
+	}
+	defer held.Unlock()
+
+	_, err = LockVault(vaultDir, 0)
+	if !errors.Is(err, ErrVaultBusy) {
+		t.Fatalf("LockVault() error = %v, want ErrVaultBusy", err)
+	}
+	var busy *BusyError
+	if !errors.As(err, &busy) || busy.Holder == nil {
+		t.Fatalf("LockVault() error = %v, want a BusyError naming the holder", err)
+	}
+	if busy.Holder.PID != os.Getpid() {
+		t.Errorf("holder pid = %d, want %d", busy.Holder.PID, os.Getpid())
+	}
+	if !strings.Contains(err.Error(), busy.Holder.Command) {
+		t.Errorf("error %q should name the holder command %q", err, busy.Holder.Command)
+	}
+}
+
+func TestLockVaultWaitsForRelease(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+
+	held, err := LockVault(vaultDir, 0)
+	if err != nil {
+		t.Fatalf("LockVault() error: %v", err)
+	}
+	go func() {
+		time.Sleep(3 * lockPoll)
+		held.Unlock()
+	}()
+
+	l, err := LockVault(vaultDir, 5*time.Second)
+	if err != nil {
+		t.Fatalf("LockVault() should get the lock once released: %v", err)
+	}
+	l.Unlock()
+
+	if data, _ := os.ReadFile(LockPath(vaultDir)); len(data) != 0 {
+		t.Errorf("lock file should be cleared on unlock, got %q", data)
+	}
+}
+
+func TestServiceCopyVaultBusy(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	cfg := &config.Config{Git: config.GitModeDisable, VaultPath: vaultDir, LockTimeout: "0s"}
+
+	svc, err := NewService(cfg, filepath.Join(tmpDir, "config.yml"))
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+
+	held, err := LockVault(vaultDir, 0)
+	if err != nil {
+		t.Fatalf("LockVault() error: %v", err)
+	}
+	defer held.Unlock()
+
+	if _, err := svc.Copy(context.Background(), nil); !errors.Is(err, ErrVaultBusy) {
+		t.Errorf("Copy() error = %v, want ErrVaultBusy", err)
+	}
+	if err := svc.Push(context.Background(), nil); !errors.Is(err, ErrVaultBusy) {
+		t.Errorf("Push() error = %v, want ErrVaultBusy", err)
+	}
+	if err := svc.SetRemote("https://example.com/vault.git"); !errors.Is(err, ErrVaultBusy) {
+		t.Errorf("SetRemote() error = %v, want ErrVaultBusy", err)
+	}
+}
+
+func TestServiceCopyLoadsStateOnceLocked(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	t.Setenv("HOME", homeDir)
+	os.MkdirAll(homeDir, 0755)
+	os.MkdirAll(vaultDir, 0755)
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bash"), 0644)
+
+	cfg := &config.Config{
+		Git:         config.GitModeDisable,
+		VaultPath:   vaultDir,
+		LockTimeout: "5s",
+		Watching:    []config.Watched{{Path: ".bashrc", Enabled: true}},
+	}
+	svc, err := NewService(cfg, filepath.Join(tmpDir, "config.yml"))
+	if err != nil {
+		t.Fatalf("NewService() error: %v", err)
+	}
+
+	// Another operation holds the vault and stores a file with its metadata
+	held, err := LockVault(vaultDir, 0)
+	if err != nil {
+		t.Fatalf("LockVault() error: %v", err)
+	}
+	go func() {
+		time.Sleep(3 * lockPoll)
+		os.WriteFile(filepath.Join(vaultDir, ".profile"), []byte("profile"), 0644)
+		other := loadMetadata(vaultDir, false)
+		other.record(filepath.Join(vaultDir, ".profile"), filepath.Join(homeDir, ".bashrc"), mustStat(t, filepath.Join(homeDir, ".bashrc")))
+		other.save()
+		held.Unlock()
+	}()
+
+	if _, err := svc.Copy(context.Background(), nil); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if _, ok := loadMetadata(vaultDir, false).lookup(filepath.Join(vaultDir, ".profile")); !ok {
+		t.Error("metadata written while Copy waited for the lock should be kept")
+	}
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Errorf("stat %s: %v", path, err)
+	}
+	return info
+}
@@ -13,10 +13,20 @@ import (
 
 // ManifestEntry represents a single entry in the manifest.
 type ManifestEntry struct {
-	Path    string          `yaml:"path"`
-	Git     config.GitMode  `yaml:"git"`
-	Enabled bool            `yaml:"enabled"`
-	IsDir   bool            `yaml:"is_dir"`
+	Path     string         `yaml:"path"`
+	Git      config.GitMode `yaml:"git"`
+	Enabled  bool           `yaml:"enabled"`
+	IsDir    bool           `yaml:"is_dir"`
+	Include  []string       `yaml:"include,omitempty"`
+	Exclude  []string       `yaml:"exclude,omitempty"`
+	Encrypt  bool           `yaml:"encrypt,omitempty"`
+	Template bool           `yaml:"template,omitempty"`
+
+	HostSpecific bool                 `yaml:"host_specific,omitempty"`
+	Symlinks     config.SymlinkPolicy `yaml:"symlinks,omitempty"`
+	Host         string               `yaml:"host,omitempty"`    // host that last wrote the entry
+	Matches      []string             `yaml:"matches,omitempty"` // paths a glob entry resolved to
+	Repos        []RepoRef            `yaml:"repos,omitempty"`   // nested repositories stored by reference
 }
 
 // Manifest represents the vault manifest with all backed up paths.
@@ -50,7 +60,7 @@ func WriteManifest(vaultDir string, entries []ManifestEntry) error {
 	}
 
 	manifestPath := ManifestPath(vaultDir)
-	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+	if err := writeFileAtomic(manifestPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write manifest: %w", err)
 	}
 
@@ -86,13 +96,25 @@ func ManifestExists(vaultDir string) bool {
 
 // ToWatching converts manifest entries to config.Watched slice.
 // This enables reconstructing the config from the manifest on a new machine.
+// A host-specific path listed once per host becomes a single entry.
 func (m *Manifest) ToWatching() []config.Watched {
 	watching := make([]config.Watched, 0, len(m.Entries))
+	seen := make(map[string]bool)
 	for _, entry := range m.Entries {
+		if seen[entry.Path] {
+			continue
+		}
+		seen[entry.Path] = true
 		watching = append(watching, config.Watched{
-			Path:    entry.Path,
-			Git:     entry.Git,
-			Enabled: entry.Enabled,
+			Path:         entry.Path,
+			Git:          entry.Git,
+			Enabled:      entry.Enabled,
+			Include:      entry.Include,
+			Exclude:      entry.Exclude,
+			Encrypt:      entry.Encrypt,
+			Template:     entry.Template,
+			HostSpecific: entry.HostSpecific,
+			Symlinks:     entry.Symlinks,
 		})
 	}
 	return watching
@@ -102,7 +124,12 @@ func (m *Manifest) ToWatching() []config.Watched {
 func FromWatching(watching []config.Watched, copiedItems []CopiedItem) []ManifestEntry {
 	// Create a map of copied items for quick lookup
 	copiedMap := make(map[string]CopiedItem)
+	matched := make(map[string][]CopiedItem)
 	for _, item := range copiedItems {
+		if item.Pattern != "" {
+			matched[item.Pattern] = append(matched[item.Pattern], item)
+			continue
+		}
 		copiedMap[item.Path] = item
 	}
 
@@ -113,17 +140,39 @@ func FromWatching(watching []config.Watched, copiedItems []CopiedItem) []Manifes
 		}
 
 		entry := ManifestEntry{
-			Path:    w.Path,
-			Git:     w.Git,
-			Enabled: w.Enabled,
-			IsDir:   false, // default
+			Path:     w.Path,
+			Git:      w.Git,
+			Enabled:  w.Enabled,
+			IsDir:    false, // default
+			Include:  w.Include,
+			Exclude:  w.Exclude,
+			Encrypt:  w.Encrypt,
+			Template: w.Template,
+
+			HostSpecific: w.HostSpecific,
+			Symlinks:     w.Symlinks,
 		}
 
 		// Get IsDir from copiedItems if available
 		if item, ok := copiedMap[w.Path]; ok {
 			entry.IsDir = item.IsDir
+			entry.Host = item.Host
 			// Use the git mode from copied item (effective mode)
 			entry.Git = item.GitMode
+			entry.Repos = item.Repos
+		}
+
+		// A glob records what it matched; it is a directory entry
+		// when every match is one
+		if items := matched[w.Path]; len(items) > 0 {
+			entry.IsDir = true
+			entry.Host = items[0].Host
+			entry.Git = items[0].GitMode
+			for _, item := range items {
+				entry.Matches = append(entry.Matches, item.Path)
+				entry.Repos = append(entry.Repos, item.Repos...)
+				entry.IsDir = entry.IsDir && item.IsDir
+			}
 		}
 
 		entries = append(entries, entry)
@@ -131,3 +180,25 @@ func FromWatching(watching []config.Watched, copiedItems []CopiedItem) []Manifes
 
 	return entries
 }
+
+// mergeHostEntries adds to current the host-specific entries that other
+// hosts wrote to the manifest, so a shared vault keeps track of every
+// host's layer. Entries of host, and shared entries, are replaced by current.
+func mergeHostEntries(existing, current []ManifestEntry, host string) []ManifestEntry {
+	type key struct{ path, host string }
+	have := make(map[key]bool, len(current))
+	for _, e := range current {
+		if e.HostSpecific {
+			have[key{e.Path, e.Host}] = true
+		}
+	}
+
+	merged := current
+	for _, e := range existing {
+		if !e.HostSpecific || e.Host == "" || e.Host == host || have[key{e.Path, e.Host}] {
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
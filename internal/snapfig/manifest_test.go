@@ -261,6 +261,7 @@ func TestManifestRoundTrip(t *testing.T) {
 		{Path: ".config/fish", Git: config.GitModeRemove, Enabled: true, IsDir: true},
 		{Path: ".zshrc", Git: config.GitModeDisable, Enabled: true, IsDir: false},
 		{Path: ".gitconfig", Git: config.GitModeRemove, Enabled: false, IsDir: false},
+		{Path: ".ssh", Git: config.GitModeRemove, Enabled: true, IsDir: true, Encrypt: true},
 	}
 
 	// Write
@@ -293,6 +294,40 @@ func TestManifestRoundTrip(t *testing.T) {
 		if loaded.IsDir != orig.IsDir {
 			t.Errorf("entry %d isDir mismatch: expected %t, got %t", i, orig.IsDir, loaded.IsDir)
 		}
+		if loaded.Encrypt != orig.Encrypt {
+			t.Errorf("entry %d encrypt mismatch: expected %t, got %t", i, orig.Encrypt, loaded.Encrypt)
+		}
+	}
+
+	if w := manifest.ToWatching(); !w[4].Encrypt {
+		t.Error("ToWatching() should keep encrypt")
+	}
+}
+
+func TestManifestSymlinksRoundTrip(t *testing.T) {
+	vaultDir := t.TempDir()
+
+	watching := []config.Watched{
+		{Path: ".config/nvim", Enabled: true},
+		{Path: ".config/app", Enabled: true, Symlinks: config.SymlinksPreserve},
+		{Path: ".local/bin", Enabled: true, Symlinks: config.SymlinksFollow},
+	}
+	if err := WriteManifest(vaultDir, FromWatching(watching, nil)); err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+	manifest, err := LoadManifest(vaultDir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+
+	got := manifest.ToWatching()
+	if len(got) != len(watching) {
+		t.Fatalf("ToWatching() = %d entries, want %d", len(got), len(watching))
+	}
+	for i, w := range watching {
+		if got[i].Symlinks != w.Symlinks {
+			t.Errorf("%s symlinks = %q, want %q", w.Path, got[i].Symlinks, w.Symlinks)
+		}
 	}
 }
 
@@ -363,3 +398,36 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestMergeHostEntries(t *testing.T) {
+	existing := []ManifestEntry{
+		{Path: ".zshrc", Host: "work"},
+		{Path: ".gitconfig", HostSpecific: true, Host: "work"},
+		{Path: ".gitconfig", HostSpecific: true, Host: "laptop"},
+		{Path: ".config/hypr", HostSpecific: true, Host: "laptop"},
+	}
+	current := []ManifestEntry{
+		{Path: ".zshrc", Host: "laptop"},
+		{Path: ".gitconfig", HostSpecific: true, Host: "laptop"},
+	}
+
+	merged := mergeHostEntries(existing, current, "laptop")
+
+	// Shared .zshrc is replaced, the stale laptop hypr entry dropped,
+	// and work's .gitconfig kept
+	if len(merged) != 3 {
+		t.Fatalf("mergeHostEntries() = %+v, want 3 entries", merged)
+	}
+	if merged[2].Path != ".gitconfig" || merged[2].Host != "work" {
+		t.Errorf("merged[2] = %+v, want work .gitconfig", merged[2])
+	}
+
+	m := &Manifest{Entries: merged}
+	watching := m.ToWatching()
+	if len(watching) != 2 {
+		t.Fatalf("ToWatching() = %+v, want one entry per path", watching)
+	}
+	if !watching[1].HostSpecific {
+		t.Error("ToWatching() should keep host_specific")
+	}
+}
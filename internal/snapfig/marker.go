@@ -0,0 +1,165 @@
+package snapfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const symlinkMarkerExt = ".snapfig-symlink"
+const symlinkMarkerVersion = 1
+
+// symlinkMarker describes a symlink stored as a marker file in the vault.
+type symlinkMarker struct {
+	Version  int    `json:"version"`
+	Name     string `json:"name"`
+	Target   string `json:"target"`
+	Relative bool   `json:"relative"`
+	Mode     string `json:"mode,omitempty"` // octal mode of the link itself, e.g. "0777"
+}
+
+// newSymlinkMarker describes a link named name pointing at target.
+func newSymlinkMarker(name, target string, mode os.FileMode) symlinkMarker {
+	m := symlinkMarker{
+		Version:  symlinkMarkerVersion,
+		Name:     name,
+		Target:   target,
+		Relative: !filepath.IsAbs(target),
+	}
+	if mode != 0 {
+		m.Mode = fmt.Sprintf("%04o", mode.Perm())
+	}
+	return m
+}
+
+// encode renders the marker as stored in the vault.
+func (m symlinkMarker) encode() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// decodeSymlinkMarker reads a marker in either format: the structured
+// one, or the legacy "ln -s <target> <name>" line. markerName is the
+// file name of the marker, used to split legacy targets with spaces.
+func decodeSymlinkMarker(content []byte, markerName string) (symlinkMarker, bool, error) {
+	trimmed := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(trimmed, "{") {
+		m, err := parseLegacyMarker(trimmed, strings.TrimSuffix(markerName, symlinkMarkerExt))
+		return m, true, err
+	}
+
+	var m symlinkMarker
+	if err := json.Unmarshal(content, &m); err != nil {
+		return m, false, fmt.Errorf("invalid marker format: %w", err)
+	}
+	if m.Version > symlinkMarkerVersion {
+		return m, false, fmt.Errorf("unsupported marker version %d", m.Version)
+	}
+	if m.Name == "" || m.Target == "" {
+		return m, false, fmt.Errorf("invalid marker format")
+	}
+	return m, false, nil
+}
+
+// parseLegacyMarker reads an "ln -s <target> <name>" marker. When the
+// line ends with the expected name, everything before it is the target.
+func parseLegacyMarker(content, name string) (symlinkMarker, error) {
+	if name != "" && strings.HasPrefix(content, "ln -s ") && strings.HasSuffix(content, " "+name) {
+		target := strings.TrimSuffix(strings.TrimPrefix(content, "ln -s "), " "+name)
+		if target != "" {
+			return newSymlinkMarker(name, target, 0), nil
+		}
+	}
+
+	target, name, err := parseSymlinkMarker(content)
+	if err != nil {
+		return symlinkMarker{}, err
+	}
+	return newSymlinkMarker(name, target, 0), nil
+}
+
+// parseSymlinkMarker splits a legacy marker on the first space after "ln -s".
+func parseSymlinkMarker(content string) (target, name string, err error) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "ln -s ") {
+		return "", "", fmt.Errorf("invalid marker format")
+	}
+
+	parts := strings.SplitN(content[6:], " ", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid marker format")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// MigrateResult contains the results of a vault migration.
+type MigrateResult struct {
+	Markers  []string // legacy symlink markers rewritten, relative to the vault
+	Invalid  []string // marker files that could not be read
+	GitError error
+}
+
+// MigrateVault rewrites legacy "ln -s" symlink markers in the vault in
+// the structured format and commits the change.
+func MigrateVault(vaultDir string) (*MigrateResult, error) {
+	result := &MigrateResult{}
+	gitDir := filepath.Join(vaultDir, ".git")
+
+	err := filepath.WalkDir(vaultDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == gitDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), symlinkMarkerExt) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(vaultDir, path)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		m, legacy, err := decodeSymlinkMarker(content, d.Name())
+		if err != nil {
+			result.Invalid = append(result.Invalid, rel)
+			return nil
+		}
+		if !legacy {
+			return nil
+		}
+
+		data, err := m.encode()
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, data, 0644); err != nil {
+			return err
+		}
+		result.Markers = append(result.Markers, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(gitDir); err == nil && len(result.Markers) > 0 {
+		msg := fmt.Sprintf("snapfig: migrate %d symlink markers", len(result.Markers))
+		if err := CommitVault(vaultDir, msg); err != nil {
+			result.GitError = err
+		}
+	}
+
+	return result, nil
+}
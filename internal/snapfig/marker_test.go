@@ -0,0 +1,174 @@
+package snapfig
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestDecodeSymlinkMarker(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		markerName string
+		want       symlinkMarker
+		wantLegacy bool
+		wantErr    bool
+	}{
+		{
+			name:       "structured",
+			content:    `{"version": 1, "name": "current", "target": "../My Themes/dark", "relative": true, "mode": "0777"}`,
+			markerName: "current.snapfig-symlink",
+			want:       symlinkMarker{Version: 1, Name: "current", Target: "../My Themes/dark", Relative: true, Mode: "0777"},
+		},
+		{
+			name:       "legacy",
+			content:    "ln -s /path/to/target linkname\n",
+			markerName: "linkname.snapfig-symlink",
+			want:       symlinkMarker{Version: 1, Name: "linkname", Target: "/path/to/target"},
+			wantLegacy: true,
+		},
+		{
+			name:       "legacy target with spaces",
+			content:    "ln -s ../Application Support/Code settings\n",
+			markerName: "settings.snapfig-symlink",
+			want:       symlinkMarker{Version: 1, Name: "settings", Target: "../Application Support/Code", Relative: true},
+			wantLegacy: true,
+		},
+		{
+			name:       "legacy renamed marker",
+			content:    "ln -s target link\n",
+			markerName: "other.snapfig-symlink",
+			want:       symlinkMarker{Version: 1, Name: "link", Target: "target", Relative: true},
+			wantLegacy: true,
+		},
+		{
+			name:       "future version",
+			content:    `{"version": 2, "name": "a", "target": "b"}`,
+			markerName: "a.snapfig-symlink",
+			wantErr:    true,
+		},
+		{
+			name:       "missing target",
+			content:    `{"version": 1, "name": "a"}`,
+			markerName: "a.snapfig-symlink",
+			wantErr:    true,
+		},
+		{
+			name:       "not a marker",
+			content:    "#!/bin/sh\n",
+			markerName: "a.snapfig-symlink",
+			wantErr:    true,
+			wantLegacy: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, legacy, err := decodeSymlinkMarker([]byte(tt.content), tt.markerName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeSymlinkMarker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if legacy != tt.wantLegacy {
+				t.Errorf("legacy = %v, want %v", legacy, tt.wantLegacy)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("decodeSymlinkMarker() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymlinkMarkerRoundTripWithSpaces(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	appDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(filepath.Join(appDir, "My Themes"), 0755)
+	os.Symlink("My Themes", filepath.Join(appDir, "current theme"))
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	os.MkdirAll(filepath.Join(newHome, ".config", "app", "My Themes"), 0755)
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: vaultDir}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	got, err := os.Readlink(filepath.Join(newHome, ".config", "app", "current theme"))
+	if err != nil || got != "My Themes" {
+		t.Errorf("restored link -> %q, %v; want %q", got, err, "My Themes")
+	}
+}
+
+func TestMigrateVault(t *testing.T) {
+	setupTestGitConfig(t)
+	vaultDir := t.TempDir()
+	if err := InitVaultRepo(vaultDir); err != nil {
+		t.Fatalf("InitVaultRepo() error: %v", err)
+	}
+
+	current, _ := newSymlinkMarker("current", "themes", 0).encode()
+	files := map[string]string{
+		".config/app/legacy.snapfig-symlink":  "ln -s ../My Themes/dark legacy\n",
+		".config/app/current.snapfig-symlink": string(current),
+		".config/app/broken.snapfig-symlink":  "not a marker",
+		".config/app/app.conf":                "ln -s is not a marker here\n",
+	}
+	for rel, content := range files {
+		path := filepath.Join(vaultDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	result, err := MigrateVault(vaultDir)
+	if err != nil {
+		t.Fatalf("MigrateVault() error: %v", err)
+	}
+
+	if want := []string{filepath.Join(".config", "app", "legacy.snapfig-symlink")}; !reflect.DeepEqual(result.Markers, want) {
+		t.Errorf("Markers = %v, want %v", result.Markers, want)
+	}
+	if want := []string{filepath.Join(".config", "app", "broken.snapfig-symlink")}; !reflect.DeepEqual(result.Invalid, want) {
+		t.Errorf("Invalid = %v, want %v", result.Invalid, want)
+	}
+	if result.GitError != nil {
+		t.Errorf("GitError = %v", result.GitError)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(vaultDir, ".config", "app", "legacy.snapfig-symlink"))
+	m, legacy, err := decodeSymlinkMarker(content, "legacy.snapfig-symlink")
+	if err != nil || legacy || m.Target != "../My Themes/dark" || m.Name != "legacy" {
+		t.Errorf("migrated marker = %+v, legacy %v, err %v", m, legacy, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(vaultDir, ".config", "app", "app.conf")); string(got) != files[".config/app/app.conf"] {
+		t.Error("regular files should not be touched")
+	}
+
+	out, _ := exec.Command("git", "-C", vaultDir, "log", "--format=%s").Output()
+	if !strings.Contains(string(out), "snapfig: migrate 1 symlink markers") {
+		t.Errorf("git log = %q, want a migrate commit", out)
+	}
+
+	// A second run has nothing left to do
+	result, err = MigrateVault(vaultDir)
+	if err != nil || len(result.Markers) != 0 {
+		t.Errorf("second MigrateVault() = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,303 @@
+package snapfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const metadataFilename = "metadata.json"
+const metadataVersion = 1
+
+// fileMeta is what git does not keep of a vault file's original:
+// permission bits beyond the executable bit, mtime, ownership and xattrs.
+type fileMeta struct {
+	Mode    string            `json:"mode"` // octal permission bits, e.g. "0600"
+	ModTime time.Time         `json:"mtime"`
+	Owner   string            `json:"owner,omitempty"`
+	Group   string            `json:"group,omitempty"`
+	Xattrs  map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// perm returns the recorded permission bits.
+func (m fileMeta) perm() (os.FileMode, bool) {
+	mode, err := strconv.ParseUint(m.Mode, 8, 32)
+	if err != nil {
+		return 0, false
+	}
+	return os.FileMode(mode).Perm(), true
+}
+
+type metadataFile struct {
+	Version int                 `json:"version"`
+	Entries map[string]fileMeta `json:"entries"`
+}
+
+// MetadataPath returns the path to the metadata sidecar inside the vault.
+func MetadataPath(vaultDir string) string {
+	return filepath.Join(vaultDir, metadataFilename)
+}
+
+// metadataStore is the metadata sidecar of a vault, keyed by the path of
+// each file relative to the vault. It is versioned with the vault, so a
+// fresh clone restores files exactly as they were copied.
+// A nil *metadataStore records nothing and knows nothing.
+type metadataStore struct {
+	mu       sync.Mutex
+	vaultDir string
+	xattrs   bool
+	entries  map[string]fileMeta
+	dirty    bool
+
+	// User and group lookups, once per run
+	userNames  map[int]string
+	groupNames map[int]string
+	userIDs    map[string]int
+	groupIDs   map[string]int
+}
+
+// loadMetadata reads the sidecar of a vault. A missing or unreadable
+// sidecar yields an empty store: files are then restored with the
+// metadata the vault files have.
+func loadMetadata(vaultDir string, xattrs bool) *metadataStore {
+	m := &metadataStore{
+		vaultDir: vaultDir,
+		xattrs:   xattrs,
+		entries:  make(map[string]fileMeta),
+
+		userNames:  make(map[int]string),
+		groupNames: make(map[int]string),
+		userIDs:    make(map[string]int),
+		groupIDs:   make(map[string]int),
+	}
+
+	data, err := os.ReadFile(MetadataPath(vaultDir))
+	if err != nil {
+		return m
+	}
+	var f metadataFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != metadataVersion || f.Entries == nil {
+		return m
+	}
+	m.entries = f.Entries
+	return m
+}
+
+// key returns the store key of a vault path.
+func (m *metadataStore) key(vaultPath string) (string, bool) {
+	rel, err := filepath.Rel(m.vaultDir, vaultPath)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// record stores the metadata of src, the original of vaultPath.
+func (m *metadataStore) record(vaultPath, src string, info os.FileInfo) {
+	if m == nil {
+		return
+	}
+	key, ok := m.key(vaultPath)
+	if !ok {
+		return
+	}
+
+	meta := fileMeta{
+		Mode:    fmt.Sprintf("%04o", uint32(info.Mode().Perm())),
+		ModTime: info.ModTime().UTC(),
+	}
+	if m.xattrs {
+		meta.Xattrs = readXattrs(src)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if uid, gid, ok := fileOwner(info); ok {
+		meta.Owner, meta.Group = m.names(uid, gid)
+	}
+	if old, ok := m.entries[key]; ok && sameMeta(old, meta) {
+		return
+	}
+	m.entries[key] = meta
+	m.dirty = true
+}
+
+// names returns the user and group names of uid and gid,
+// empty when unknown. Caller holds mu.
+func (m *metadataStore) names(uid, gid int) (string, string) {
+	owner, ok := m.userNames[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			owner = u.Username
+		}
+		m.userNames[uid] = owner
+	}
+	group, ok := m.groupNames[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+			group = g.Name
+		}
+		m.groupNames[gid] = group
+	}
+	return owner, group
+}
+
+// lookup returns the recorded metadata of a vault path.
+func (m *metadataStore) lookup(vaultPath string) (fileMeta, bool) {
+	if m == nil {
+		return fileMeta{}, false
+	}
+	key, ok := m.key(vaultPath)
+	if !ok {
+		return fileMeta{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	meta, ok := m.entries[key]
+	return meta, ok
+}
+
+// prune drops the entries of files no longer in the vault.
+func (m *metadataStore) prune() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.entries {
+		if _, err := os.Lstat(filepath.Join(m.vaultDir, filepath.FromSlash(key))); os.IsNotExist(err) {
+			delete(m.entries, key)
+			m.dirty = true
+		}
+	}
+}
+
+// save writes the sidecar if it changed. Keys are sorted by the JSON
+// encoder, so the file diffs cleanly between commits.
+func (m *metadataStore) save() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(metadataFile{Version: metadataVersion, Entries: m.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	if err := writeFileAtomic(MetadataPath(m.vaultDir), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+func sameMeta(a, b fileMeta) bool {
+	if a.Mode != b.Mode || !a.ModTime.Equal(b.ModTime) || a.Owner != b.Owner || a.Group != b.Group {
+		return false
+	}
+	if len(a.Xattrs) != len(b.Xattrs) {
+		return false
+	}
+	for name, value := range a.Xattrs {
+		if string(b.Xattrs[name]) != string(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ids returns the local uid and gid of meta's owner and group,
+// or -1 for a name unknown on this machine.
+func (m *metadataStore) ids(meta fileMeta) (uid, gid int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uid, gid = -1, -1
+	if meta.Owner != "" {
+		id, ok := m.userIDs[meta.Owner]
+		if !ok {
+			id = -1
+			if u, err := user.Lookup(meta.Owner); err == nil {
+				id, _ = strconv.Atoi(u.Uid)
+			}
+			m.userIDs[meta.Owner] = id
+		}
+		uid = id
+	}
+	if meta.Group != "" {
+		id, ok := m.groupIDs[meta.Group]
+		if !ok {
+			id = -1
+			if g, err := user.LookupGroup(meta.Group); err == nil {
+				id, _ = strconv.Atoi(g.Gid)
+			}
+			m.groupIDs[meta.Group] = id
+		}
+		gid = id
+	}
+	return uid, gid
+}
+
+// applyMetadata gives path the recorded ownership, mode, xattrs and mtime.
+// Ownership is only changed where the user may: restoring as a regular
+// user leaves files owned by that user. Files owned by someone else,
+// such as system paths, are changed through the privilege helper.
+// The hash index entry of path is refreshed, so the next run does not
+// rehash a file whose content did not change.
+func (r *Restorer) applyMetadata(path string, meta fileMeta) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	defer r.index.Refresh(path, info)
+
+	uid, gid := r.meta.ids(meta)
+	if curUID, curGID, ok := fileOwner(info); ok && (uid >= 0 && uid != curUID || gid >= 0 && gid != curGID) {
+		err := os.Lchown(path, uid, gid)
+		if errors.Is(err, fs.ErrPermission) {
+			err = nil
+			if curUID != os.Geteuid() && r.helper != nil {
+				owner := meta.Owner
+				if meta.Group != "" {
+					owner += ":" + meta.Group
+				}
+				err = r.helper.run(nil, "chown", owner, path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if perm, ok := meta.perm(); ok && info.Mode().Perm() != perm {
+		err := os.Chmod(path, perm)
+		if err := r.elevate(err, "chmod", fmt.Sprintf("%o", perm), path); err != nil {
+			return err
+		}
+	}
+
+	// Best effort: the filesystem may not support xattrs,
+	// and some namespaces are reserved to root
+	for name, value := range meta.Xattrs {
+		writeXattr(path, name, value)
+	}
+
+	if !meta.ModTime.IsZero() && !info.ModTime().Equal(meta.ModTime) {
+		err := os.Chtimes(path, meta.ModTime, meta.ModTime)
+		if err := r.elevate(err, "touch", "-t", meta.ModTime.Local().Format("200601021504.05"), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	sshDir := filepath.Join(homeDir, ".ssh")
+	os.MkdirAll(sshDir, 0700)
+	os.WriteFile(filepath.Join(sshDir, "config"), []byte("Host *\n"), 0600)
+	os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte("example.com ssh-ed25519 AAAA\n"), 0644)
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(sshDir, "config"), mtime, mtime)
+	os.Chmod(sshDir, 0700)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".ssh", Enabled: true}},
+	}
+
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	store := loadMetadata(vaultDir, false)
+	meta, ok := store.lookup(filepath.Join(vaultDir, ".ssh", "config"))
+	if !ok || meta.Mode != "0600" || !meta.ModTime.Equal(mtime) {
+		t.Errorf("recorded metadata = %+v, %v", meta, ok)
+	}
+	if meta.Owner == "" {
+		t.Error("owner name should be recorded")
+	}
+
+	// A clone only keeps the executable bit and sets fresh mtimes
+	os.Chmod(filepath.Join(vaultDir, ".ssh"), 0755)
+	os.Chmod(filepath.Join(vaultDir, ".ssh", "config"), 0644)
+	os.Chtimes(filepath.Join(vaultDir, ".ssh", "config"), time.Now(), time.Now())
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(newHome, ".ssh", "config"))
+	if err != nil {
+		t.Fatalf("restored config missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("restored mode = %v, want 0600", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("restored mtime = %v, want %v", info.ModTime(), mtime)
+	}
+	dirInfo, _ := os.Stat(filepath.Join(newHome, ".ssh"))
+	if dirInfo.Mode().Perm() != 0700 {
+		t.Errorf("restored dir mode = %v, want 0700", dirInfo.Mode().Perm())
+	}
+
+	// Unchanged content with loosened permissions is fixed too
+	os.Chmod(filepath.Join(newHome, ".ssh", "config"), 0666)
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("second Restore() error: %v", err)
+	}
+	if result.FilesUpdated != 0 {
+		t.Errorf("second Restore() updated %d files, want 0", result.FilesUpdated)
+	}
+	info, _ = os.Stat(filepath.Join(newHome, ".ssh", "config"))
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode after second restore = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Entries of files gone from the vault are pruned
+	os.Remove(filepath.Join(sshDir, "known_hosts"))
+	copier.meta = loadMetadata(vaultDir, false)
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("third Copy() error: %v", err)
+	}
+	if _, ok := loadMetadata(vaultDir, false).lookup(filepath.Join(vaultDir, ".ssh", "known_hosts")); ok {
+		t.Error("metadata of a removed file should be pruned")
+	}
+}
+
+func TestRestoreMetadataKeepsIndexCurrent(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(homeDir, 0755)
+	os.WriteFile(filepath.Join(homeDir, ".netrc"), []byte("machine example.com\n"), 0600)
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(homeDir, ".netrc"), mtime, mtime)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".netrc", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	os.Chmod(filepath.Join(vaultDir, ".netrc"), 0644)
+	os.Chtimes(filepath.Join(vaultDir, ".netrc"), time.Now(), time.Now())
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	index := LoadHashIndex(filepath.Join(tmpDir, "index.json"))
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), index: index}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	// The entry recorded on write still matches after mode and mtime are set
+	dst := filepath.Join(newHome, ".netrc")
+	info, err := os.Stat(dst)
+	if err != nil || !info.ModTime().Equal(mtime) {
+		t.Fatalf("restored .netrc = %v, %v, want the recorded mtime", info, err)
+	}
+	if _, ok := index.cached(dst, info); !ok {
+		t.Error("index entry should be refreshed after metadata is applied")
+	}
+
+	// An entry already stale is not refreshed
+	os.WriteFile(dst, []byte("machine other.example.com\n"), 0600)
+	stale, _ := os.Stat(dst)
+	os.Chmod(dst, 0640)
+	index.Refresh(dst, stale)
+	info, _ = os.Stat(dst)
+	if _, ok := index.cached(dst, info); ok {
+		t.Error("a stale index entry should not be refreshed")
+	}
+}
+
+func TestMetadataXattrs(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	os.WriteFile(src, []byte("x"), 0644)
+	if err := writeXattr(src, "user.snapfig.test", []byte("value")); err != nil || readXattrs(src) == nil {
+		t.Skipf("xattrs not supported here: %v", err)
+	}
+
+	vaultDir := filepath.Join(tmpDir, "vault")
+	vaultFile := filepath.Join(vaultDir, "src")
+	os.MkdirAll(vaultDir, 0755)
+	os.WriteFile(vaultFile, []byte("x"), 0644)
+
+	info, _ := os.Stat(src)
+	store := loadMetadata(vaultDir, true)
+	store.record(vaultFile, src, info)
+	if err := store.save(); err != nil {
+		t.Fatalf("save() error: %v", err)
+	}
+
+	meta, ok := loadMetadata(vaultDir, true).lookup(vaultFile)
+	if !ok || string(meta.Xattrs["user.snapfig.test"]) != "value" {
+		t.Fatalf("recorded xattrs = %v, %v", meta.Xattrs, ok)
+	}
+
+	dst := filepath.Join(tmpDir, "dst")
+	os.WriteFile(dst, []byte("x"), 0644)
+	r := &Restorer{meta: store}
+	if err := r.applyMetadata(dst, meta); err != nil {
+		t.Fatalf("applyMetadata() error: %v", err)
+	}
+	if got := readXattrs(dst); string(got["user.snapfig.test"]) != "value" {
+		t.Errorf("restored xattrs = %v", got)
+	}
+
+	// Without the option, xattrs are not recorded
+	plain := loadMetadata(filepath.Join(tmpDir, "other"), false)
+	plain.record(filepath.Join(tmpDir, "other", "src"), src, info)
+	if meta, _ := plain.lookup(filepath.Join(tmpDir, "other", "src")); meta.Xattrs != nil {
+		t.Errorf("xattrs recorded without the option: %v", meta.Xattrs)
+	}
+}
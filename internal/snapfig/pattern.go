@@ -0,0 +1,160 @@
+package snapfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// watchedMatch is a watched path resolved to a concrete path: a plain
+// entry as is, or one match of a glob pattern with the pattern's settings.
+type watchedMatch struct {
+	config.Watched
+	Pattern string // glob the path matched, empty for a plain entry
+}
+
+// reservedVaultNames are the top-level vault entries a glob never
+// matches: they belong to snapfig, not to a watched path.
+var reservedVaultNames = map[string]bool{
+	".git":           true,
+	HostsDir:         true,
+	RootDir:          true,
+	manifestFilename: true,
+	metadataFilename: true,
+	"README.md":      true,
+}
+
+// sourceMatches resolves the enabled watched paths on this machine.
+// Each glob yields its matches in lexical order, found again on every
+// run so new ones are picked up. Globs that match nothing are returned
+// in unmatched. A path matched twice is only kept the first time.
+func sourceMatches(home string, watching []config.Watched) (matches []watchedMatch, unmatched []string, err error) {
+	return resolveWatching(watching, func(w config.Watched) ([]string, error) {
+		found, err := filepath.Glob(sourcePath(home, w))
+		if err != nil {
+			return nil, err
+		}
+		paths := make([]string, 0, len(found))
+		for _, path := range found {
+			paths = append(paths, watchedPath(home, w, path))
+		}
+		return paths, nil
+	})
+}
+
+// vaultMatches resolves the enabled watched paths against the vault:
+// a glob matches what the current host's layer and the shared layer
+// hold, storage suffixes aside.
+func vaultMatches(vaultDir, host string, watching []config.Watched) (matches []watchedMatch, unmatched []string, err error) {
+	return resolveWatching(watching, func(w config.Watched) ([]string, error) {
+		roots := []string{vaultDir}
+		if host != "" {
+			roots = append(roots, HostLayer(vaultDir, host))
+		}
+
+		suffixes := []string{"", EncryptedExt}
+		if w.Template {
+			suffixes = append(suffixes, templateExt, templateExt+EncryptedExt)
+		}
+
+		seen := make(map[string]bool)
+		var paths []string
+		for _, root := range roots {
+			for _, suffix := range suffixes {
+				found, err := filepath.Glob(filepath.Join(root, vaultRel(w)) + suffix)
+				if err != nil {
+					return nil, err
+				}
+				for _, path := range found {
+					rel, err := filepath.Rel(root, strings.TrimSuffix(path, suffix))
+					if suffix == "" {
+						// A "*" can match the suffix itself
+						rel = plainRel(rel)
+						if w.Template {
+							rel = strings.TrimSuffix(rel, templateExt)
+						}
+					}
+					if err != nil || (!w.IsSystem() && reservedVaultNames[firstSegment(rel)]) {
+						continue
+					}
+					if w.IsSystem() {
+						rel = string(filepath.Separator) + strings.TrimPrefix(rel, RootDir+string(filepath.Separator))
+					}
+					if !seen[rel] {
+						seen[rel] = true
+						paths = append(paths, rel)
+					}
+				}
+			}
+		}
+		sort.Strings(paths)
+		return paths, nil
+	})
+}
+
+// resolveWatching expands the globs among the enabled watched paths
+// with glob, keeping config order.
+func resolveWatching(watching []config.Watched, glob func(config.Watched) ([]string, error)) ([]watchedMatch, []string, error) {
+	// Plain entries win over a glob that also matches them
+	seen := make(map[string]bool)
+	for _, w := range watching {
+		if w.Enabled && !w.IsPattern() {
+			seen[w.Path] = true
+		}
+	}
+
+	var matches []watchedMatch
+	var unmatched []string
+	for _, w := range watching {
+		if !w.Enabled {
+			continue
+		}
+		if !w.IsPattern() {
+			matches = append(matches, watchedMatch{Watched: w})
+			continue
+		}
+
+		paths, err := glob(w)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pattern %s: %w", w.Path, err)
+		}
+		n := 0
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			m := watchedMatch{Watched: w, Pattern: w.Path}
+			m.Path = path
+			matches = append(matches, m)
+			n++
+		}
+		if n == 0 {
+			unmatched = append(unmatched, w.Path)
+		}
+	}
+	return matches, unmatched, nil
+}
+
+// watchedPath returns the watched path form of a source path:
+// relative to home, or absolute for paths outside it.
+func watchedPath(home string, w config.Watched, path string) string {
+	if w.IsSystem() {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// firstSegment returns the first element of a relative path.
+func firstSegment(rel string) string {
+	if i := strings.IndexRune(rel, filepath.Separator); i >= 0 {
+		return rel[:i]
+	}
+	return rel
+}
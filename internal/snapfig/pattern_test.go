@@ -0,0 +1,175 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestSourceMatches(t *testing.T) {
+	home := t.TempDir()
+	for _, dir := range []string{"Code", "VSCodium", "empty"} {
+		os.MkdirAll(filepath.Join(home, ".config", dir), 0755)
+	}
+	os.WriteFile(filepath.Join(home, ".config", "Code", "settings.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(home, ".config", "VSCodium", "settings.json"), []byte("{}"), 0644)
+
+	watching := []config.Watched{
+		{Path: ".config/VSCodium/settings.json", Enabled: true, Encrypt: true},
+		{Path: ".config/*/settings.json", Enabled: true},
+		{Path: ".local/share/applications/*.desktop", Enabled: true},
+		{Path: ".config/*/off", Enabled: false},
+	}
+
+	matches, unmatched, err := sourceMatches(home, watching)
+	if err != nil {
+		t.Fatalf("sourceMatches() error: %v", err)
+	}
+
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Path)
+	}
+	want := []string{".config/VSCodium/settings.json", ".config/Code/settings.json"}
+	if !slices.Equal(got, want) {
+		t.Errorf("matches = %v, want %v: a plain entry wins over a glob", got, want)
+	}
+	if matches[0].Pattern != "" || !matches[0].Encrypt {
+		t.Errorf("plain entry = %+v, want its own settings", matches[0])
+	}
+	if matches[1].Pattern != ".config/*/settings.json" {
+		t.Errorf("match pattern = %q, want the glob", matches[1].Pattern)
+	}
+	if !slices.Equal(unmatched, []string{".local/share/applications/*.desktop"}) {
+		t.Errorf("unmatched = %v", unmatched)
+	}
+}
+
+func TestVaultMatchesIgnoresReservedEntries(t *testing.T) {
+	vaultDir := t.TempDir()
+	os.WriteFile(filepath.Join(vaultDir, ".bashrc"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(vaultDir, ".zshrc"+EncryptedExt), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(vaultDir, "manifest.yml"), []byte("x"), 0644)
+	os.MkdirAll(filepath.Join(vaultDir, ".git"), 0755)
+	os.MkdirAll(filepath.Join(HostLayer(vaultDir, "laptop")), 0755)
+	os.WriteFile(filepath.Join(HostLayer(vaultDir, "laptop"), ".profile"), []byte("x"), 0644)
+
+	matches, _, err := vaultMatches(vaultDir, "laptop", []config.Watched{{Path: "*", Enabled: true}})
+	if err != nil {
+		t.Fatalf("vaultMatches() error: %v", err)
+	}
+
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Path)
+	}
+	want := []string{".bashrc", ".profile", ".zshrc"}
+	if !slices.Equal(got, want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+}
+
+func TestGlobCopyAndRestore(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	appsDir := filepath.Join(homeDir, ".local", "share", "applications")
+	os.MkdirAll(appsDir, 0755)
+	os.WriteFile(filepath.Join(appsDir, "nvim.desktop"), []byte("[Desktop Entry]\nName=nvim\n"), 0644)
+	os.WriteFile(filepath.Join(appsDir, "mimeinfo.cache"), []byte("cache"), 0644)
+	os.MkdirAll(filepath.Join(homeDir, ".config", "JetBrains", "GoLand2025.1", "options"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "JetBrains", "GoLand2025.1", "options", "ui.xml"), []byte("<ui/>"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".local/share/applications/*.desktop", Enabled: true},
+			{Path: ".config/JetBrains/*/options", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	// A match appearing later is picked up by the next copy
+	os.WriteFile(filepath.Join(appsDir, "kitty.desktop"), []byte("[Desktop Entry]\nName=kitty\n"), 0644)
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	wantCopied := []string{
+		".local/share/applications/kitty.desktop",
+		".local/share/applications/nvim.desktop",
+		".config/JetBrains/GoLand2025.1/options",
+	}
+	if !slices.Equal(result.Copied, wantCopied) {
+		t.Errorf("Copied = %v, want %v", result.Copied, wantCopied)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".local", "share", "applications", "mimeinfo.cache")); !os.IsNotExist(err) {
+		t.Error("files the glob does not match should stay out of the vault")
+	}
+
+	manifest, err := LoadManifest(vaultDir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error: %v", err)
+	}
+	if len(manifest.Entries) != 2 {
+		t.Fatalf("manifest entries = %+v, want one per glob", manifest.Entries)
+	}
+	apps := manifest.Entries[0]
+	if apps.Path != ".local/share/applications/*.desktop" || apps.IsDir {
+		t.Errorf("manifest entry = %+v, want the glob as a file entry", apps)
+	}
+	if !slices.Equal(apps.Matches, wantCopied[:2]) {
+		t.Errorf("manifest matches = %v, want %v", apps.Matches, wantCopied[:2])
+	}
+	if !manifest.Entries[1].IsDir {
+		t.Error("a glob matching only directories should be a directory entry")
+	}
+	if watching := manifest.ToWatching(); watching[0].Path != apps.Path {
+		t.Errorf("ToWatching() path = %q, want the glob back", watching[0].Path)
+	}
+
+	// Restore on a machine without any match yet
+	newHome := filepath.Join(tmpDir, "newhome")
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	entries, err := restorer.ListVaultEntries()
+	if err != nil {
+		t.Fatalf("ListVaultEntries() error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("ListVaultEntries() = %+v, want one entry per match", entries)
+	}
+
+	if _, err := restorer.RestoreSelective([]string{".local/share/applications/*.desktop"}); err != nil {
+		t.Fatalf("RestoreSelective() error: %v", err)
+	}
+	for _, name := range []string{"nvim.desktop", "kitty.desktop"} {
+		if _, err := os.Stat(filepath.Join(newHome, ".local", "share", "applications", name)); err != nil {
+			t.Errorf("selecting the glob should restore %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(newHome, ".config", "JetBrains")); !os.IsNotExist(err) {
+		t.Error("paths of other globs should not be restored")
+	}
+
+	result2, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result2.Restored) != 3 {
+		t.Errorf("Restored = %v, want every match", result2.Restored)
+	}
+	data, _ := os.ReadFile(filepath.Join(newHome, ".config", "JetBrains", "GoLand2025.1", "options", "ui.xml"))
+	if string(data) != "<ui/>" {
+		t.Errorf("restored content = %q", data)
+	}
+}
@@ -0,0 +1,174 @@
+package snapfig
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// PlanAction is the kind of change a copy would make to a vault entry.
+type PlanAction string
+
+const (
+	PlanAdd    PlanAction = "add"
+	PlanModify PlanAction = "modify"
+	PlanRemove PlanAction = "remove"
+)
+
+// PlanEntry is a change a copy would make to the vault.
+type PlanEntry struct {
+	Action PlanAction
+	Path   string // relative to the vault
+	IsDir  bool   // a stale directory removed with its contents
+	Bytes  int64  // bytes written, or freed by a removal
+	Link   string // symlink target, for symlink markers
+}
+
+// GitDirPlan is a nested .git directory and what copy does with it.
+type GitDirPlan struct {
+	Path string // source path, relative to home outside system paths
+	Mode config.GitMode
+}
+
+// CopyPlan is what a copy would do, computed without touching the vault.
+type CopyPlan struct {
+	Changes   []PlanEntry  // sorted by path
+	GitDirs   []GitDirPlan // in walk order
+	Skipped   []string     // watched paths not found
+	Unchanged int          // files already up to date
+
+	AddedBytes    int64
+	ModifiedBytes int64
+	RemovedBytes  int64
+
+	Findings      []SecretFinding // suspected secrets in changed files
+	Quarantined   []string        // files the quarantine policy would keep out
+	Unscanned     []string        // changed files too large to scan past their first MiB
+	TemplateDrift []string        // rendered files edited locally
+	Loops         []string        // symlinks that would not be followed
+	Special       []string        // fifos, sockets and devices left out
+}
+
+// Count returns the number of changes of the given action.
+func (p *CopyPlan) Count(action PlanAction) int {
+	n := 0
+	for _, e := range p.Changes {
+		if e.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Plan walks the watched paths as Copy does and returns the changes it
+// would make. Neither the vault, the quarantine nor git are touched.
+func (c *Copier) Plan() (*CopyPlan, error) {
+	c.dryRun = true
+	defer func() { c.dryRun = false }()
+
+	result := &CopyResult{}
+	if err := c.copyWatched(result); err != nil {
+		return nil, err
+	}
+
+	plan := &CopyPlan{
+		Changes:       result.changes,
+		GitDirs:       result.gitDirs,
+		Skipped:       result.Skipped,
+		Unchanged:     result.FilesSkipped,
+		Findings:      result.Findings,
+		Quarantined:   result.Quarantined,
+		Unscanned:     result.Unscanned,
+		TemplateDrift: result.TemplateDrift,
+		Loops:         result.Loops,
+		Special:       result.Special,
+	}
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].Path < plan.Changes[j].Path
+	})
+	for _, e := range plan.Changes {
+		switch e.Action {
+		case PlanAdd:
+			plan.AddedBytes += e.Bytes
+		case PlanModify:
+			plan.ModifiedBytes += e.Bytes
+		case PlanRemove:
+			plan.RemovedBytes += e.Bytes
+		}
+	}
+	return plan, nil
+}
+
+// planWrite records that dst would be written with size bytes.
+func (c *Copier) planWrite(dst string, size int64, link string, result *CopyResult) {
+	action := PlanAdd
+	if _, err := os.Lstat(dst); err == nil {
+		action = PlanModify
+	}
+	result.changes = append(result.changes, PlanEntry{
+		Action: action,
+		Path:   c.planPath(dst),
+		Bytes:  size,
+		Link:   link,
+	})
+	result.FilesUpdated++
+}
+
+// planRemove records that path would be removed as stale.
+func (c *Copier) planRemove(path string, result *CopyResult) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+		err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	result.changes = append(result.changes, PlanEntry{
+		Action: PlanRemove,
+		Path:   c.planPath(path),
+		IsDir:  info.IsDir(),
+		Bytes:  size,
+	})
+	result.FilesRemoved++
+	return nil
+}
+
+func (c *Copier) planPath(path string) string {
+	if rel, err := filepath.Rel(c.vaultDir, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// FormatSize renders a byte count for display, e.g. "1.5 KB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,149 @@
+package snapfig
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// treeState maps every path under root to its mtime, mode and size.
+func treeState(t *testing.T, root string) map[string]string {
+	t.Helper()
+	state := make(map[string]string)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		state[path] = fmt.Sprint(info.ModTime(), info.Mode(), info.Size())
+		return nil
+	})
+	return state
+}
+
+func TestCopyPlan(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	appDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(filepath.Join(appDir, "old"), 0755)
+	os.MkdirAll(filepath.Join(appDir, ".git"), 0755)
+	os.WriteFile(filepath.Join(appDir, "keep.conf"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(appDir, "edit.conf"), []byte("before"), 0644)
+	os.WriteFile(filepath.Join(appDir, "old", "a"), []byte("12345"), 0644)
+	os.WriteFile(filepath.Join(appDir, "old", "b"), []byte("678"), 0644)
+	os.WriteFile(filepath.Join(appDir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeRemove,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+			{Path: ".missing", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	// Change the source after the first copy
+	time.Sleep(10 * time.Millisecond)
+	os.WriteFile(filepath.Join(appDir, "edit.conf"), []byte("after!"), 0644)
+	os.WriteFile(filepath.Join(appDir, "new.conf"), []byte("0123456789"), 0644)
+	os.RemoveAll(filepath.Join(appDir, "old"))
+	os.Symlink("keep.conf", filepath.Join(appDir, "link"))
+
+	// The vault's own .git is part of the tree, so a commit shows too
+	before := treeState(t, tmpDir)
+
+	plan, err := copier.Plan()
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+
+	app := filepath.Join(".config", "app")
+	marker, _ := newSymlinkMarker("link", "keep.conf", os.ModeSymlink|0777).encode()
+	want := []PlanEntry{
+		{Action: PlanModify, Path: filepath.Join(app, "edit.conf"), Bytes: 6},
+		{Action: PlanAdd, Path: filepath.Join(app, "link"+symlinkMarkerExt), Bytes: int64(len(marker)), Link: "keep.conf"},
+		{Action: PlanAdd, Path: filepath.Join(app, "new.conf"), Bytes: 10},
+		{Action: PlanRemove, Path: filepath.Join(app, "old"), IsDir: true, Bytes: 8},
+	}
+	if !reflect.DeepEqual(plan.Changes, want) {
+		t.Errorf("Changes =\n %+v\nwant\n %+v", plan.Changes, want)
+	}
+	if plan.AddedBytes != 10+want[1].Bytes || plan.ModifiedBytes != 6 || plan.RemovedBytes != 8 {
+		t.Errorf("totals = %d/%d/%d", plan.AddedBytes, plan.ModifiedBytes, plan.RemovedBytes)
+	}
+	if plan.Count(PlanAdd) != 2 || plan.Unchanged != 1 {
+		t.Errorf("Count(add) = %d, Unchanged = %d, want 2 and 1", plan.Count(PlanAdd), plan.Unchanged)
+	}
+	wantGit := []GitDirPlan{{Path: filepath.Join(app, ".git"), Mode: config.GitModeRemove}}
+	if !reflect.DeepEqual(plan.GitDirs, wantGit) {
+		t.Errorf("GitDirs = %+v, want %+v", plan.GitDirs, wantGit)
+	}
+	if !reflect.DeepEqual(plan.Skipped, []string{".missing"}) {
+		t.Errorf("Skipped = %v", plan.Skipped)
+	}
+
+	if after := treeState(t, tmpDir); !reflect.DeepEqual(before, after) {
+		t.Error("Plan() should not touch the vault or home")
+	}
+
+	// The plan matches what the copy then does
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if result.FilesUpdated != 3 || result.FilesRemoved != 1 {
+		t.Errorf("Copy() = %d updated, %d removed; plan said 3 and 1", result.FilesUpdated, result.FilesRemoved)
+	}
+}
+
+func TestCopyPlanQuarantine(t *testing.T) {
+	copier, vaultDir := newSecretsTestCopier(t, config.SecretsQuarantine)
+
+	plan, err := copier.Plan()
+	if err != nil {
+		t.Fatalf("Plan() error: %v", err)
+	}
+	if len(plan.Findings) != 1 || len(plan.Quarantined) != 1 {
+		t.Fatalf("plan findings = %v, quarantined = %v", plan.Findings, plan.Quarantined)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Path != filepath.Join(".kube", "kubectx") {
+		t.Errorf("Changes = %+v, want only the clean file", plan.Changes)
+	}
+	if _, err := os.Stat(filepath.Join(copier.snapfigDir, quarantineDirname)); !os.IsNotExist(err) {
+		t.Error("Plan() should not quarantine files")
+	}
+	if _, err := os.Stat(vaultDir); !os.IsNotExist(err) {
+		t.Error("Plan() should not create the vault")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KB",
+		5 * 1024 * 1024: "5.0 MB",
+	}
+	for n, want := range tests {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
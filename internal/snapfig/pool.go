@@ -0,0 +1,114 @@
+package snapfig
+
+import "sync"
+
+// workQueue runs file jobs on a bounded number of goroutines while the
+// caller keeps walking the tree. Each job fills its own result, and the
+// results are merged in submission order once all jobs are done, so
+// counts, output order and the error reported do not depend on scheduling.
+// What the walk itself records goes to walked, and is merged in walk
+// order between the jobs. Once a job fails, no more jobs are queued.
+type workQueue[R any] struct {
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	jobs   []*job[R]
+	after  []func() error
+	walked R
+
+	mu     sync.Mutex
+	failed error // of the first job that failed
+}
+
+type job[R any] struct {
+	result R
+	err    error
+}
+
+func newWorkQueue[R any](workers int) *workQueue[R] {
+	if workers < 1 {
+		workers = 1
+	}
+	return &workQueue[R]{sem: make(chan struct{}, workers)}
+}
+
+// submit queues fn, blocking while all workers are busy. What the walk
+// recorded since the previous job is queued ahead of it as a done job.
+// Once a job has failed, fn is not queued and that error is returned,
+// for the walk to stop; jobs queued before the failure and not yet
+// started are skipped.
+func (q *workQueue[R]) submit(fn func(*R) error) error {
+	if err := q.failure(); err != nil {
+		return err
+	}
+
+	var zero R
+	q.jobs = append(q.jobs, &job[R]{result: q.walked})
+	q.walked = zero
+
+	j := &job[R]{}
+	q.jobs = append(q.jobs, j)
+
+	q.sem <- struct{}{}
+	q.wg.Add(1)
+	go func() {
+		defer func() {
+			<-q.sem
+			q.wg.Done()
+		}()
+		if j.err = q.failure(); j.err != nil {
+			return
+		}
+		if j.err = fn(&j.result); j.err != nil {
+			q.fail(j.err)
+		}
+	}()
+	return nil
+}
+
+// fail records err as a job failure, keeping the first one.
+func (q *workQueue[R]) fail(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.failed == nil {
+		q.failed = err
+	}
+}
+
+// failure returns the error of the first job that failed, if any.
+// A nil queue has none.
+func (q *workQueue[R]) failure() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.failed
+}
+
+// then registers fn to run once all jobs are done. These run in reverse
+// order of registration, so work registered for a directory before
+// walking into it runs after the same work for its subdirectories.
+func (q *workQueue[R]) then(fn func() error) {
+	q.after = append(q.after, fn)
+}
+
+// wait blocks until all jobs are done and merges their results in
+// submission order. It returns the error of the first failed job in that
+// order; the results of jobs before it are merged.
+func (q *workQueue[R]) wait(merge func(*R)) error {
+	q.wg.Wait()
+
+	for _, j := range q.jobs {
+		if j.err != nil {
+			return j.err
+		}
+		merge(&j.result)
+	}
+	merge(&q.walked)
+	for i := len(q.after) - 1; i >= 0; i-- {
+		if err := q.after[i](); err != nil {
+			return err
+		}
+	}
+	return nil
+}
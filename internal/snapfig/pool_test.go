@@ -0,0 +1,354 @@
+package snapfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestWorkQueueOrder(t *testing.T) {
+	q := newWorkQueue[[]int](4)
+	for i := 0; i < 20; i++ {
+		q.submit(func(r *[]int) error {
+			// Later jobs finish first
+			time.Sleep(time.Duration(20-i) * time.Millisecond / 4)
+			*r = append(*r, i)
+			return nil
+		})
+	}
+
+	var after []string
+	q.then(func() error { after = append(after, "parent"); return nil })
+	q.then(func() error { after = append(after, "child"); return nil })
+
+	var got []int
+	if err := q.wait(func(r *[]int) { got = append(got, *r...) }); err != nil {
+		t.Fatalf("wait() error: %v", err)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("merged order = %v, want submission order", got)
+		}
+	}
+	if !reflect.DeepEqual(after, []string{"child", "parent"}) {
+		t.Errorf("after order = %v, want child first", after)
+	}
+}
+
+func TestWorkQueueFirstError(t *testing.T) {
+	q := newWorkQueue[int](4)
+	for i := 0; i < 10; i++ {
+		q.submit(func(r *int) error {
+			if i >= 3 {
+				time.Sleep(time.Duration(10-i) * time.Millisecond)
+				return fmt.Errorf("job %d", i)
+			}
+			*r = 1
+			return nil
+		})
+	}
+
+	merged := 0
+	err := q.wait(func(r *int) { merged += *r })
+	if err == nil || err.Error() != "job 3" {
+		t.Errorf("wait() error = %v, want first in submission order", err)
+	}
+	if merged != 3 {
+		t.Errorf("merged %d results, want the 3 before the error", merged)
+	}
+}
+
+func TestWorkQueueWalkOrder(t *testing.T) {
+	q := newWorkQueue[[]string](4)
+	for i := 0; i < 5; i++ {
+		q.walked = append(q.walked, fmt.Sprintf("walk %d", i))
+		q.submit(func(r *[]string) error {
+			time.Sleep(time.Duration(5-i) * time.Millisecond)
+			*r = append(*r, fmt.Sprintf("job %d", i))
+			return nil
+		})
+	}
+	q.walked = append(q.walked, "walk end")
+
+	var got []string
+	if err := q.wait(func(r *[]string) { got = append(got, *r...) }); err != nil {
+		t.Fatalf("wait() error: %v", err)
+	}
+	want := []string{"walk 0", "job 0", "walk 1", "job 1", "walk 2", "job 2", "walk 3", "job 3", "walk 4", "job 4", "walk end"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged order = %v, want %v", got, want)
+	}
+}
+
+func TestRestoreBackupsInWalkOrder(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	vaultSubDir := filepath.Join(vaultDir, ".config", "app")
+	homeSubDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(vaultSubDir, 0755)
+	os.MkdirAll(homeSubDir, 0755)
+
+	// Files restored on the workers around a link restored by the walk
+	os.WriteFile(filepath.Join(vaultSubDir, "a.conf"), []byte("vault"), 0644)
+	marker, _ := newSymlinkMarker("b", tmpDir, 0).encode()
+	os.WriteFile(filepath.Join(vaultSubDir, "b"+symlinkMarkerExt), marker, 0644)
+	os.WriteFile(filepath.Join(vaultSubDir, "c.conf"), []byte("vault"), 0644)
+	for _, name := range []string{"a.conf", "b", "c.conf"} {
+		os.WriteFile(filepath.Join(homeSubDir, name), []byte("local"), 0644)
+	}
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	store := &backupStore{location: config.BackupsBeside, home: homeDir, keep: 2, stamp: "202601021504"}
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), backups: store, workers: 4}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	var got []string
+	for _, b := range result.Backups {
+		got = append(got, filepath.Base(b[:strings.Index(b, " -> ")]))
+	}
+	if want := []string{"a.conf", "b", "c.conf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Backups = %v, want walk order %v", result.Backups, want)
+	}
+}
+
+func TestWorkQueueStopsAfterFailure(t *testing.T) {
+	q := newWorkQueue[int](1)
+	if err := q.submit(func(r *int) error { return errors.New("job 0") }); err != nil {
+		t.Fatalf("submit() error: %v", err)
+	}
+	q.wg.Wait()
+
+	ran := false
+	if err := q.submit(func(r *int) error { ran = true; return nil }); err == nil || err.Error() != "job 0" {
+		t.Errorf("submit() after a failure error = %v, want the failure", err)
+	}
+	if err := q.wait(func(r *int) {}); err == nil || err.Error() != "job 0" {
+		t.Errorf("wait() error = %v, want job 0", err)
+	}
+	if ran {
+		t.Error("no job should run after a failure")
+	}
+}
+
+func TestCopyStopsWalkOnFailedFile(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	writeTree(t, filepath.Join(homeDir, ".config", "app"), 3, 5)
+
+	// The first file cannot be copied, its vault copy being in the way
+	blocker := filepath.Join(vaultDir, ".config", "app", "dir000", "file000.conf")
+	os.MkdirAll(blocker, 0755)
+	os.WriteFile(filepath.Join(blocker, "in-the-way"), []byte("x"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, workers: 1}
+	if _, err := copier.Copy(); err == nil {
+		t.Fatal("Copy() should fail")
+	}
+
+	for _, rel := range []string{"dir000/file001.conf", "dir001", "dir002"} {
+		if _, err := os.Stat(filepath.Join(vaultDir, ".config", "app", rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be copied after the failure", rel)
+		}
+	}
+}
+
+// writeTree creates dirs*files small files under root,
+// every tenth one with a suspected secret.
+func writeTree(tb testing.TB, root string, dirs, files int) {
+	tb.Helper()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%03d", d))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			content := fmt.Sprintf("setting_%d_%d = value\n", d, f)
+			if (d*files+f)%10 == 0 {
+				content += "token: ghp_" + fmt.Sprintf("%036d", d*files+f) + "\n"
+			}
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.conf", f)), []byte(content), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestParallelCopyRestoreDeterministic(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	writeTree(t, filepath.Join(homeDir, ".config", "app"), 10, 20)
+
+	run := func(workers int) (*CopyResult, *RestoreResult) {
+		vaultDir := filepath.Join(tmpDir, fmt.Sprintf("vault-%d", workers))
+		cfg := &config.Config{
+			Git:       config.GitModeDisable,
+			VaultPath: vaultDir,
+			Watching:  []config.Watched{{Path: ".config/app", Enabled: true}},
+		}
+		copier := &Copier{
+			cfg:        cfg,
+			home:       homeDir,
+			vaultDir:   vaultDir,
+			snapfigDir: tmpDir,
+			scanner:    &secretScanner{policy: config.SecretsWarn},
+			workers:    workers,
+		}
+
+		// A stale vault file is removed whatever the worker count
+		stale := filepath.Join(vaultDir, ".config", "app", "dir000", "gone.conf")
+		os.MkdirAll(filepath.Dir(stale), 0755)
+		os.WriteFile(stale, []byte("old"), 0644)
+
+		copyResult, err := copier.Copy()
+		if err != nil {
+			t.Fatalf("Copy(workers=%d) error: %v", workers, err)
+		}
+		if _, err := os.Stat(stale); !os.IsNotExist(err) {
+			t.Errorf("workers=%d: stale file not removed", workers)
+		}
+
+		restorer := &Restorer{
+			cfg:      cfg,
+			home:     filepath.Join(tmpDir, fmt.Sprintf("restore-%d", workers)),
+			vaultDir: vaultDir,
+			workers:  workers,
+		}
+		restoreResult, err := restorer.Restore()
+		if err != nil {
+			t.Fatalf("Restore(workers=%d) error: %v", workers, err)
+		}
+		return copyResult, restoreResult
+	}
+
+	seqCopy, seqRestore := run(1)
+	parCopy, parRestore := run(8)
+
+	if seqCopy.FilesUpdated != 200 || seqCopy.FilesRemoved != 1 || len(seqCopy.Findings) < 20 {
+		t.Errorf("sequential copy = %d updated, %d removed, %d findings; want 200, 1, at least 20",
+			seqCopy.FilesUpdated, seqCopy.FilesRemoved, len(seqCopy.Findings))
+	}
+	if !reflect.DeepEqual(seqCopy, parCopy) {
+		t.Errorf("parallel copy result differs:\n seq %+v\n par %+v", seqCopy, parCopy)
+	}
+	if seqRestore.FilesUpdated != 200 || !reflect.DeepEqual(seqRestore, parRestore) {
+		t.Errorf("restore results = %+v and %+v, want equal with 200 updated", seqRestore, parRestore)
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "restore-8", ".config", "app", "dir009", "file019.conf"))
+	if err != nil || string(got) != "setting_9_19 = value\n" {
+		t.Errorf("restored file = %q, %v", got, err)
+	}
+}
+
+func TestParallelRestoreReportsFileError(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	writeTree(t, filepath.Join(vaultDir, ".config", "app"), 2, 10)
+
+	// A directory where a file should go fails that file's job
+	homeDir := filepath.Join(tmpDir, "home")
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app", "dir001", "file005.conf", "x"), 0755)
+
+	cfg := &config.Config{
+		Git:      config.GitModeDisable,
+		Watching: []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir, workers: 4}
+	_, err := restorer.Restore()
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	if !errors.As(err, &pathErr) && !errors.As(err, &linkErr) {
+		t.Errorf("Restore() error = %v, want the failed file's error", err)
+	}
+}
+
+func benchmarkTree(b *testing.B) (homeDir, tmpDir string) {
+	tmpDir = b.TempDir()
+	homeDir = filepath.Join(tmpDir, "home")
+	writeTree(b, filepath.Join(homeDir, ".config", "app"), 50, 40)
+	return homeDir, tmpDir
+}
+
+// BenchmarkCopy copies 2000 small files into an empty vault.
+func BenchmarkCopy(b *testing.B) {
+	homeDir, tmpDir := benchmarkTree(b)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := &config.Config{
+				Git:      config.GitModeDisable,
+				Watching: []config.Watched{{Path: ".config/app", Enabled: true}},
+			}
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				vaultDir := filepath.Join(tmpDir, "vault")
+				os.RemoveAll(vaultDir)
+				copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, workers: workers}
+				b.StartTimer()
+
+				// Copy itself also commits; time the file work only
+				copier.queue = newWorkQueue[CopyResult](workers)
+				result := &CopyResult{}
+				err := copier.copyPath(filepath.Join(homeDir, ".config", "app"), filepath.Join(vaultDir, ".config", "app"),
+					newWalkSpec(cfg, cfg.Watching[0], homeDir), result)
+				if err := copier.finish(err, result); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRestore restores 2000 small files into an empty home.
+func BenchmarkRestore(b *testing.B) {
+	homeDir, tmpDir := benchmarkTree(b)
+	vaultDir := filepath.Join(tmpDir, "vault")
+	if err := os.CopyFS(filepath.Join(vaultDir, ".config", "app"), os.DirFS(filepath.Join(homeDir, ".config", "app"))); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := &config.Config{
+				Git:      config.GitModeDisable,
+				Watching: []config.Watched{{Path: ".config/app", Enabled: true}},
+			}
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				restoreHome := filepath.Join(tmpDir, "restore")
+				os.RemoveAll(restoreHome)
+				restorer := &Restorer{cfg: cfg, home: restoreHome, vaultDir: vaultDir, workers: workers}
+				b.StartTimer()
+
+				if _, err := restorer.Restore(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package snapfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// privilegeHelper runs commands through the prefix configured to write
+// files the user cannot, e.g. "sudo" or "doas -n".
+type privilegeHelper struct {
+	mu   sync.Mutex // one command at a time, so a password is asked once
+	argv []string
+}
+
+// newPrivilegeHelper returns nil when no helper is configured.
+func newPrivilegeHelper(command string) *privilegeHelper {
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		return nil
+	}
+	return &privilegeHelper{argv: argv}
+}
+
+// run executes args through the helper, feeding it stdin if not nil.
+func (h *privilegeHelper) run(stdin io.Reader, args ...string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	name := h.argv[0]
+	argv := append(append([]string{}, h.argv[1:]...), args...)
+	cmd := exec.Command(name, argv...)
+	cmd.Stdin = stdin
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s %s: %w: %s", name, args[0], err, msg)
+		}
+		return fmt.Errorf("%s %s: %w", name, args[0], err)
+	}
+	return nil
+}
+
+// permissionError explains how to get past a permission error on restore.
+// The error still matches fs.ErrPermission.
+func permissionError(err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w (set privilege_helper in the config to write it)", err)
+	}
+	return err
+}
+
+// elevate retries an operation that failed for lack of permission
+// as args run through the privilege helper, if one is configured.
+func (r *Restorer) elevate(err error, args ...string) error {
+	if errors.Is(err, fs.ErrPermission) && r.helper != nil {
+		return r.helper.run(nil, args...)
+	}
+	return permissionError(err)
+}
+
+// mkdirAll creates dir, falling back to the privilege helper
+// when the user cannot.
+func (r *Restorer) mkdirAll(dir string, mode os.FileMode) error {
+	return r.elevate(os.MkdirAll(dir, mode), "mkdir", "-p", dir)
+}
+
+// writeFile writes src to dst with mode, and sets its mtime unless zero.
+// The content goes through a temporary file renamed over dst, so a failed
+// write leaves the old file intact. A symlink at dst is written through,
+// and an existing file keeps its owner where the user may set it.
+// Targets the user cannot write are written through the privilege helper;
+// without one, a permission error is returned and dst is left as it is,
+// even when the file itself is writable: rewriting it in place would not
+// be atomic.
+func (r *Restorer) writeFile(dst string, src io.Reader, mode os.FileMode, mtime time.Time) error {
+	if err := r.mkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if real, err := filepath.EvalSymlinks(dst); err == nil {
+		dst = real
+	}
+	existing, statErr := os.Stat(dst)
+
+	f, err := createAtomic(dst)
+	if errors.Is(err, fs.ErrPermission) && r.helper != nil {
+		return r.writeElevated(dst, src, mode, mtime)
+	}
+	if err != nil {
+		return permissionError(err)
+	}
+
+	if _, err := io.Copy(f, src); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.commit(mode); err != nil {
+		return err
+	}
+	if statErr == nil {
+		if uid, gid, ok := fileOwner(existing); ok && uid != os.Geteuid() {
+			os.Lchown(dst, uid, gid)
+		}
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(dst, mtime, mtime); err != nil {
+			return permissionError(err)
+		}
+	}
+	return nil
+}
+
+// writeElevated writes dst through the privilege helper: tee into a
+// temporary file next to it, then mv over dst. The owner is set back
+// from the metadata sidecar afterwards.
+func (r *Restorer) writeElevated(dst string, src io.Reader, mode os.FileMode, mtime time.Time) error {
+	tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s%s%d", filepath.Base(dst), atomicTempInfix, os.Getpid()))
+
+	err := r.helper.run(src, "tee", tmp)
+	if err == nil {
+		err = r.helper.run(nil, "chmod", fmt.Sprintf("%o", mode.Perm()), tmp)
+	}
+	if err == nil && !mtime.IsZero() {
+		err = r.helper.run(nil, "touch", "-t", mtime.Local().Format("200601021504.05"), tmp)
+	}
+	if err == nil {
+		err = r.helper.run(nil, "mv", "-f", tmp, dst)
+	}
+	if err != nil {
+		r.helper.run(nil, "rm", "-f", tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package snapfig
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases of an operation reported in Progress.
+const (
+	PhaseCopying    = "copying"
+	PhaseRestoring  = "restoring"
+	PhaseCommitting = "committing"
+	PhasePushing    = "pushing"
+	PhasePulling    = "pulling"
+	PhaseCloning    = "cloning"
+)
+
+// progressInterval throttles reports that only update file counts.
+const progressInterval = 100 * time.Millisecond
+
+// Progress reports how far a copy, restore, push or pull got.
+type Progress struct {
+	Operation    string // copy, restore, push or pull
+	Phase        string // one of the Phase constants
+	Path         string // watched path being processed
+	PathsDone    int
+	PathsTotal   int
+	FilesScanned int   // files compared so far
+	FilesWritten int   // files written so far
+	Bytes        int64 // size of the files written
+}
+
+// ProgressFunc receives the progress of an operation. Reports are
+// delivered one at a time, from the goroutines doing the work, so the
+// func must not block for long.
+type ProgressFunc func(Progress)
+
+// Fraction returns the share of watched paths done, from 0 to 1.
+// It is false for phases without a known total, such as git ones.
+func (p Progress) Fraction() (float64, bool) {
+	if p.PathsTotal == 0 || (p.Phase != PhaseCopying && p.Phase != PhaseRestoring) {
+		return 0, false
+	}
+	return float64(p.PathsDone) / float64(p.PathsTotal), true
+}
+
+// String renders the progress on one line, e.g.
+// "Copying .config/nvim: 3/8 paths, 120 files, 14 written (2.1 KB)".
+func (p Progress) String() string {
+	s := p.Phase
+	if s != "" {
+		s = strings.ToUpper(s[:1]) + s[1:]
+	}
+	if p.Phase != PhaseCopying && p.Phase != PhaseRestoring {
+		return s + "..."
+	}
+	if p.Path != "" {
+		s += " " + p.Path
+	}
+	return fmt.Sprintf("%s: %d/%d paths, %d files, %d written (%s)",
+		s, p.PathsDone, p.PathsTotal, p.FilesScanned, p.FilesWritten, FormatSize(p.Bytes))
+}
+
+// progressReporter tracks an operation and reports it to a ProgressFunc.
+// A nil *progressReporter reports nothing.
+type progressReporter struct {
+	fn    ProgressFunc
+	mu    sync.Mutex
+	state Progress
+	last  time.Time
+}
+
+// newProgress returns a reporter for operation, nil when fn is nil.
+func newProgress(fn ProgressFunc, operation string) *progressReporter {
+	if fn == nil {
+		return nil
+	}
+	return &progressReporter{fn: fn, state: Progress{Operation: operation}}
+}
+
+// phase reports the start of a phase.
+func (p *progressReporter) phase(phase string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Phase = phase
+	p.emit(true)
+}
+
+// path reports the watched path being processed, done of total so far.
+func (p *progressReporter) path(path string, done, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Path = path
+	p.state.PathsDone = done
+	p.state.PathsTotal = total
+	p.emit(true)
+}
+
+// file counts a file compared, and written when size bytes were.
+// Safe to call from the worker pool.
+func (p *progressReporter) file(written bool, size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.FilesScanned++
+	if written {
+		p.state.FilesWritten++
+		p.state.Bytes += size
+	}
+	p.emit(false)
+}
+
+// emit calls fn with the state, at most once per progressInterval
+// unless forced. The caller holds mu.
+func (p *progressReporter) emit(force bool) {
+	now := time.Now()
+	if !force && now.Sub(p.last) < progressInterval {
+		return
+	}
+	p.last = now
+	p.fn(p.state)
+}
@@ -0,0 +1,153 @@
+package snapfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestProgressString(t *testing.T) {
+	p := Progress{Phase: PhaseCopying, Path: ".config/nvim", PathsDone: 3, PathsTotal: 8, FilesScanned: 120, FilesWritten: 14, Bytes: 2150}
+	want := "Copying .config/nvim: 3/8 paths, 120 files, 14 written (2.1 KB)"
+	if got := p.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (Progress{Phase: PhasePushing}).String(); got != "Pushing..." {
+		t.Errorf("String() = %q for a git phase", got)
+	}
+}
+
+func TestProgressFraction(t *testing.T) {
+	if f, ok := (Progress{Phase: PhaseRestoring, PathsDone: 1, PathsTotal: 4}).Fraction(); !ok || f != 0.25 {
+		t.Errorf("Fraction() = %v, %v; want 0.25, true", f, ok)
+	}
+	if _, ok := (Progress{Phase: PhasePulling}).Fraction(); ok {
+		t.Error("a git phase has no known fraction")
+	}
+}
+
+func TestCopyContextReportsProgress(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "a"), []byte("aaaa"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "b"), []byte("bb"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bash"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+			{Path: ".bashrc", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), workers: 2}
+
+	var reports []Progress
+	if _, err := copier.CopyContext(context.Background(), func(p Progress) { reports = append(reports, p) }); err != nil {
+		t.Fatalf("CopyContext() error: %v", err)
+	}
+
+	var phases []string
+	for _, p := range reports {
+		if p.Operation != "copy" {
+			t.Errorf("report operation = %q, want copy", p.Operation)
+		}
+		if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+			phases = append(phases, p.Phase)
+		}
+	}
+	if !slices.Equal(phases, []string{PhaseCopying, PhaseCommitting}) {
+		t.Errorf("phases = %v", phases)
+	}
+
+	last := reports[len(reports)-1]
+	if last.PathsDone != 2 || last.PathsTotal != 2 {
+		t.Errorf("paths = %d/%d, want 2/2", last.PathsDone, last.PathsTotal)
+	}
+	if last.FilesScanned != 3 || last.FilesWritten != 3 || last.Bytes != 10 {
+		t.Errorf("last report = %+v, want 3 files, 10 bytes written", last)
+	}
+}
+
+func TestCopyContextCancelled(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "config"), []byte("v1"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("v1"), 0644)
+
+	cfg := &config.Config{
+		Git:           config.GitModeDisable,
+		VaultPath:     vaultDir,
+		Transactional: true,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+			{Path: ".bashrc", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	commits := commitCount(t, vaultDir)
+
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "config"), []byte("v2"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("v2"), 0644)
+
+	// Cancel once the second path starts
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := copier.CopyContext(ctx, func(p Progress) {
+		if p.PathsDone == 1 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyContext() error = %v, want context.Canceled", err)
+	}
+
+	for _, name := range []string{".config/app/config", ".bashrc"} {
+		data, _ := os.ReadFile(filepath.Join(vaultDir, name))
+		if string(data) != "v1" {
+			t.Errorf("%s = %q, a cancelled transactional copy should leave the vault as it was", name, data)
+		}
+	}
+	if _, err := os.Stat(stagingDir(vaultDir)); !os.IsNotExist(err) {
+		t.Error("staging directory should be removed")
+	}
+	if got := commitCount(t, vaultDir); got != commits {
+		t.Errorf("commits = %d, want %d", got, commits)
+	}
+	assertNoTemps(t, vaultDir)
+}
+
+func TestRestoreContextCancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(vaultDir, 0755)
+	os.WriteFile(filepath.Join(vaultDir, ".bashrc"), []byte("bash"), 0644)
+
+	cfg := &config.Config{VaultPath: vaultDir, Watching: []config.Watched{{Path: ".bashrc", Enabled: true}}}
+	restorer := &Restorer{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := restorer.RestoreContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RestoreContext() error = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".bashrc")); !os.IsNotExist(err) {
+		t.Error("a cancelled restore should not write files")
+	}
+}
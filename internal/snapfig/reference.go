@@ -0,0 +1,270 @@
+package snapfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// gitDiffName holds the uncommitted changes of a nested repository
+// stored by the reference git mode, next to its working tree in the vault.
+const gitDiffName = ".snapfig-git.diff"
+
+// RepoRef is a nested repository stored by the reference git mode:
+// restore clones it again instead of the vault keeping its .git.
+type RepoRef struct {
+	Path   string `yaml:"path"`             // repository, as a watched path
+	Remote string `yaml:"remote"`           // URL it is cloned from
+	Branch string `yaml:"branch,omitempty"` // empty when HEAD is detached
+	Commit string `yaml:"commit"`
+}
+
+// isGitStoreFile reports whether name is one of the files a nested
+// repository is stored as, plain or encrypted. They are restored with
+// their directory, never as files.
+func isGitStoreFile(name string) bool {
+	return isGitBundleFile(name) || plainRel(name) == gitDiffName
+}
+
+// readRepoRef reads where the repository at gitDir can be cloned from
+// and what is checked out: origin, or else the first remote, and HEAD.
+// It is false for a repository that cannot be cloned again, without
+// a remote or a commit.
+func readRepoRef(gitDir string) (RepoRef, bool) {
+	var ref RepoRef
+	if url, err := gitOutput(gitDir, "config", "--get", "remote.origin.url"); err == nil {
+		ref.Remote = url
+	} else if state, err := readGitState(gitDir); err == nil && len(state.Remotes) > 0 {
+		ref.Remote = state.Remotes[0].URL
+	}
+	ref.Commit, _ = gitOutput(gitDir, "rev-parse", "-q", "--verify", "HEAD")
+	ref.Branch, _ = gitOutput(gitDir, "symbolic-ref", "-q", "--short", "HEAD")
+	return ref, ref.Remote != "" && ref.Commit != ""
+}
+
+// copyGitReference records the repository at gitDir for the manifest
+// instead of copying its .git, and stores its uncommitted changes to
+// tracked files in dst as a binary diff. Untracked files are part of the
+// working tree copy. A repository that cannot be cloned again is kept
+// as its working tree alone.
+func (c *Copier) copyGitReference(gitDir, dst string, spec *walkSpec, result *CopyResult) error {
+	return c.run(result, gitDir, "reference", func(result *CopyResult) error {
+		diffPath := filepath.Join(dst, gitDiffName+spec.bundleSuffix())
+
+		ref, ok := readRepoRef(gitDir)
+		var diff []byte
+		if ok {
+			ref.Path = displayPath(c.home, filepath.Dir(gitDir))
+			result.repos = append(result.repos, ref)
+
+			// Optional locks off: the source index is never rewritten
+			var err error
+			diff, err = gitRun(gitDir, nil, "--work-tree="+filepath.Dir(gitDir), "--no-optional-locks", "diff", "--binary", "HEAD")
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(diff) == 0 {
+			if _, err := os.Stat(diffPath); err != nil {
+				return nil
+			}
+			if c.dryRun {
+				return c.planRemove(diffPath, result)
+			}
+			if err := os.Remove(diffPath); err != nil {
+				return err
+			}
+			result.FilesRemoved++
+			return nil
+		}
+
+		if existing, err := readVaultFile(c.cipher, diffPath); err == nil && bytes.Equal(existing, diff) {
+			result.FilesSkipped++
+			c.progress.file(false, 0)
+			return nil
+		}
+		if c.dryRun {
+			c.planWrite(diffPath, int64(len(diff)), "", result)
+			return nil
+		}
+
+		content := diff
+		if spec.encrypt {
+			var err error
+			if content, err = c.cipher.encrypt(diff); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(diffPath, content, 0644); err != nil {
+			return err
+		}
+		result.FilesUpdated++
+		c.progress.file(true, int64(len(content)))
+		return nil
+	})
+}
+
+// repoRefs returns the repositories recorded in the manifest by the
+// reference git mode, by the directory they are restored to. Other
+// hosts' layers are left out.
+func (r *Restorer) repoRefs() map[string]RepoRef {
+	refs := make(map[string]RepoRef)
+	manifest, err := LoadManifest(r.vaultDir)
+	if err != nil {
+		return refs
+	}
+	for _, entry := range manifest.Entries {
+		if entry.HostSpecific && entry.Host != "" && entry.Host != r.host {
+			continue
+		}
+		for _, ref := range entry.Repos {
+			refs[sourcePath(r.home, config.Watched{Path: ref.Path})] = ref
+		}
+	}
+	return refs
+}
+
+// restoreGitReference clones the repository recorded for dst into it,
+// checks out the recorded commit and reapplies the uncommitted changes
+// stored in src. It runs before the working tree copy is restored: files
+// the clone already got right are then left as they are, and the copy
+// supplies untracked files. When the clone or checkout fails, dst is left
+// without a .git and is restored from the working tree copy alone; the
+// path is reported in the result. An existing repository is left alone.
+func (r *Restorer) restoreGitReference(src, dst string, ref RepoRef, result *RestoreResult) error {
+	gitDir := filepath.Join(dst, ".git")
+	if _, err := os.Lstat(gitDir); err == nil {
+		return nil
+	}
+
+	if err := r.cloneReference(dst, ref, result); err != nil {
+		os.RemoveAll(gitDir)
+		if cerr := r.cancelled(); cerr != nil {
+			return cerr
+		}
+		result.Unreferenced = append(result.Unreferenced, fmt.Sprintf("%s (%v)", ref.Path, err))
+		return nil
+	}
+	result.FilesUpdated++
+
+	diffPath := filepath.Join(src, gitDiffName)
+	if _, err := os.Stat(diffPath); os.IsNotExist(err) {
+		diffPath += EncryptedExt
+	}
+	if _, err := os.Stat(diffPath); os.IsNotExist(err) {
+		return nil
+	}
+	diff, err := readVaultFile(r.cipher, diffPath)
+	if err != nil {
+		return err
+	}
+	// A diff that no longer applies is not an error: the working tree
+	// copy restored next carries the same changes
+	gitRun(gitDir, diff, "--work-tree="+dst, "apply", "--binary", "--whitespace=nowarn", "-")
+	return nil
+}
+
+// cloneReference clones ref.Remote next to dst, moves its .git into dst
+// and checks out the recorded commit, on the recorded branch if any.
+// Files in dst the checkout overwrites are backed up first. git never
+// prompts: a remote that needs credentials git cannot get on its own
+// fails the clone.
+func (r *Restorer) cloneReference(dst string, ref RepoRef, result *RestoreResult) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".snapfig-clone-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// A remote asking for credentials fails the clone instead of
+	// waiting on a prompt nobody answers
+	clone := exec.CommandContext(r.context(), "git", "clone", "-q", "--no-checkout", ref.Remote, tmp)
+	clone.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	clone.Stdin = nil
+	var stderr bytes.Buffer
+	clone.Stderr = &stderr
+	if err := clone.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("git clone: %s", msg)
+		}
+		return fmt.Errorf("git clone: %w", err)
+	}
+
+	gitDir := filepath.Join(dst, ".git")
+	if err := os.Rename(filepath.Join(tmp, ".git"), gitDir); err != nil {
+		return err
+	}
+
+	if err := r.backupCheckout(gitDir, dst, ref.Commit, result); err != nil {
+		return err
+	}
+
+	checkout := []string{"--work-tree=" + dst, "checkout", "-q", "-f"}
+	if ref.Branch != "" {
+		checkout = append(checkout, "-B", ref.Branch, ref.Commit)
+	} else {
+		checkout = append(checkout, "--detach", ref.Commit)
+	}
+	if _, err := gitOutput(gitDir, checkout...); err != nil {
+		return err
+	}
+	if ref.Branch != "" {
+		// The branch may not exist upstream
+		gitOutput(gitDir, "branch", "-q", "--set-upstream-to=origin/"+ref.Branch, ref.Branch)
+	}
+	return nil
+}
+
+// backupCheckout backs up the files in dst that a checkout of commit
+// would overwrite with other content.
+func (r *Restorer) backupCheckout(gitDir, dst, commit string, result *RestoreResult) error {
+	if r.backups == nil {
+		return nil
+	}
+	out, err := gitRun(gitDir, nil, "ls-tree", "-r", "-z", commit)
+	if err != nil {
+		return err
+	}
+
+	var paths, blobs []string
+	for _, record := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		meta, rel, ok := strings.Cut(record, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 || fields[1] != "blob" || strings.Contains(rel, "\n") {
+			continue
+		}
+		path := filepath.Join(dst, filepath.FromSlash(rel))
+		if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		paths = append(paths, path)
+		blobs = append(blobs, fields[2])
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	out, err = gitRun(gitDir, []byte(strings.Join(paths, "\n")+"\n"), "hash-object", "--no-filters", "--stdin-paths")
+	if err != nil {
+		return err
+	}
+	hashes := strings.Fields(string(out))
+	for i, path := range paths {
+		if i < len(hashes) && hashes[i] == blobs[i] {
+			continue
+		}
+		if err := r.backup(path, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package snapfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// makeClonedRepo creates a bare upstream with one commit and clones it
+// into dir, then commits and pushes on main, edits a tracked file and
+// adds an untracked one. It returns the upstream path.
+func makeClonedRepo(t *testing.T, tmpDir, dir string) string {
+	t.Helper()
+	upstream := filepath.Join(tmpDir, "upstream.git")
+	seed := filepath.Join(tmpDir, "seed")
+	gitIn(t, tmpDir, "init", "-q", "--bare", "-b", "main", upstream)
+	makeNestedRepo(t, seed)
+	gitIn(t, seed, "checkout", "-q", "--", "init.lua")
+	gitIn(t, seed, "push", "-q", upstream, "main")
+
+	os.MkdirAll(filepath.Dir(dir), 0755)
+	gitIn(t, tmpDir, "clone", "-q", upstream, dir)
+	os.WriteFile(filepath.Join(dir, "plugins.lua"), []byte("-- plugins"), 0644)
+	gitIn(t, dir, "add", "plugins.lua")
+	gitIn(t, dir, "commit", "-q", "-m", "local")
+	gitIn(t, dir, "push", "-q")
+	os.WriteFile(filepath.Join(dir, "init.lua"), []byte("-- local edit"), 0644)
+	os.WriteFile(filepath.Join(dir, "scratch.lua"), []byte("-- untracked"), 0644)
+	return upstream
+}
+
+func TestCopyGitReference(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	repo := filepath.Join(homeDir, ".config", "nvim")
+	upstream := makeClonedRepo(t, tmpDir, repo)
+
+	cfg := &config.Config{
+		Git:       config.GitModeReference,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	stored := filepath.Join(vaultDir, ".config", "nvim")
+	if _, err := os.Stat(filepath.Join(stored, ".git")); !os.IsNotExist(err) {
+		t.Error("the .git tree should not be copied in reference mode")
+	}
+	if _, err := os.Stat(filepath.Join(stored, gitDiffName)); err != nil {
+		t.Errorf("uncommitted changes not stored: %v", err)
+	}
+
+	manifest, err := LoadManifest(vaultDir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error: %v", err)
+	}
+	if len(manifest.Entries) != 1 || len(manifest.Entries[0].Repos) != 1 {
+		t.Fatalf("manifest should record one repository, got %+v", manifest.Entries)
+	}
+	ref := manifest.Entries[0].Repos[0]
+	want := RepoRef{Path: ".config/nvim", Remote: upstream, Branch: "main", Commit: gitIn(t, repo, "rev-parse", "HEAD")}
+	if ref != want {
+		t.Errorf("repository = %+v, want %+v", ref, want)
+	}
+
+	// Committing the edit leaves nothing uncommitted
+	gitIn(t, repo, "commit", "-q", "-am", "edit")
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if result.FilesRemoved != 1 {
+		t.Errorf("FilesRemoved = %d, want the stale diff removed", result.FilesRemoved)
+	}
+	if _, err := os.Stat(filepath.Join(stored, gitDiffName)); !os.IsNotExist(err) {
+		t.Error("the diff should be removed once the changes are committed")
+	}
+}
+
+func TestRestoreGitReference(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	repo := filepath.Join(srcHome, ".config", "nvim")
+	makeClonedRepo(t, tmpDir, repo)
+
+	cfg := &config.Config{
+		Git:       config.GitModeReference,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: srcHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	os.MkdirAll(dstHome, 0755)
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result.Unreferenced) != 0 {
+		t.Errorf("Unreferenced = %v, want the repository cloned", result.Unreferenced)
+	}
+
+	restored := filepath.Join(dstHome, ".config", "nvim")
+	if got, want := gitIn(t, restored, "rev-parse", "HEAD"), gitIn(t, repo, "rev-parse", "HEAD"); got != want {
+		t.Errorf("HEAD = %s, want %s", got, want)
+	}
+	if got := gitIn(t, restored, "symbolic-ref", "--short", "HEAD"); got != "main" {
+		t.Errorf("branch = %s, want main", got)
+	}
+	if got, want := gitIn(t, restored, "status", "--porcelain"), gitIn(t, repo, "status", "--porcelain"); got != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(restored, gitDiffName)); !os.IsNotExist(err) {
+		t.Error("the stored diff should not be restored as a file")
+	}
+	entries, _ := os.ReadDir(filepath.Join(dstHome, ".config"))
+	if len(entries) != 1 {
+		t.Errorf("the clone should leave no temporary directory, got %d entries", len(entries))
+	}
+}
+
+func TestRestoreGitReferenceFallback(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	repo := filepath.Join(srcHome, ".config", "nvim")
+	upstream := makeClonedRepo(t, tmpDir, repo)
+
+	cfg := &config.Config{
+		Git:       config.GitModeReference,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: srcHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	// The remote is gone: the working tree copy is restored instead
+	os.RemoveAll(upstream)
+	os.MkdirAll(dstHome, 0755)
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result.Unreferenced) != 1 {
+		t.Errorf("Unreferenced = %v, want the repository reported", result.Unreferenced)
+	}
+
+	restored := filepath.Join(dstHome, ".config", "nvim")
+	if _, err := os.Stat(filepath.Join(restored, ".git")); !os.IsNotExist(err) {
+		t.Error("a failed clone should leave no .git behind")
+	}
+	for name, want := range map[string]string{"init.lua": "-- local edit", "plugins.lua": "-- plugins", "scratch.lua": "-- untracked"} {
+		data, err := os.ReadFile(filepath.Join(restored, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestRestoreGitReferenceNeverPrompts(t *testing.T) {
+	setupTestGitConfig(t)
+
+	// A remote asking for credentials
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	repo := filepath.Join(srcHome, ".config", "nvim")
+	makeClonedRepo(t, tmpDir, repo)
+	gitIn(t, repo, "remote", "set-url", "origin", server.URL+"/nvim.git")
+
+	cfg := &config.Config{
+		Git:       config.GitModeReference,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: srcHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	os.MkdirAll(dstHome, 0755)
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result.Unreferenced) != 1 || !strings.Contains(result.Unreferenced[0], "terminal prompts disabled") {
+		t.Errorf("Unreferenced = %v, want the clone failing without a prompt", result.Unreferenced)
+	}
+}
+
+func TestRestoreGitReferenceBacksUp(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	makeClonedRepo(t, tmpDir, filepath.Join(srcHome, ".config", "nvim"))
+
+	cfg := &config.Config{
+		Git:       config.GitModeReference,
+		VaultPath: vaultDir,
+		Watching:  []config.Watched{{Path: ".config/nvim", Enabled: true}},
+	}
+	copier := &Copier{cfg: cfg, home: srcHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	// A tracked file already there with other content, and one that matches
+	restored := filepath.Join(dstHome, ".config", "nvim")
+	os.MkdirAll(restored, 0755)
+	os.WriteFile(filepath.Join(restored, "init.lua"), []byte("-- mine"), 0644)
+	os.WriteFile(filepath.Join(restored, "plugins.lua"), []byte("-- plugins"), 0644)
+
+	store := &backupStore{location: config.BackupsCentral, dir: filepath.Join(tmpDir, "backups"), home: dstHome, keep: 2, stamp: "202601021504"}
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false), backups: store}
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if len(result.Unreferenced) != 0 {
+		t.Fatalf("Unreferenced = %v, want the repository cloned", result.Unreferenced)
+	}
+
+	if len(result.Backups) != 1 {
+		t.Errorf("Backups = %v, want init.lua only", result.Backups)
+	}
+	data, err := os.ReadFile(filepath.Join(store.dir, store.stamp, ".config", "nvim", "init.lua"))
+	if err != nil || string(data) != "-- mine" {
+		t.Errorf("backup = %q, %v, want the overwritten content", data, err)
+	}
+}
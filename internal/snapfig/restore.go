@@ -2,10 +2,18 @@
 package snapfig
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,17 +24,52 @@ import (
 type RestoreResult struct {
 	Restored     []string
 	Skipped      []string
-	Backups      []string // paths that were backed up before overwrite
+	Backups      []string // files saved before being overwritten, as "path -> backup"
+	Denied       []string // watched paths that could not be written for lack of permission
+	Unreferenced []string // reference repositories not cloned, restored from their working tree copy
+	Kept         []string // directories left where a symlink was stored, its marker restored next to them
+	Diverged     []string // refs of nested repositories kept where the vault's would not fast-forward them
 	FilesUpdated int      // files actually copied (new or changed)
 	FilesSkipped int      // files skipped (unchanged)
+
+	HookErrors []HookError // hooks that failed; the restore went on
+	changed    []string    // watched paths with files written
+}
+
+// add merges the result of a file job, or what the walk recorded
+// between jobs, into r.
+func (r *RestoreResult) add(o *RestoreResult) {
+	r.FilesUpdated += o.FilesUpdated
+	r.FilesSkipped += o.FilesSkipped
+	r.Backups = append(r.Backups, o.Backups...)
+	r.Unreferenced = append(r.Unreferenced, o.Unreferenced...)
+	r.Kept = append(r.Kept, o.Kept...)
+	r.Diverged = append(r.Diverged, o.Diverged...)
+	for _, path := range o.Restored {
+		if !slices.Contains(r.Restored, path) {
+			r.Restored = append(r.Restored, path)
+		}
+	}
 }
 
 // Restorer handles restoring paths from the vault.
 type Restorer struct {
-	cfg        *config.Config
-	home       string
-	vaultDir   string
-	backupTime string
+	cfg       *config.Config
+	home      string
+	vaultDir  string
+	host      string
+	index     *HashIndex
+	meta      *metadataStore
+	cipher    *vaultCipher
+	templates *templateEngine
+	helper    *privilegeHelper
+	hooks     *hookRunner
+	ctx       context.Context   // of the running restore
+	progress  *progressReporter // of the running restore
+	workers   int
+	queue     *workQueue[RestoreResult] // file jobs of the watched path being restored
+	repos     map[string]RepoRef        // reference repositories by destination, of the running restore
+	backups   *backupStore
 }
 
 // NewRestorer creates a new Restorer instance.
@@ -41,66 +84,206 @@ func NewRestorer(cfg *config.Config) (*Restorer, error) {
 		return nil, fmt.Errorf("failed to get vault directory: %w", err)
 	}
 
+	snapfigDir := filepath.Dir(vaultDir)
+
+	host, err := cfg.Host()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	backups, err := newBackupStore(cfg, home, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backups directory: %w", err)
+	}
+
 	return &Restorer{
-		cfg:        cfg,
-		home:       home,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:       cfg,
+		home:      home,
+		vaultDir:  vaultDir,
+		host:      host,
+		index:     LoadHashIndex(IndexPath(snapfigDir, vaultDir)),
+		meta:      loadMetadata(vaultDir, cfg.Metadata.Xattrs),
+		cipher:    newVaultCipher(cfg),
+		templates: newTemplateEngine(cfg, vaultDir, host, home),
+		helper:    newPrivilegeHelper(cfg.PrivilegeHelper),
+		hooks:     newHookRunner(cfg, home),
+		workers:   cfg.EffectiveWorkers(),
+		backups:   backups,
 	}, nil
 }
 
 // Restore copies all enabled watched paths from vault to their original locations.
+// The current host's layer is merged over the shared layer.
 // Uses smart restore: only copies files that have changed (no full backup needed).
+// Glob patterns restore every match found in the vault.
 func (r *Restorer) Restore() (*RestoreResult, error) {
-	result := &RestoreResult{}
+	return r.RestoreContext(context.Background(), nil)
+}
 
-	for _, w := range r.cfg.Watching {
-		if !w.Enabled {
-			continue
+// RestoreContext is Restore reporting its progress to progress, if not nil.
+// Cancelling ctx stops the restore between files and fails it with
+// ctx's error; every file written is whole.
+func (r *Restorer) RestoreContext(ctx context.Context, progress ProgressFunc) (*RestoreResult, error) {
+	return r.withHooks(ctx, progress, r.restoreAll)
+}
+
+// withHooks runs a restore between the pre_restore and post_restore hooks;
+// post_restore only after a restore that did not fail.
+func (r *Restorer) withHooks(ctx context.Context, progress ProgressFunc, restore func() (*RestoreResult, error)) (*RestoreResult, error) {
+	r.ctx = ctx
+	r.progress = newProgress(progress, "restore")
+	r.repos = r.repoRefs()
+	defer func() {
+		r.ctx = nil
+		r.progress = nil
+		r.repos = nil
+	}()
+
+	pre := r.hooks.run(ctx, "pre_restore", r.cfg.Hooks.PreRestore, r.hookEnv("pre", ""))
+
+	result, err := restore()
+	if err != nil {
+		return nil, err
+	}
+	r.backups.prune()
+	if pre != nil {
+		result.HookErrors = append([]HookError{*pre}, result.HookErrors...)
+	}
+	env := r.hookEnv("post", "")
+	env.changed = result.changed
+	if post := r.hooks.run(ctx, "post_restore", r.cfg.Hooks.PostRestore, env); post != nil {
+		result.HookErrors = append(result.HookErrors, *post)
+	}
+	return result, nil
+}
+
+// hookEnv returns the environment of a restore hook.
+func (r *Restorer) hookEnv(phase, path string) hookEnv {
+	return hookEnv{operation: "restore", phase: phase, vaultDir: r.vaultDir, host: r.host, path: path}
+}
+
+// restorePath restores one watched path between its own hooks.
+// post_restore runs when restore wrote files of the path.
+func (r *Restorer) restorePath(w config.Watched, result *RestoreResult, restore func() error) error {
+	if herr := r.hooks.run(r.context(), "pre_restore", w.Hooks.PreRestore, r.hookEnv("pre", w.Path)); herr != nil {
+		result.HookErrors = append(result.HookErrors, *herr)
+	}
+
+	updated := result.FilesUpdated
+	if err := restore(); err != nil {
+		return err
+	}
+	if result.FilesUpdated > updated {
+		result.changed = append(result.changed, w.Path)
+		env := r.hookEnv("post", w.Path)
+		env.changed = []string{w.Path}
+		if herr := r.hooks.run(r.context(), "post_restore", w.Hooks.PostRestore, env); herr != nil {
+			result.HookErrors = append(result.HookErrors, *herr)
 		}
+	}
+	return nil
+}
 
-		srcPath := filepath.Join(r.vaultDir, w.Path)
-		dstPath := filepath.Join(r.home, w.Path)
+// restoreAll restores every enabled watched path.
+func (r *Restorer) restoreAll() (*RestoreResult, error) {
+	result := &RestoreResult{}
 
-		// Check if source exists in vault
-		srcInfo, err := os.Stat(srcPath)
-		if os.IsNotExist(err) {
-			result.Skipped = append(result.Skipped, w.Path)
-			continue
+	matches, unmatched, err := vaultMatches(r.vaultDir, r.host, r.cfg.Watching)
+	if err != nil {
+		return nil, err
+	}
+	result.Skipped = append(result.Skipped, unmatched...)
+
+	r.progress.phase(PhaseRestoring)
+	for i, m := range matches {
+		w := m.Watched
+		if err := r.cancelled(); err != nil {
+			return nil, err
 		}
+		r.progress.path(w.Path, i, len(matches))
+		dstPath := sourcePath(r.home, w)
+
+		// Check if source exists in vault
+		layers, err := vaultLayers(r.vaultDir, r.host, w)
 		if err != nil {
 			return nil, fmt.Errorf("failed to stat vault path %s: %w", w.Path, err)
 		}
+		if len(layers) == 0 {
+			result.Skipped = append(result.Skipped, w.Path)
+			continue
+		}
 
 		// Copy from vault to destination (smart restore - only changed files)
-		gitMode := w.EffectiveGitMode(r.cfg.Git)
-		if srcInfo.IsDir() {
-			if err := r.restoreDir(srcPath, dstPath, gitMode, result); err != nil {
-				return nil, fmt.Errorf("failed to restore %s: %w", w.Path, err)
-			}
-		} else {
-			if err := r.restoreFile(srcPath, dstPath, srcInfo.Mode(), result); err != nil {
-				return nil, fmt.Errorf("failed to restore %s: %w", w.Path, err)
-			}
+		// A path the user cannot write does not stop the others
+		err = r.restorePath(w, result, func() error {
+			r.queue = newWorkQueue[RestoreResult](r.workers)
+			return r.finish(r.restoreLayers(w, layers, dstPath, &r.queue.walked), result)
+		})
+		if errors.Is(err, fs.ErrPermission) {
+			result.Denied = append(result.Denied, w.Path)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", w.Path, err)
 		}
 
 		result.Restored = append(result.Restored, w.Path)
 	}
+	r.progress.path("", len(matches), len(matches))
+
+	r.index.Prune()
+	if err := r.index.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save hash index: %w", err)
+	}
 
 	return result, nil
 }
 
+// restoreLayers restores a watched path from its vault layers.
+// A file comes from the highest-priority layer; a directory is merged,
+// each file taken from the highest layer that has it.
+func (r *Restorer) restoreLayers(w config.Watched, layers []layer, dstPath string, result *RestoreResult) error {
+	if layers[0].info.Mode()&os.ModeSymlink != 0 {
+		return r.restoreLink(layers[0].path, dstPath, result)
+	}
+	if !layers[0].info.IsDir() {
+		spec := newWalkSpec(r.cfg, w, layers[0].path)
+		return r.restoreRegular(layers[0].path, dstPath, layers[0].info.Mode(), spec, result)
+	}
+
+	for i, l := range layers {
+		spec := r.layerSpec(w, layers, i)
+		if err := r.restoreDir(l.path, dstPath, "", spec, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// layerSpec returns the walk spec for layers[i], shadowed by the layers above it.
+func (r *Restorer) layerSpec(w config.Watched, layers []layer, i int) *walkSpec {
+	spec := newWalkSpec(r.cfg, w, layers[i].path)
+	spec.shadows = layerRoots(layers[:i])
+	return spec
+}
+
 // restoreDir recursively copies a directory, reverting .git_disabled to .git.
+// rel is the path of src relative to the watched root, used for filtering.
 // Uses smart restore: only copies files that have changed.
-func (r *Restorer) restoreDir(src, dst string, gitMode config.GitMode, result *RestoreResult) error {
+func (r *Restorer) restoreDir(src, dst, rel string, spec *walkSpec, result *RestoreResult) error {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
+	if err := r.mkdirAll(dst, srcInfo.Mode()); err != nil {
 		return err
 	}
+	if ref, ok := r.repos[dst]; ok {
+		if err := r.restoreGitReference(src, dst, ref, result); err != nil {
+			return err
+		}
+	}
 
 	entries, err := os.ReadDir(src)
 	if err != nil {
@@ -108,9 +291,38 @@ func (r *Restorer) restoreDir(src, dst string, gitMode config.GitMode, result *R
 	}
 
 	for _, entry := range entries {
+		if err := r.cancelled(); err != nil {
+			return err
+		}
 		srcPath := filepath.Join(src, entry.Name())
 		dstName := entry.Name()
+		entryRel := filepath.Join(rel, entry.Name())
 
+		if entry.Name() == keepMarker {
+			continue
+		}
+		// A bundled repository is restored once, from its metadata
+		if isGitStoreFile(entry.Name()) {
+			if plainRel(entry.Name()) == gitBundleMetaName {
+				if err := r.restoreGitBundle(src, dst, result); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if spec.skip(spec.srcRel(entryRel), entry.IsDir()) {
+			continue
+		}
+		if !entry.IsDir() && spec.shadowed(entryRel) {
+			continue
+		}
+
+		if entry.Type()&os.ModeSymlink != 0 {
+			if err := r.restoreLink(srcPath, filepath.Join(dst, entry.Name()), result); err != nil {
+				return err
+			}
+			continue
+		}
 		if strings.HasSuffix(entry.Name(), symlinkMarkerExt) {
 			if err := r.restoreSymlink(srcPath, dst, result); err != nil {
 				return err
@@ -119,14 +331,14 @@ func (r *Restorer) restoreDir(src, dst string, gitMode config.GitMode, result *R
 		}
 
 		// Revert .git_disabled back to .git
-		if entry.Name() == ".git_disabled" && entry.IsDir() && gitMode == config.GitModeDisable {
+		if entry.Name() == ".git_disabled" && entry.IsDir() && spec.gitMode == config.GitModeDisable {
 			dstName = ".git"
 		}
 
 		dstPath := filepath.Join(dst, dstName)
 
 		if entry.IsDir() {
-			if err := r.restoreDir(srcPath, dstPath, gitMode, result); err != nil {
+			if err := r.restoreDir(srcPath, dstPath, entryRel, spec, result); err != nil {
 				return err
 			}
 		} else {
@@ -134,19 +346,77 @@ func (r *Restorer) restoreDir(src, dst string, gitMode config.GitMode, result *R
 			if err != nil {
 				return err
 			}
-			if err := r.restoreFile(srcPath, dstPath, info.Mode(), result); err != nil {
+			if err := r.restoreRegular(srcPath, dstPath, info.Mode(), spec, result); err != nil {
 				return err
 			}
 		}
 	}
 
+	// Applied last: writing the entries changes the directory's mtime
+	if meta, ok := r.meta.lookup(src); ok {
+		return r.after(func() error { return r.applyMetadata(dst, meta) })
+	}
+	return nil
+}
+
+// run executes a file job: on the worker pool while a watched path is
+// being restored, inline otherwise. Jobs queued when the restore is
+// cancelled do nothing.
+func (r *Restorer) run(result *RestoreResult, fn func(*RestoreResult) error) error {
+	job := func(result *RestoreResult) error {
+		if err := r.cancelled(); err != nil {
+			return err
+		}
+		return fn(result)
+	}
+	if r.queue == nil {
+		return job(result)
+	}
+	return r.queue.submit(job)
+}
+
+// context returns the context of the running restore.
+func (r *Restorer) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// cancelled returns the error of the running restore's context, if done.
+func (r *Restorer) cancelled() error {
+	return r.context().Err()
+}
+
+// after runs fn once the queued file jobs are done, or right away
+// without a queue.
+func (r *Restorer) after(fn func() error) error {
+	if r.queue == nil {
+		return fn()
+	}
+	r.queue.then(fn)
 	return nil
 }
 
-// shouldRestore checks if a file needs to be restored by comparing Size and ModTime.
-// Unlike shouldCopy (for backup), this copies if files differ in ANY way,
-// since the vault is the source of truth during restore.
-func shouldRestore(src, dst string) (bool, error) {
+// finish waits for the file jobs of the watched path being restored and
+// merges their results in walk order. A walk error takes precedence.
+func (r *Restorer) finish(walkErr error, result *RestoreResult) error {
+	q := r.queue
+	r.queue = nil
+	if q == nil {
+		return walkErr
+	}
+	if err := q.wait(result.add); walkErr == nil {
+		return err
+	}
+	return walkErr
+}
+
+// shouldRestore checks if a file needs to be restored by comparing content.
+// The vault is the source of truth during restore, so any content difference
+// triggers a copy. Mtimes are not trusted on their own: git does not preserve
+// them, and a fresh clone would otherwise look entirely changed.
+func shouldRestore(idx *HashIndex, src, dst string) (bool, error) {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return false, err
@@ -160,22 +430,93 @@ func shouldRestore(src, dst string) (bool, error) {
 		return false, err
 	}
 
-	// Restore if size differs
-	if srcInfo.Size() != dstInfo.Size() {
-		return true, nil
+	return contentDiffers(idx, src, srcInfo, dst, dstInfo)
+}
+
+// restoreRegular restores one vault file, rendering template sources,
+// then reapplies the metadata recorded for it on copy.
+// A .tmpl marker file is restored as is and rendered next to itself, so
+// the next copy backs up the template and not its output. In a path
+// flagged as template only the output is written: the source lives in the vault.
+// Runs on the worker pool while a watched path is being restored.
+func (r *Restorer) restoreRegular(src, dst string, mode os.FileMode, spec *walkSpec, result *RestoreResult) error {
+	return r.run(result, func(result *RestoreResult) error {
+		updated := result.FilesUpdated
+		if err := r.restoreRegularJob(src, dst, mode, spec, result); err != nil {
+			return err
+		}
+		written, size := result.FilesUpdated > updated, int64(0)
+		if info, err := os.Stat(src); written && err == nil {
+			size = info.Size()
+		}
+		r.progress.file(written, size)
+		return nil
+	})
+}
+
+// restoreRegularJob does the work of restoreRegular on a worker.
+func (r *Restorer) restoreRegularJob(src, dst string, mode os.FileMode, spec *walkSpec, result *RestoreResult) error {
+	meta, hasMeta := r.meta.lookup(src)
+	if perm, ok := meta.perm(); ok {
+		mode = perm
 	}
-	// Restore if ModTime differs (in either direction)
-	if !srcInfo.ModTime().Equal(dstInfo.ModTime()) {
-		return true, nil
+
+	out := plainRel(dst)
+	var err error
+	switch {
+	case !isTemplate(src):
+		err = r.restoreFile(src, dst, mode, result)
+	case spec.template:
+		out = renderedName(dst)
+		err = r.renderTemplate(src, out, mode, result)
+	default:
+		if err = r.restoreFile(src, dst, mode, result); err == nil {
+			err = r.renderTemplate(src, renderedName(dst), mode, result)
+		}
+	}
+	if err != nil || !hasMeta {
+		return err
+	}
+	return r.applyMetadata(out, meta)
+}
+
+// renderTemplate renders a vault template to dst.
+// The output is only written when it differs from what is there.
+func (r *Restorer) renderTemplate(src, dst string, mode os.FileMode, result *RestoreResult) error {
+	content, err := readVaultFile(r.cipher, src)
+	if err != nil {
+		return err
+	}
+	out, err := r.templates.render(filepath.Base(src), content)
+	if err != nil {
+		return fmt.Errorf("failed to render %s: %w", filepath.Base(src), err)
+	}
+
+	if existing, err := os.ReadFile(dst); err == nil && bytes.Equal(existing, out) {
+		result.FilesSkipped++
+		return nil
 	}
 
-	return false, nil
+	if err := r.backup(dst, result); err != nil {
+		return err
+	}
+	if err := r.writeFile(dst, bytes.NewReader(out), mode, time.Time{}); err != nil {
+		return err
+	}
+
+	result.FilesUpdated++
+	return nil
 }
 
 // restoreFile copies a single file preserving permissions and ModTime.
-// Uses smart restore: skips if file hasn't changed (same ModTime and Size).
+// Encrypted blobs are decrypted transparently to dst without the suffix.
+// Uses smart restore: skips if the content hasn't changed.
 func (r *Restorer) restoreFile(src, dst string, mode os.FileMode, result *RestoreResult) error {
-	needsCopy, err := shouldRestore(src, dst)
+	if strings.HasSuffix(src, EncryptedExt) {
+		return r.restoreEncrypted(src, plainRel(dst), mode, result)
+	}
+
+	needsCopy, err := shouldRestore(r.index, src, dst)
 	if err != nil {
 		return err
 	}
@@ -184,10 +525,6 @@ func (r *Restorer) restoreFile(src, dst string, mode os.FileMode, result *Restor
 		return nil
 	}
 
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return err
-	}
-
 	srcFile, err := os.Open(src)
 	if err != nil {
 		return err
@@ -199,77 +536,125 @@ func (r *Restorer) restoreFile(src, dst string, mode os.FileMode, result *Restor
 		return err
 	}
 
-	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err := r.backup(dst, result); err != nil {
+		return err
+	}
+	// Preserve ModTime from source so smart restore can detect changes
+	h := sha256.New()
+	if err := r.writeFile(dst, io.TeeReader(srcFile, h), mode, srcInfo.ModTime()); err != nil {
+		return err
+	}
+
+	if dstInfo, err := os.Stat(dst); err == nil {
+		hash := hex.EncodeToString(h.Sum(nil))
+		r.index.Record(src, srcInfo, hash)
+		r.index.Record(dst, dstInfo, hash)
+	}
+
+	result.FilesUpdated++
+	return nil
+}
+
+// restoreEncrypted decrypts a vault blob to dst.
+// Changes are detected by plaintext hash, as on copy.
+func (r *Restorer) restoreEncrypted(src, dst string, mode os.FileMode, result *RestoreResult) error {
+	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
+	srcHash, err := plainHash(r.index, r.cipher, src, srcInfo)
+	if err != nil {
+		return err
+	}
+
+	if dstInfo, err := os.Stat(dst); err == nil {
+		dstHash, err := r.index.Hash(dst, dstInfo)
+		if err != nil {
+			return err
+		}
+		if dstHash == srcHash {
+			result.FilesSkipped++
+			return nil
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
 
-	_, err = io.Copy(dstFile, srcFile)
+	plaintext, err := r.cipher.decryptFile(src)
 	if err != nil {
 		return err
 	}
 
-	// Preserve ModTime from source so smart restore can detect changes
-	if err := os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+	if err := r.backup(dst, result); err != nil {
+		return err
+	}
+	if err := r.writeFile(dst, bytes.NewReader(plaintext), mode, srcInfo.ModTime()); err != nil {
 		return err
 	}
 
+	if dstInfo, err := os.Stat(dst); err == nil {
+		r.index.Record(dst, dstInfo, srcHash)
+	}
+
 	result.FilesUpdated++
 	return nil
 }
 
+// restoreSymlink recreates the symlink described by the marker at
+// markerPath in dstDir, or restores the marker itself when its target
+// does not exist. A file in the way is backed up before it is replaced.
 func (r *Restorer) restoreSymlink(markerPath, dstDir string, result *RestoreResult) error {
 	content, err := os.ReadFile(markerPath)
 	if err != nil {
 		return err
 	}
 
-	target, name, err := parseSymlinkMarker(string(content))
+	m, _, err := decodeSymlinkMarker(content, filepath.Base(markerPath))
 	if err != nil {
 		return r.restoreFile(markerPath, filepath.Join(dstDir, filepath.Base(markerPath)), 0644, result)
 	}
 
-	dstPath := filepath.Join(dstDir, name)
+	target := m.Target
+	dstPath := filepath.Join(dstDir, m.Name)
+	markerDst := filepath.Join(dstDir, filepath.Base(markerPath))
 
-	if existingTarget, err := os.Readlink(dstPath); err == nil {
-		if existingTarget == target {
-			result.FilesSkipped++
-			return nil
-		}
-		os.Remove(dstPath)
-	} else if !os.IsNotExist(err) {
-		os.RemoveAll(dstPath)
+	if existingTarget, err := os.Readlink(dstPath); err == nil && existingTarget == target {
+		result.FilesSkipped++
+		return nil
 	}
 
-	if _, err := os.Stat(target); os.IsNotExist(err) {
-		markerDst := filepath.Join(dstDir, filepath.Base(markerPath))
+	// A relative target resolves from the link's directory
+	resolved := target
+	if !filepath.IsAbs(target) {
+		resolved = filepath.Join(dstDir, target)
+	}
+	if _, err := os.Stat(resolved); os.IsNotExist(err) {
 		return r.restoreFile(markerPath, markerDst, 0644, result)
 	}
 
+	// Whatever is in the way is replaced only once it is backed up;
+	// a directory is kept, with the marker next to it
+	if info, err := os.Lstat(dstPath); err == nil {
+		if info.IsDir() {
+			result.Kept = append(result.Kept, displayPath(r.home, dstPath))
+			return r.restoreFile(markerPath, markerDst, 0644, result)
+		}
+		if err := r.backup(dstPath, result); err != nil {
+			return err
+		}
+		if err := os.Remove(dstPath); err != nil {
+			return permissionError(err)
+		}
+	}
+
 	if err := os.Symlink(target, dstPath); err == nil {
 		result.FilesUpdated++
 		return nil
 	}
 
-	markerDst := filepath.Join(dstDir, filepath.Base(markerPath))
 	return r.restoreFile(markerPath, markerDst, 0644, result)
 }
 
-func parseSymlinkMarker(content string) (target, name string, err error) {
-	content = strings.TrimSpace(content)
-	if !strings.HasPrefix(content, "ln -s ") {
-		return "", "", fmt.Errorf("invalid marker format")
-	}
-
-	parts := strings.SplitN(content[6:], " ", 2)
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid marker format")
-	}
-
-	return parts[0], parts[1], nil
-}
-
 // VaultEntry represents a file or directory in the vault that matches config.
 type VaultEntry struct {
 	Path     string   // relative path from vault root
@@ -282,31 +667,45 @@ type VaultEntry struct {
 func (r *Restorer) ListVaultEntries() ([]VaultEntry, error) {
 	var entries []VaultEntry
 
-	for _, w := range r.cfg.Watching {
-		if !w.Enabled {
-			continue
-		}
+	matches, _, err := vaultMatches(r.vaultDir, r.host, r.cfg.Watching)
+	if err != nil {
+		return nil, err
+	}
 
-		vaultPath := filepath.Join(r.vaultDir, w.Path)
-		info, err := os.Stat(vaultPath)
-		if os.IsNotExist(err) {
-			continue
-		}
+	for _, m := range matches {
+		w := m.Watched
+
+		layers, err := vaultLayers(r.vaultDir, r.host, w)
 		if err != nil {
 			return nil, fmt.Errorf("failed to stat vault path %s: %w", w.Path, err)
 		}
+		if len(layers) == 0 {
+			continue
+		}
 
 		entry := VaultEntry{
 			Path:  w.Path,
-			IsDir: info.IsDir(),
+			IsDir: layers[0].info.IsDir(),
 		}
 
-		if info.IsDir() {
-			children, err := r.collectChildren(vaultPath, w.Path)
-			if err != nil {
-				return nil, err
+		if entry.IsDir {
+			// Union of all layers, shadowed files listed once
+			seen := make(map[string]bool)
+			for i, l := range layers {
+				children, err := r.collectChildren(l.path, w.Path, r.layerSpec(w, layers, i))
+				if err != nil {
+					return nil, err
+				}
+				for _, c := range children {
+					if !seen[c] {
+						seen[c] = true
+						entry.Children = append(entry.Children, c)
+					}
+				}
+			}
+			if len(layers) > 1 {
+				sort.Strings(entry.Children)
 			}
-			entry.Children = children
 		}
 
 		entries = append(entries, entry)
@@ -315,8 +714,9 @@ func (r *Restorer) ListVaultEntries() ([]VaultEntry, error) {
 	return entries, nil
 }
 
-// collectChildren recursively collects all file paths within a directory.
-func (r *Restorer) collectChildren(dirPath, relBase string) ([]string, error) {
+// collectChildren recursively collects all file paths within a directory,
+// leaving out entries excluded by patterns or ignore files.
+func (r *Restorer) collectChildren(dirPath, relBase string, spec *walkSpec) ([]string, error) {
 	var children []string
 
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
@@ -332,7 +732,20 @@ func (r *Restorer) collectChildren(dirPath, relBase string) ([]string, error) {
 			return err
 		}
 
+		if spec.skip(spec.srcRel(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && (info.Name() == keepMarker || isGitStoreFile(info.Name()) || spec.shadowed(rel)) {
+			return nil
+		}
+
 		fullRel := filepath.Join(relBase, rel)
+		if !info.IsDir() {
+			fullRel = spec.displayRel(fullRel)
+		}
 		children = append(children, fullRel)
 		return nil
 	})
@@ -343,6 +756,20 @@ func (r *Restorer) collectChildren(dirPath, relBase string) ([]string, error) {
 // RestoreSelective restores only the specified paths from vault.
 // paths should be relative paths (as they appear in config).
 func (r *Restorer) RestoreSelective(paths []string) (*RestoreResult, error) {
+	return r.RestoreSelectiveContext(context.Background(), paths, nil)
+}
+
+// RestoreSelectiveContext is RestoreSelective reporting its progress to
+// progress, if not nil. Cancelling ctx stops it as it does RestoreContext.
+func (r *Restorer) RestoreSelectiveContext(ctx context.Context, paths []string, progress ProgressFunc) (*RestoreResult, error) {
+	return r.withHooks(ctx, progress, func() (*RestoreResult, error) {
+		return r.restoreSelective(paths)
+	})
+}
+
+// restoreSelective does the work of RestoreSelective.
+// Per-path hooks run for the watched paths with something selected.
+func (r *Restorer) restoreSelective(paths []string) (*RestoreResult, error) {
 	result := &RestoreResult{}
 
 	// Create a map for quick lookup
@@ -351,79 +778,151 @@ func (r *Restorer) RestoreSelective(paths []string) (*RestoreResult, error) {
 		pathSet[p] = true
 	}
 
-	for _, w := range r.cfg.Watching {
-		if !w.Enabled {
-			continue
+	matches, _, err := vaultMatches(r.vaultDir, r.host, r.cfg.Watching)
+	if err != nil {
+		return nil, err
+	}
+
+	r.progress.phase(PhaseRestoring)
+	for i, m := range matches {
+		w := m.Watched
+		if err := r.cancelled(); err != nil {
+			return nil, err
 		}
+		r.progress.path(w.Path, i, len(matches))
+		// Selecting a glob selects every match
+		whole := pathSet[w.Path] || (m.Pattern != "" && pathSet[m.Pattern])
 
 		// Check if this watched path or any of its children should be restored
-		srcPath := filepath.Join(r.vaultDir, w.Path)
-		dstPath := filepath.Join(r.home, w.Path)
+		dstPath := sourcePath(r.home, w)
 
-		srcInfo, err := os.Stat(srcPath)
-		if os.IsNotExist(err) {
-			continue
-		}
+		layers, err := vaultLayers(r.vaultDir, r.host, w)
 		if err != nil {
 			return nil, fmt.Errorf("failed to stat vault path %s: %w", w.Path, err)
 		}
+		if len(layers) == 0 {
+			continue
+		}
 
-		gitMode := w.EffectiveGitMode(r.cfg.Git)
-
-		if srcInfo.IsDir() {
+		if layers[0].info.IsDir() {
 			// For directories, check if whole dir or specific files should be restored
-			if pathSet[w.Path] {
-				// Restore entire directory
-				if err := r.smartRestore(srcPath, dstPath, srcInfo, gitMode, w.Path, result); err != nil {
-					return nil, err
+			if whole {
+				// Restore entire directory, all layers merged
+				err := r.restorePath(w, result, func() error {
+					r.queue = newWorkQueue[RestoreResult](r.workers)
+					return r.finish(r.restoreLayers(w, layers, dstPath, &r.queue.walked), result)
+				})
+				if errors.Is(err, fs.ErrPermission) {
+					result.Denied = append(result.Denied, w.Path)
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to restore %s: %w", w.Path, err)
 				}
+				result.Restored = append(result.Restored, w.Path)
 			} else {
-				// Check for individual files within this directory
-				restored, err := r.restoreSelectiveDir(srcPath, dstPath, w.Path, pathSet, gitMode, result)
+				// Check for individual files within this directory, in every layer
+				anyRestored := false
+				restore := func() error {
+					r.queue = newWorkQueue[RestoreResult](r.workers)
+					for i, l := range layers {
+						restored, err := r.restoreSelectiveDir(l.path, dstPath, w.Path, pathSet, r.layerSpec(w, layers, i), &r.queue.walked)
+						if err != nil {
+							return r.finish(err, result)
+						}
+						anyRestored = anyRestored || restored
+					}
+					return r.finish(nil, result)
+				}
+				if selectedUnder(pathSet, w.Path) {
+					err = r.restorePath(w, result, restore)
+				} else {
+					err = restore()
+				}
+				if errors.Is(err, fs.ErrPermission) {
+					result.Denied = append(result.Denied, w.Path)
+					continue
+				}
 				if err != nil {
 					return nil, err
 				}
-				if !restored {
+				if !anyRestored {
 					result.Skipped = append(result.Skipped, w.Path)
 				}
 			}
 		} else {
 			// Single file
-			if pathSet[w.Path] {
-				if err := r.smartRestore(srcPath, dstPath, srcInfo, gitMode, w.Path, result); err != nil {
+			if whole {
+				spec := newWalkSpec(r.cfg, w, layers[0].path)
+				err := r.restorePath(w, result, func() error {
+					r.queue = newWorkQueue[RestoreResult](r.workers)
+					return r.finish(r.smartRestore(layers[0].path, dstPath, "", layers[0].info, spec, w.Path, &r.queue.walked), result)
+				})
+				if errors.Is(err, fs.ErrPermission) {
+					result.Denied = append(result.Denied, w.Path)
+					continue
+				}
+				if err != nil {
 					return nil, err
 				}
 			}
 		}
 	}
+	r.progress.path("", len(matches), len(matches))
+
+	if err := r.index.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save hash index: %w", err)
+	}
 
 	return result, nil
 }
 
+// selectedUnder reports whether pathSet holds a path below dir.
+func selectedUnder(pathSet map[string]bool, dir string) bool {
+	prefix := dir + string(filepath.Separator)
+	for p := range pathSet {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // smartRestore restores from vault using smart copy (only changed files).
-func (r *Restorer) smartRestore(srcPath, dstPath string, srcInfo os.FileInfo, gitMode config.GitMode, relPath string, result *RestoreResult) error {
+// rel is the path of srcPath relative to its watched root.
+func (r *Restorer) smartRestore(srcPath, dstPath, rel string, srcInfo os.FileInfo, spec *walkSpec, relPath string, result *RestoreResult) error {
 	if srcInfo.IsDir() {
-		if err := r.restoreDir(srcPath, dstPath, gitMode, result); err != nil {
+		if err := r.restoreDir(srcPath, dstPath, rel, spec, result); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", relPath, err)
+		}
+	} else if srcInfo.Mode()&os.ModeSymlink != 0 {
+		if err := r.restoreLink(srcPath, dstPath, result); err != nil {
 			return fmt.Errorf("failed to restore %s: %w", relPath, err)
 		}
 	} else {
-		if err := r.restoreFile(srcPath, dstPath, srcInfo.Mode(), result); err != nil {
+		if err := r.restoreRegular(srcPath, dstPath, srcInfo.Mode(), spec, result); err != nil {
 			return fmt.Errorf("failed to restore %s: %w", relPath, err)
 		}
 	}
 
-	result.Restored = append(result.Restored, relPath)
+	// A directory present in several layers is restored once per layer
+	if !slices.Contains(result.Restored, relPath) {
+		result.Restored = append(result.Restored, relPath)
+	}
 	return nil
 }
 
 // restoreSelectiveDir restores only selected files within a directory.
-func (r *Restorer) restoreSelectiveDir(srcDir, dstDir, baseRel string, pathSet map[string]bool, gitMode config.GitMode, result *RestoreResult) (bool, error) {
+func (r *Restorer) restoreSelectiveDir(srcDir, dstDir, baseRel string, pathSet map[string]bool, spec *walkSpec, result *RestoreResult) (bool, error) {
 	anyRestored := false
 
 	err := filepath.Walk(srcDir, func(srcPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := r.cancelled(); err != nil {
+			return err
+		}
 		if srcPath == srcDir {
 			return nil
 		}
@@ -434,25 +933,38 @@ func (r *Restorer) restoreSelectiveDir(srcDir, dstDir, baseRel string, pathSet m
 		}
 
 		fullRel := filepath.Join(baseRel, rel)
+		if !info.IsDir() {
+			fullRel = spec.displayRel(fullRel)
+		}
+
+		if spec.skip(spec.srcRel(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && (info.Name() == keepMarker || isGitStoreFile(info.Name()) || spec.shadowed(rel)) {
+			return nil
+		}
 
 		if pathSet[fullRel] {
 			dstPath := filepath.Join(dstDir, rel)
 
 			// Handle .git_disabled -> .git renaming
-			if info.Name() == ".git_disabled" && info.IsDir() && gitMode == config.GitModeDisable {
+			if info.Name() == ".git_disabled" && info.IsDir() && spec.gitMode == config.GitModeDisable {
 				dstPath = filepath.Join(filepath.Dir(dstPath), ".git")
 			}
 
 			if info.IsDir() {
 				// Skip walking into this directory, restore it completely
-				if err := r.smartRestore(srcPath, dstPath, info, gitMode, fullRel, result); err != nil {
+				if err := r.smartRestore(srcPath, dstPath, rel, info, spec, fullRel, result); err != nil {
 					return err
 				}
 				anyRestored = true
 				return filepath.SkipDir
 			} else {
 				// Restore single file
-				if err := r.smartRestore(srcPath, dstPath, info, gitMode, fullRel, result); err != nil {
+				if err := r.smartRestore(srcPath, dstPath, rel, info, spec, fullRel, result); err != nil {
 					return err
 				}
 				anyRestored = true
@@ -78,10 +78,9 @@ func TestRestoreSingleFile(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -135,10 +134,9 @@ func TestRestoreDirectory(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -178,10 +176,9 @@ func TestRestoreSkipsNonExistent(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -217,10 +214,9 @@ func TestRestoreSkipsDisabled(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -263,10 +259,9 @@ func TestRestoreRevertsGitDisabled(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	_, err = restorer.Restore()
@@ -323,15 +318,26 @@ func TestShouldRestore(t *testing.T) {
 			wantRestore: false,
 		},
 		{
-			name: "mod time differs",
+			name: "mod time differs but content is the same",
 			setup: func() {
 				content := []byte("same content")
 				os.WriteFile(src, content, 0644)
 				os.WriteFile(dst, content, 0644)
-				// Different mod times
+				// Different mod times, as after a fresh git clone
 				os.Chtimes(src, time.Now(), time.Now())
 				os.Chtimes(dst, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
 			},
+			wantRestore: false,
+		},
+		{
+			name: "same size and mod time but content differs",
+			setup: func() {
+				os.WriteFile(src, []byte("content A"), 0644)
+				os.WriteFile(dst, []byte("content B"), 0644)
+				now := time.Now()
+				os.Chtimes(src, now, now)
+				os.Chtimes(dst, now, now)
+			},
 			wantRestore: true,
 		},
 		{
@@ -348,7 +354,7 @@ func TestShouldRestore(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setup()
 
-			needsRestore, err := shouldRestore(src, dst)
+			needsRestore, err := shouldRestore(nil, src, dst)
 			if tt.wantErr {
 				if err == nil {
 					t.Error("shouldRestore() expected error, got nil")
@@ -389,10 +395,9 @@ func TestRestoreSmartSkipsUnchanged(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	// First restore
@@ -448,10 +453,9 @@ func TestListVaultEntries(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	entries, err := restorer.ListVaultEntries()
@@ -516,10 +520,9 @@ func TestRestoreSelective(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	// Only restore .testrc
@@ -569,10 +572,9 @@ func TestRestoreSelectiveDir(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	// Only restore one file from the directory
@@ -622,10 +624,9 @@ func TestRestoreSelectiveEntireDir(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	// Restore entire directory
@@ -668,10 +669,9 @@ func TestRestoreSelectiveSkipsNonExistent(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.RestoreSelective([]string{".nonexistent"})
@@ -707,10 +707,9 @@ func TestRestoreSelectiveSkipsDisabled(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.RestoreSelective([]string{".testrc"})
@@ -752,10 +751,9 @@ func TestRestoreSelectiveDirWithGitDisabled(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	// Restore just the .git_disabled directory
@@ -800,10 +798,9 @@ func TestRestoreSelectiveNoMatch(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	// Restore a file that doesn't match any in the directory
@@ -826,7 +823,7 @@ func TestShouldRestoreSourceStatError(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 
 	// Non-existent source
-	_, err = shouldRestore(filepath.Join(tmpDir, "nonexistent"), filepath.Join(tmpDir, "dst"))
+	_, err = shouldRestore(nil, filepath.Join(tmpDir, "nonexistent"), filepath.Join(tmpDir, "dst"))
 	if err == nil {
 		t.Error("shouldRestore() should return error for non-existent source")
 	}
@@ -857,10 +854,9 @@ func TestListVaultEntriesDisabledItems(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	entries, err := restorer.ListVaultEntries()
@@ -906,10 +902,9 @@ func TestRestoreSymlinkCreatesRealSymlink(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -972,10 +967,9 @@ func TestRestoreSymlinkFallsBackToMarker(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -1029,10 +1023,9 @@ func TestRestoreSymlinkSkipsIdentical(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -1082,10 +1075,9 @@ func TestRestoreSymlinkUpdatesTarget(t *testing.T) {
 	}
 
 	restorer := &Restorer{
-		cfg:        cfg,
-		home:       homeDir,
-		vaultDir:   vaultDir,
-		backupTime: time.Now().Format("200601021504"),
+		cfg:      cfg,
+		home:     homeDir,
+		vaultDir: vaultDir,
 	}
 
 	result, err := restorer.Restore()
@@ -0,0 +1,143 @@
+package snapfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// revisionDateFormats are the dates a revision may be given as, in local
+// time unless they carry a zone.
+var revisionDateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseRevisionDate parses rev as one of revisionDateFormats. A date
+// alone stands for the end of that day.
+func parseRevisionDate(rev string) (time.Time, bool) {
+	for _, layout := range revisionDateFormats {
+		t, err := time.ParseInLocation(layout, rev, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// ResolveRevision returns the vault commit rev names: a commit, a tag,
+// any other git revision, or a date, which names the last commit made
+// at or before it on the current branch.
+func ResolveRevision(vaultDir, rev string) (string, error) {
+	gitDir := filepath.Join(vaultDir, ".git")
+	// A leading dash would be taken as an option
+	if !strings.HasPrefix(rev, "-") {
+		if commit, err := gitOutput(gitDir, "rev-parse", "-q", "--verify", rev+"^{commit}"); err == nil {
+			return commit, nil
+		}
+	}
+
+	at, ok := parseRevisionDate(rev)
+	if !ok {
+		return "", fmt.Errorf("unknown revision %q: not a vault commit, tag or date", rev)
+	}
+	commit, err := gitOutput(gitDir, "rev-list", "-1", "--before="+strconv.FormatInt(at.Unix(), 10), "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if commit == "" {
+		return "", fmt.Errorf("no vault commit at or before %s", at.Format("2006-01-02 15:04:05"))
+	}
+	return commit, nil
+}
+
+// checkoutRevision writes the files of the vault commit into a new
+// temporary directory and returns it with a func removing it. It goes
+// through its own index, so the vault's HEAD, index and working tree are
+// left as they are.
+func checkoutRevision(ctx context.Context, vaultDir, commit string) (string, func(), error) {
+	tmp, err := os.MkdirTemp("", "snapfig-at-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	tree := filepath.Join(tmp, "vault")
+	gitDir := filepath.Join(vaultDir, ".git")
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmp, "index"))
+	for _, args := range [][]string{
+		{"read-tree", commit},
+		{"checkout-index", "-a", "-f", "--prefix=" + tree + string(filepath.Separator)},
+	} {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"--git-dir", gitDir}, args...)...)
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			cleanup()
+			if ctx.Err() != nil {
+				return "", nil, ctx.Err()
+			}
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return "", nil, fmt.Errorf("git %s: %s", args[0], msg)
+			}
+			return "", nil, fmt.Errorf("git %s: %w", args[0], err)
+		}
+	}
+
+	// An empty commit checks nothing out
+	if err := os.MkdirAll(tree, 0755); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tree, cleanup, nil
+}
+
+// RestoreAt restores from the vault as it was at rev, see ResolveRevision.
+// With paths, only those are restored, as RestoreSelective does.
+func (r *Restorer) RestoreAt(rev string, paths []string) (*RestoreResult, error) {
+	return r.RestoreAtContext(context.Background(), rev, paths, nil)
+}
+
+// RestoreAtContext is RestoreAt reporting its progress to progress, if
+// not nil. Cancelling ctx stops it as it does RestoreContext.
+//
+// The commit is checked out to a temporary directory and restored from
+// there: git modes, symlink markers, templates, encryption, host layers,
+// recorded metadata and reference repositories all come from that commit.
+// Hooks see that directory as the vault. The hash index is not used, as
+// it caches the current vault files.
+func (r *Restorer) RestoreAtContext(ctx context.Context, rev string, paths []string, progress ProgressFunc) (*RestoreResult, error) {
+	commit, err := ResolveRevision(r.vaultDir, rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, cleanup, err := checkoutRevision(ctx, r.vaultDir, commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault at %s: %w", rev, err)
+	}
+	defer cleanup()
+
+	at := *r
+	at.vaultDir = tree
+	at.index = nil
+	at.meta = loadMetadata(tree, r.cfg.Metadata.Xattrs)
+	at.templates = newTemplateEngine(r.cfg, tree, r.host, r.home)
+
+	if len(paths) == 0 {
+		return at.withHooks(ctx, progress, at.restoreAll)
+	}
+	return at.withHooks(ctx, progress, func() (*RestoreResult, error) {
+		return at.restoreSelective(paths)
+	})
+}
@@ -0,0 +1,189 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestParseRevisionDate(t *testing.T) {
+	tests := []struct {
+		rev  string
+		want time.Time
+		ok   bool
+	}{
+		{"2026-01-15", time.Date(2026, 1, 15, 23, 59, 59, 0, time.Local), true},
+		{"2026-01-15 08:30", time.Date(2026, 1, 15, 8, 30, 0, 0, time.Local), true},
+		{"2026-01-15 08:30:05", time.Date(2026, 1, 15, 8, 30, 5, 0, time.Local), true},
+		{"2026-01-15T08:30:05Z", time.Date(2026, 1, 15, 8, 30, 5, 0, time.UTC), true},
+		{"v1.0", time.Time{}, false},
+		{"HEAD~2", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRevisionDate(tt.rev)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseRevisionDate(%q) = %v, %v, want %v, %v", tt.rev, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// makeVaultHistory backs up homeDir to vaultDir twice: first .testrc as
+// "v1" with a disabled nested repository and a symlink to the parent of
+// homeDir, tagged v1, then .testrc as "v2" without the symlink. It
+// returns the first commit.
+func makeVaultHistory(t *testing.T, homeDir, vaultDir string) string {
+	t.Helper()
+	setupTestGitConfig(t)
+
+	appDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(filepath.Join(appDir, ".git"), 0755)
+	os.WriteFile(filepath.Join(appDir, ".git", "config"), []byte("[core]"), 0644)
+	os.WriteFile(filepath.Join(appDir, "file.txt"), []byte("file v1"), 0644)
+	os.Symlink(filepath.Dir(homeDir), filepath.Join(appDir, "current"))
+	os.WriteFile(filepath.Join(homeDir, ".testrc"), []byte("v1"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".testrc", Enabled: true},
+			{Path: ".config/app", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-10T12:00:00")
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	first := gitIn(t, vaultDir, "rev-parse", "HEAD")
+	gitIn(t, vaultDir, "tag", "v1")
+
+	os.WriteFile(filepath.Join(homeDir, ".testrc"), []byte("v2"), 0644)
+	os.WriteFile(filepath.Join(appDir, "file.txt"), []byte("file v2"), 0644)
+	os.Remove(filepath.Join(appDir, "current"))
+	t.Setenv("GIT_COMMITTER_DATE", "2026-01-20T12:00:00")
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	return first
+}
+
+func TestResolveRevision(t *testing.T) {
+	tmpDir := t.TempDir()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	first := makeVaultHistory(t, filepath.Join(tmpDir, "home"), vaultDir)
+	head := gitIn(t, vaultDir, "rev-parse", "HEAD")
+
+	for rev, want := range map[string]string{
+		first:                 first,
+		first[:8]:             first,
+		"v1":                  first,
+		"HEAD~1":              first,
+		"2026-01-15":          first,
+		"2026-01-10 12:00":    first,
+		"2026-01-20 12:00:00": head,
+		"2026-02-01":          head,
+	} {
+		got, err := ResolveRevision(vaultDir, rev)
+		if err != nil {
+			t.Errorf("ResolveRevision(%q) error: %v", rev, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ResolveRevision(%q) = %s, want %s", rev, got, want)
+		}
+	}
+
+	for _, rev := range []string{"2026-01-01", "no-such-tag", "--all"} {
+		if _, err := ResolveRevision(vaultDir, rev); err == nil {
+			t.Errorf("ResolveRevision(%q) should fail", rev)
+		}
+	}
+}
+
+func TestRestoreAt(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	makeVaultHistory(t, srcHome, vaultDir)
+	head := gitIn(t, vaultDir, "rev-parse", "HEAD")
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".testrc", Enabled: true},
+			{Path: ".config/app", Enabled: true},
+		},
+	}
+	os.MkdirAll(dstHome, 0755)
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	result, err := restorer.RestoreAt("v1", nil)
+	if err != nil {
+		t.Fatalf("RestoreAt() error: %v", err)
+	}
+	if len(result.Restored) != 2 {
+		t.Errorf("RestoreAt() restored %v, want both paths", result.Restored)
+	}
+	for name, want := range map[string]string{".testrc": "v1", ".config/app/file.txt": "file v1", ".config/app/.git/config": "[core]"} {
+		data, err := os.ReadFile(filepath.Join(dstHome, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dstHome, ".config", "app", "current")); err != nil || target != tmpDir {
+		t.Errorf("current -> %q, %v, want the symlink restored", target, err)
+	}
+
+	// The vault is left as it was
+	if got := gitIn(t, vaultDir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("vault HEAD = %s, want %s", got, head)
+	}
+	if status := gitIn(t, vaultDir, "status", "--porcelain"); status != "" {
+		t.Errorf("vault status = %q, want clean", status)
+	}
+	if data, _ := os.ReadFile(filepath.Join(vaultDir, ".testrc")); string(data) != "v2" {
+		t.Errorf("vault .testrc = %q, want v2", data)
+	}
+}
+
+func TestRestoreAtSelective(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcHome := filepath.Join(tmpDir, "src")
+	dstHome := filepath.Join(tmpDir, "dst")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	first := makeVaultHistory(t, srcHome, vaultDir)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Watching: []config.Watched{
+			{Path: ".testrc", Enabled: true},
+			{Path: ".config/app", Enabled: true},
+		},
+	}
+	os.MkdirAll(dstHome, 0755)
+	restorer := &Restorer{cfg: cfg, home: dstHome, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+
+	result, err := restorer.RestoreAt(first, []string{".config/app/file.txt"})
+	if err != nil {
+		t.Fatalf("RestoreAt() error: %v", err)
+	}
+	if len(result.Restored) != 1 {
+		t.Errorf("RestoreAt() restored %v, want one path", result.Restored)
+	}
+	if data, err := os.ReadFile(filepath.Join(dstHome, ".config", "app", "file.txt")); err != nil || string(data) != "file v1" {
+		t.Errorf("file.txt = %q, %v, want %q", data, err, "file v1")
+	}
+	for _, name := range []string{".testrc", ".config/app/current"} {
+		if _, err := os.Lstat(filepath.Join(dstHome, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be restored", name)
+		}
+	}
+}
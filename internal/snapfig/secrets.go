@@ -0,0 +1,266 @@
+package snapfig
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/adrianpk/snapfig/internal/config"
+	"github.com/adrianpk/snapfig/internal/paths"
+)
+
+// ErrCommitBlocked is returned by Copy when the secret scanner blocks the commit.
+var ErrCommitBlocked = errors.New("commit blocked: secrets detected")
+
+const (
+	allowlistFilename = "secrets-allowlist"
+	quarantineDirname = "quarantine"
+
+	maxScanSize       = 1 << 20 // larger files are only scanned up to it
+	minEntropyLength  = 32
+	entropyThreshold  = 4.5 // bits per char; hex digests stay below 4
+	redactKeepPrefix  = 4
+	binarySniffLength = 8000
+)
+
+// SecretFinding describes a suspected secret found in a copied file.
+type SecretFinding struct {
+	Path  string // relative to home
+	Line  int
+	Rule  string
+	Match string // redacted
+}
+
+type secretRule struct {
+	id string
+	re *regexp.Regexp
+}
+
+var secretRules = []secretRule{
+	{"private-key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{"gcp-service-account", regexp.MustCompile(`"type"\s*:\s*"service_account"`)},
+	{"azure-storage-key", regexp.MustCompile(`AccountKey=[A-Za-z0-9+/=]{60,}`)},
+	{"github-token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{20,}=*`)},
+	{"kube-credential", regexp.MustCompile(`^\s*(?:token|id-token|refresh-token|client-key-data)\s*:\s*["']?[A-Za-z0-9\-._~+/=]{20,}`)},
+}
+
+var (
+	entropyKeywordRe   = regexp.MustCompile(`(?i)(?:key|secret|token|passw(?:or)?d|pwd|credential|auth)`)
+	entropyCandidateRe = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{32,}`)
+)
+
+// allowEntry suppresses findings for paths matching a glob,
+// optionally only for one rule.
+type allowEntry struct {
+	pattern string
+	rule    string
+}
+
+// secretScanner checks changed files for credentials before they reach the vault.
+type secretScanner struct {
+	policy     config.SecretsPolicy
+	allow      []allowEntry
+	quarantine string
+}
+
+// newSecretScanner builds a scanner from config.
+// Returns nil when scanning is disabled.
+func newSecretScanner(cfg *config.Config, snapfigDir string) (*secretScanner, error) {
+	policy := cfg.Secrets.EffectivePolicy()
+	if policy == config.SecretsOff {
+		return nil, nil
+	}
+
+	allowPath := cfg.Secrets.Allowlist
+	if allowPath == "" {
+		allowPath = filepath.Join(snapfigDir, allowlistFilename)
+	} else if strings.HasPrefix(allowPath, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		allowPath = filepath.Join(home, allowPath[2:])
+	}
+
+	allow, err := loadAllowlist(allowPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretScanner{
+		policy:     policy,
+		allow:      allow,
+		quarantine: filepath.Join(snapfigDir, quarantineDirname),
+	}, nil
+}
+
+// loadAllowlist reads an allowlist file. Each line holds a path glob,
+// optionally followed by a rule id: ".kube/config kube-credential".
+// A missing file is an empty allowlist.
+func loadAllowlist(path string) ([]allowEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []allowEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		entry := allowEntry{pattern: fields[0]}
+		if len(fields) > 1 {
+			entry.rule = fields[1]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// allowed reports whether a finding is suppressed by the allowlist.
+func (s *secretScanner) allowed(rel, rule string) bool {
+	for _, a := range s.allow {
+		if a.rule != "" && a.rule != rule {
+			continue
+		}
+		if paths.Match(a.pattern, filepath.ToSlash(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanFile scans the file at path. rel is its home-relative path,
+// used for reporting and allowlist matching. Only the first maxScanSize
+// bytes of a larger file are scanned, and it is reported as not fully
+// scanned.
+func (s *secretScanner) scanFile(path, rel string) ([]SecretFinding, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxScanSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	complete := len(data) <= maxScanSize
+	if !complete {
+		data = data[:maxScanSize]
+	}
+	findings, scanned := s.scan(data, rel)
+	return findings, complete && scanned, nil
+}
+
+// scan returns the findings in data that are not allowlisted, and
+// whether all of data was scanned.
+func (s *secretScanner) scan(data []byte, rel string) ([]SecretFinding, bool) {
+	sniff := data
+	if len(sniff) > binarySniffLength {
+		sniff = sniff[:binarySniffLength]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return nil, true // binary
+	}
+
+	var findings []SecretFinding
+	add := func(line int, rule, match string) {
+		if s.allowed(rel, rule) {
+			return
+		}
+		findings = append(findings, SecretFinding{
+			Path:  rel,
+			Line:  line,
+			Rule:  rule,
+			Match: redact(match),
+		})
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxScanSize+1)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+
+		matched := false
+		for _, r := range secretRules {
+			if m := r.re.FindString(line); m != "" {
+				add(n, r.id, m)
+				matched = true
+			}
+		}
+		if matched || !entropyKeywordRe.MatchString(line) {
+			continue
+		}
+
+		for _, candidate := range entropyCandidateRe.FindAllString(line, -1) {
+			if len(candidate) >= minEntropyLength && shannonEntropy(candidate) > entropyThreshold {
+				add(n, "high-entropy-string", candidate)
+				break
+			}
+		}
+	}
+
+	// A line longer than the buffer stops the scan
+	return findings, scanner.Err() == nil
+}
+
+// shannonEntropy returns the entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var entropy float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// redact keeps only the start of a match so findings can be shown safely.
+func redact(s string) string {
+	if len(s) <= redactKeepPrefix {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:redactKeepPrefix] + strings.Repeat("*", min(len(s)-redactKeepPrefix, 16))
+}
+
+// quarantineFile moves a flagged file out of the vault's reach:
+// the content goes to ~/.snapfig/quarantine/<rel> for review, which is
+// never committed or pushed.
+func (s *secretScanner) quarantineFile(src, rel string) error {
+	dst := filepath.Join(s.quarantine, rel)
+	if filepath.IsAbs(rel) {
+		dst = filepath.Join(s.quarantine, RootDir, rel)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, data, 0600)
+}
@@ -2,6 +2,7 @@
 package snapfig
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
@@ -12,22 +13,39 @@ import (
 // This allows for dependency injection and easy testing.
 type Service interface {
 	// Copy copies all enabled watched paths to the vault.
-	Copy() (*CopyResult, error)
+	// Copy, Restore, RestoreSelective, RestoreAt, Push, Pull, MigrateVault
+	// and SetRemote hold the vault lock and fail with ErrVaultBusy when
+	// another process keeps it past the configured lock_timeout.
+	// Copy, the restores, Push and Pull report their progress
+	// to progress, if not nil, and stop when ctx is cancelled.
+	Copy(ctx context.Context, progress ProgressFunc) (*CopyResult, error)
+
+	// PlanCopy returns what Copy would change, without touching the vault.
+	PlanCopy() (*CopyPlan, error)
 
 	// Restore restores all enabled watched paths from vault.
-	Restore() (*RestoreResult, error)
+	Restore(ctx context.Context, progress ProgressFunc) (*RestoreResult, error)
 
 	// RestoreSelective restores only the specified paths from vault.
-	RestoreSelective(paths []string) (*RestoreResult, error)
+	RestoreSelective(ctx context.Context, paths []string, progress ProgressFunc) (*RestoreResult, error)
+
+	// RestoreAt restores from the vault as it was at rev, a commit, tag or
+	// date, without moving its HEAD or working tree. With paths, only those
+	// are restored, as RestoreSelective does.
+	RestoreAt(ctx context.Context, rev string, paths []string, progress ProgressFunc) (*RestoreResult, error)
 
 	// ListVaultEntries returns all entries in the vault that match the config.
 	ListVaultEntries() ([]VaultEntry, error)
 
 	// Push pushes the vault to the configured remote.
-	Push() error
+	// When only hooks failed, the error matches ErrHookFailed.
+	Push(ctx context.Context, progress ProgressFunc) error
 
 	// Pull pulls the vault from remote, cloning if needed.
-	Pull() (*PullResult, error)
+	Pull(ctx context.Context, progress ProgressFunc) (*PullResult, error)
+
+	// MigrateVault rewrites vault files stored in older formats.
+	MigrateVault() (*MigrateResult, error)
 
 	// SetRemote configures the git remote for the vault.
 	SetRemote(url string) error
@@ -76,31 +94,76 @@ func NewService(cfg *config.Config, configPath string) (*DefaultService, error)
 	}, nil
 }
 
+// lock takes the vault lock for a mutating operation. Copiers and
+// restorers are built once it is held, so the metadata, hash index and
+// templates they load are not those of before another operation.
+func (s *DefaultService) lock() (*VaultLock, error) {
+	return LockVault(s.vaultDir, s.cfg.EffectiveLockTimeout())
+}
+
 // Copy copies all enabled watched paths to the vault.
-func (s *DefaultService) Copy() (*CopyResult, error) {
+func (s *DefaultService) Copy(ctx context.Context, progress ProgressFunc) (*CopyResult, error) {
+	l, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Unlock()
 	copier, err := NewCopier(s.cfg)
 	if err != nil {
 		return nil, err
 	}
-	return copier.Copy()
+	return copier.CopyContext(ctx, progress)
+}
+
+// PlanCopy returns what Copy would change, without touching the vault.
+func (s *DefaultService) PlanCopy() (*CopyPlan, error) {
+	copier, err := NewCopier(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	return copier.Plan()
 }
 
 // Restore restores all enabled watched paths from vault.
-func (s *DefaultService) Restore() (*RestoreResult, error) {
+func (s *DefaultService) Restore(ctx context.Context, progress ProgressFunc) (*RestoreResult, error) {
+	l, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Unlock()
 	restorer, err := NewRestorer(s.cfg)
 	if err != nil {
 		return nil, err
 	}
-	return restorer.Restore()
+	return restorer.RestoreContext(ctx, progress)
 }
 
 // RestoreSelective restores only the specified paths from vault.
-func (s *DefaultService) RestoreSelective(paths []string) (*RestoreResult, error) {
+func (s *DefaultService) RestoreSelective(ctx context.Context, paths []string, progress ProgressFunc) (*RestoreResult, error) {
+	l, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Unlock()
 	restorer, err := NewRestorer(s.cfg)
 	if err != nil {
 		return nil, err
 	}
-	return restorer.RestoreSelective(paths)
+	return restorer.RestoreSelectiveContext(ctx, paths, progress)
+}
+
+// RestoreAt restores from the vault as it was at rev.
+func (s *DefaultService) RestoreAt(ctx context.Context, rev string, paths []string, progress ProgressFunc) (*RestoreResult, error) {
+	l, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Unlock()
+	restorer, err := NewRestorer(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	return restorer.RestoreAtContext(ctx, rev, paths, progress)
 }
 
 // ListVaultEntries returns all entries in the vault that match the config.
@@ -113,17 +176,42 @@ func (s *DefaultService) ListVaultEntries() ([]VaultEntry, error) {
 }
 
 // Push pushes the vault to the configured remote.
-func (s *DefaultService) Push() error {
-	return PushVaultWithToken(s.vaultDir, s.cfg.GitToken)
+func (s *DefaultService) Push(ctx context.Context, progress ProgressFunc) error {
+	l, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return PushWithHooks(ctx, s.cfg, s.vaultDir, progress)
 }
 
 // Pull pulls the vault from remote, cloning if needed.
-func (s *DefaultService) Pull() (*PullResult, error) {
-	return PullVaultWithToken(s.vaultDir, s.cfg.Remote, s.cfg.GitToken)
+func (s *DefaultService) Pull(ctx context.Context, progress ProgressFunc) (*PullResult, error) {
+	l, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Unlock()
+	return PullWithHooks(ctx, s.cfg, s.vaultDir, progress)
+}
+
+// MigrateVault rewrites vault files stored in older formats.
+func (s *DefaultService) MigrateVault() (*MigrateResult, error) {
+	l, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Unlock()
+	return MigrateVault(s.vaultDir)
 }
 
 // SetRemote configures the git remote for the vault.
 func (s *DefaultService) SetRemote(url string) error {
+	l, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
 	return SetRemote(s.vaultDir, url)
 }
 
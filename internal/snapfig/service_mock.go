@@ -2,6 +2,8 @@
 package snapfig
 
 import (
+	"context"
+
 	"github.com/adrianpk/snapfig/internal/config"
 )
 
@@ -12,11 +14,14 @@ type MockService struct {
 
 	// Function hooks for mocking behavior
 	CopyFunc                   func() (*CopyResult, error)
+	PlanCopyFunc               func() (*CopyPlan, error)
 	RestoreFunc                func() (*RestoreResult, error)
 	RestoreSelectiveFunc       func(paths []string) (*RestoreResult, error)
+	RestoreAtFunc              func(rev string, paths []string) (*RestoreResult, error)
 	ListVaultEntriesFunc       func() ([]VaultEntry, error)
 	PushFunc                   func() error
 	PullFunc                   func() (*PullResult, error)
+	MigrateVaultFunc           func() (*MigrateResult, error)
 	SetRemoteFunc              func(url string) error
 	SaveConfigFunc             func(path string) error
 	UpdateWatchingFunc         func(watching []config.Watched)
@@ -26,12 +31,17 @@ type MockService struct {
 
 	// Call tracking
 	CopyCalled                   bool
+	PlanCopyCalled               bool
 	RestoreCalled                bool
 	RestoreSelectiveCalled       bool
 	RestoreSelectivePaths        []string
+	RestoreAtCalled              bool
+	RestoreAtRev                 string
+	RestoreAtPaths               []string
 	ListVaultEntriesCalled       bool
 	PushCalled                   bool
 	PullCalled                   bool
+	MigrateVaultCalled           bool
 	SetRemoteCalled              bool
 	SetRemoteURL                 string
 	SaveConfigCalled             bool
@@ -56,7 +66,7 @@ func NewMockService(cfg *config.Config) *MockService {
 }
 
 // Copy mocks the Copy operation.
-func (m *MockService) Copy() (*CopyResult, error) {
+func (m *MockService) Copy(ctx context.Context, progress ProgressFunc) (*CopyResult, error) {
 	m.CopyCalled = true
 	if m.CopyFunc != nil {
 		return m.CopyFunc()
@@ -70,8 +80,17 @@ func (m *MockService) Copy() (*CopyResult, error) {
 	}, nil
 }
 
+// PlanCopy mocks the PlanCopy operation.
+func (m *MockService) PlanCopy() (*CopyPlan, error) {
+	m.PlanCopyCalled = true
+	if m.PlanCopyFunc != nil {
+		return m.PlanCopyFunc()
+	}
+	return &CopyPlan{}, nil
+}
+
 // Restore mocks the Restore operation.
-func (m *MockService) Restore() (*RestoreResult, error) {
+func (m *MockService) Restore(ctx context.Context, progress ProgressFunc) (*RestoreResult, error) {
 	m.RestoreCalled = true
 	if m.RestoreFunc != nil {
 		return m.RestoreFunc()
@@ -86,7 +105,7 @@ func (m *MockService) Restore() (*RestoreResult, error) {
 }
 
 // RestoreSelective mocks the RestoreSelective operation.
-func (m *MockService) RestoreSelective(paths []string) (*RestoreResult, error) {
+func (m *MockService) RestoreSelective(ctx context.Context, paths []string, progress ProgressFunc) (*RestoreResult, error) {
 	m.RestoreSelectiveCalled = true
 	m.RestoreSelectivePaths = paths
 	if m.RestoreSelectiveFunc != nil {
@@ -101,6 +120,23 @@ func (m *MockService) RestoreSelective(paths []string) (*RestoreResult, error) {
 	}, nil
 }
 
+// RestoreAt mocks the RestoreAt operation.
+func (m *MockService) RestoreAt(ctx context.Context, rev string, paths []string, progress ProgressFunc) (*RestoreResult, error) {
+	m.RestoreAtCalled = true
+	m.RestoreAtRev = rev
+	m.RestoreAtPaths = paths
+	if m.RestoreAtFunc != nil {
+		return m.RestoreAtFunc(rev, paths)
+	}
+	return &RestoreResult{
+		Restored:     paths,
+		Skipped:      []string{},
+		Backups:      []string{},
+		FilesUpdated: len(paths),
+		FilesSkipped: 0,
+	}, nil
+}
+
 // ListVaultEntries mocks the ListVaultEntries operation.
 func (m *MockService) ListVaultEntries() ([]VaultEntry, error) {
 	m.ListVaultEntriesCalled = true
@@ -111,7 +147,7 @@ func (m *MockService) ListVaultEntries() ([]VaultEntry, error) {
 }
 
 // Push mocks the Push operation.
-func (m *MockService) Push() error {
+func (m *MockService) Push(ctx context.Context, progress ProgressFunc) error {
 	m.PushCalled = true
 	if m.PushFunc != nil {
 		return m.PushFunc()
@@ -120,7 +156,7 @@ func (m *MockService) Push() error {
 }
 
 // Pull mocks the Pull operation.
-func (m *MockService) Pull() (*PullResult, error) {
+func (m *MockService) Pull(ctx context.Context, progress ProgressFunc) (*PullResult, error) {
 	m.PullCalled = true
 	if m.PullFunc != nil {
 		return m.PullFunc()
@@ -128,6 +164,15 @@ func (m *MockService) Pull() (*PullResult, error) {
 	return &PullResult{Cloned: false}, nil
 }
 
+// MigrateVault mocks the MigrateVault operation.
+func (m *MockService) MigrateVault() (*MigrateResult, error) {
+	m.MigrateVaultCalled = true
+	if m.MigrateVaultFunc != nil {
+		return m.MigrateVaultFunc()
+	}
+	return &MigrateResult{}, nil
+}
+
 // SetRemote mocks the SetRemote operation.
 func (m *MockService) SetRemote(url string) error {
 	m.SetRemoteCalled = true
@@ -201,12 +246,17 @@ func (m *MockService) SyncConfigFromManifest() error {
 // Reset clears all call tracking state.
 func (m *MockService) Reset() {
 	m.CopyCalled = false
+	m.PlanCopyCalled = false
 	m.RestoreCalled = false
 	m.RestoreSelectiveCalled = false
 	m.RestoreSelectivePaths = nil
+	m.RestoreAtCalled = false
+	m.RestoreAtRev = ""
+	m.RestoreAtPaths = nil
 	m.ListVaultEntriesCalled = false
 	m.PushCalled = false
 	m.PullCalled = false
+	m.MigrateVaultCalled = false
 	m.SetRemoteCalled = false
 	m.SetRemoteURL = ""
 	m.SaveConfigCalled = false
@@ -1,6 +1,7 @@
 package snapfig
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -63,7 +64,7 @@ func TestDefaultServiceCopy(t *testing.T) {
 		t.Fatalf("NewService returned error: %v", err)
 	}
 
-	result, err := svc.Copy()
+	result, err := svc.Copy(context.Background(), nil)
 	if err != nil {
 		t.Fatalf("Copy returned error: %v", err)
 	}
@@ -106,7 +107,7 @@ func TestDefaultServiceRestore(t *testing.T) {
 		t.Fatalf("NewService returned error: %v", err)
 	}
 
-	result, err := svc.Restore()
+	result, err := svc.Restore(context.Background(), nil)
 	if err != nil {
 		t.Fatalf("Restore returned error: %v", err)
 	}
@@ -183,9 +184,9 @@ func TestMockServiceReset(t *testing.T) {
 	mockSvc := NewMockService(nil)
 
 	// Make some calls
-	mockSvc.Copy()
-	mockSvc.Restore()
-	mockSvc.Push()
+	mockSvc.Copy(context.Background(), nil)
+	mockSvc.Restore(context.Background(), nil)
+	mockSvc.Push(context.Background(), nil)
 
 	if !mockSvc.CopyCalled {
 		t.Error("CopyCalled should be true")
@@ -220,7 +221,7 @@ func TestMockServiceCustomFunctions(t *testing.T) {
 		return &CopyResult{FilesUpdated: 99}, nil
 	}
 
-	result, _ := mockSvc.Copy()
+	result, _ := mockSvc.Copy(context.Background(), nil)
 
 	if !customCalled {
 		t.Error("custom CopyFunc should have been called")
@@ -277,7 +278,7 @@ func TestMockServiceRestoreSelective(t *testing.T) {
 	mockSvc := NewMockService(nil)
 	paths := []string{".config/test/file1", ".config/test/file2"}
 
-	result, err := mockSvc.RestoreSelective(paths)
+	result, err := mockSvc.RestoreSelective(context.Background(), paths, nil)
 	if err != nil {
 		t.Errorf("RestoreSelective returned error: %v", err)
 	}
@@ -313,7 +314,7 @@ func TestMockServicePull(t *testing.T) {
 		return &PullResult{Cloned: true}, nil
 	}
 
-	result, err := mockSvc.Pull()
+	result, err := mockSvc.Pull(context.Background(), nil)
 	if err != nil {
 		t.Errorf("Pull returned error: %v", err)
 	}
@@ -386,7 +387,7 @@ func TestDefaultServiceRestoreSelective(t *testing.T) {
 		t.Fatalf("NewService returned error: %v", err)
 	}
 
-	result, err := svc.RestoreSelective([]string{".config/test"})
+	result, err := svc.RestoreSelective(context.Background(), []string{".config/test"}, nil)
 	if err != nil {
 		t.Fatalf("RestoreSelective returned error: %v", err)
 	}
@@ -451,7 +452,7 @@ func TestDefaultServicePushNoRepo(t *testing.T) {
 	}
 
 	// Push should fail - no git repo
-	err = svc.Push()
+	err = svc.Push(context.Background(), nil)
 	if err == nil {
 		t.Error("Push should fail when no git repo exists")
 	}
@@ -471,7 +472,7 @@ func TestDefaultServicePullNoRemote(t *testing.T) {
 	}
 
 	// Pull should fail - no remote configured
-	_, err = svc.Pull()
+	_, err = svc.Pull(context.Background(), nil)
 	if err == nil {
 		t.Error("Pull should fail when no remote configured")
 	}
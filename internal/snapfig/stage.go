@@ -0,0 +1,140 @@
+package snapfig
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// stagingDir is where a transactional copy is written before it
+// replaces the vault.
+func stagingDir(vaultDir string) string {
+	return filepath.Clean(vaultDir) + ".staging"
+}
+
+// previousDir holds the replaced vault while a staged copy is swapped in.
+func previousDir(vaultDir string) string {
+	return filepath.Clean(vaultDir) + ".previous"
+}
+
+// stageVault clones the vault, without its .git, into a fresh staging
+// directory next to it. Files are hard links: every write to the vault
+// replaces its target through a rename, so the vault's own copies are
+// never modified through the staging directory.
+func stageVault(vaultDir string) (string, error) {
+	staging := stagingDir(vaultDir)
+	if err := os.RemoveAll(staging); err != nil {
+		return "", err
+	}
+
+	err := filepath.WalkDir(vaultDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(vaultDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == ".git" && d.IsDir() {
+			return filepath.SkipDir
+		}
+		dst := filepath.Join(staging, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(dst, info.Mode().Perm())
+		case d.Type()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dst)
+		case d.Type().IsRegular():
+			if err := os.Link(path, dst); err != nil {
+				return copyPlain(path, dst, info.Mode())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(staging)
+		return "", err
+	}
+	return staging, nil
+}
+
+// copyPlain copies a file where it cannot be hard linked.
+func copyPlain(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// swapVault replaces the vault with the staging directory and moves the
+// vault's .git over. Each step is a rename, and recoverVault finishes or
+// undoes a swap cut short.
+func swapVault(vaultDir, staging string) error {
+	previous := previousDir(vaultDir)
+	if err := os.RemoveAll(previous); err != nil {
+		return err
+	}
+
+	if err := os.Rename(vaultDir, previous); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, vaultDir); err != nil {
+		// Put the vault back as it was
+		if rerr := os.Rename(previous, vaultDir); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	return finishSwap(vaultDir, previous)
+}
+
+// finishSwap moves the .git left in the previous vault into the new one
+// and removes the rest.
+func finishSwap(vaultDir, previous string) error {
+	gitDir := filepath.Join(previous, ".git")
+	if _, err := os.Lstat(gitDir); err == nil {
+		if err := os.Rename(gitDir, filepath.Join(vaultDir, ".git")); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(previous)
+}
+
+// recoverVault cleans up after a transactional copy that was interrupted.
+// A swap stopped before the staged copy was in place is undone; one
+// stopped after it is finished. Leftover staging directories are removed.
+func recoverVault(vaultDir string) error {
+	previous := previousDir(vaultDir)
+	if _, err := os.Lstat(previous); err == nil {
+		if _, err := os.Lstat(vaultDir); os.IsNotExist(err) {
+			if err := os.Rename(previous, vaultDir); err != nil {
+				return err
+			}
+		} else if err := finishSwap(vaultDir, previous); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(stagingDir(vaultDir))
+}
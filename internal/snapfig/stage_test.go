@@ -0,0 +1,227 @@
+package snapfig
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestTransactionalCopySwapsInStagedVault(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "config"), []byte("v1"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "old"), []byte("old"), 0644)
+
+	cfg := &config.Config{
+		Git:           config.GitModeDisable,
+		VaultPath:     vaultDir,
+		Transactional: true,
+		Watching:      []config.Watched{{Path: ".config/app", Enabled: true}},
+	}
+	idx := LoadHashIndex(filepath.Join(tmpDir, "index.json"))
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, index: idx, meta: loadMetadata(vaultDir, false)}
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("first Copy() error: %v", err)
+	}
+	if result.GitError != nil {
+		t.Fatalf("first Copy() git error: %v", result.GitError)
+	}
+
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "config"), []byte("v2"), 0644)
+	os.Remove(filepath.Join(homeDir, ".config", "app", "old"))
+	result, err = copier.Copy()
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if result.GitError != nil {
+		t.Fatalf("second Copy() git error: %v", result.GitError)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(vaultDir, ".config", "app", "config"))
+	if string(data) != "v2" {
+		t.Errorf("vault content = %q, want %q", data, "v2")
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "app", "old")); !os.IsNotExist(err) {
+		t.Error("stale file should be removed from the vault")
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".git")); err != nil {
+		t.Errorf("vault .git should move over: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "manifest.yml")); err != nil {
+		t.Errorf("manifest should be written: %v", err)
+	}
+	for _, dir := range []string{stagingDir(vaultDir), previousDir(vaultDir)} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", dir)
+		}
+	}
+	if n := commitCount(t, vaultDir); n != 2 {
+		t.Errorf("vault should have 2 commits, got %d", n)
+	}
+
+	// Index entries point at the vault, not the staging directory
+	for path := range idx.entries {
+		if rel, err := filepath.Rel(stagingDir(vaultDir), path); err == nil && filepath.IsLocal(rel) {
+			t.Errorf("index entry %s left in the staging directory", path)
+		}
+	}
+}
+
+func TestTransactionalCopyFailureKeepsVault(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores permission bits")
+	}
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	os.MkdirAll(filepath.Join(homeDir, ".config", "app"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "config"), []byte("v1"), 0644)
+	os.MkdirAll(filepath.Join(homeDir, ".ssh"), 0755)
+	os.WriteFile(filepath.Join(homeDir, ".ssh", "config"), []byte("Host *"), 0644)
+
+	cfg := &config.Config{
+		Git:           config.GitModeDisable,
+		VaultPath:     vaultDir,
+		Transactional: true,
+		Watching: []config.Watched{
+			{Path: ".config/app", Enabled: true},
+			{Path: ".ssh", Enabled: true},
+		},
+	}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, meta: loadMetadata(vaultDir, false)}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("first Copy() error: %v", err)
+	}
+
+	// The first path copies fine, the second fails
+	os.WriteFile(filepath.Join(homeDir, ".config", "app", "config"), []byte("v2"), 0644)
+	os.Chmod(filepath.Join(homeDir, ".ssh", "config"), 0000)
+	defer os.Chmod(filepath.Join(homeDir, ".ssh", "config"), 0644)
+
+	if _, err := copier.Copy(); err == nil {
+		t.Fatal("Copy() should fail on the unreadable file")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(vaultDir, ".config", "app", "config"))
+	if string(data) != "v1" {
+		t.Errorf("vault content = %q, a failed run must leave %q", data, "v1")
+	}
+	if _, err := os.Stat(stagingDir(vaultDir)); !os.IsNotExist(err) {
+		t.Error("staging directory should be removed after a failed run")
+	}
+	if n := commitCount(t, vaultDir); n != 1 {
+		t.Errorf("vault should have 1 commit, got %d", n)
+	}
+}
+
+func TestTransactionalCopyBlockedKeepsVault(t *testing.T) {
+	copier, vaultDir := newSecretsTestCopier(t, config.SecretsBlock)
+	copier.cfg.Transactional = true
+
+	result, err := copier.Copy()
+	if !errors.Is(err, ErrCommitBlocked) {
+		t.Fatalf("Copy() error = %v, want ErrCommitBlocked", err)
+	}
+	if result == nil || len(result.Findings) != 1 {
+		t.Fatalf("result should carry findings, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".kube", "kubectx")); !os.IsNotExist(err) {
+		t.Error("a blocked run should not change the vault")
+	}
+	if _, err := os.Stat(stagingDir(vaultDir)); !os.IsNotExist(err) {
+		t.Error("staging directory should be removed after a blocked run")
+	}
+}
+
+func TestRecoverVault(t *testing.T) {
+	tests := []struct {
+		name    string
+		vault   bool // the staged copy was already renamed into place
+		want    string
+		wantGit bool
+	}{
+		{name: "swap cut before staged copy was in place", vault: false, want: "old", wantGit: true},
+		{name: "swap cut after staged copy was in place", vault: true, want: "new", wantGit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultDir := filepath.Join(t.TempDir(), "vault")
+			previous := previousDir(vaultDir)
+			os.MkdirAll(filepath.Join(previous, ".git"), 0755)
+			os.WriteFile(filepath.Join(previous, "file"), []byte("old"), 0644)
+			if tt.vault {
+				os.MkdirAll(vaultDir, 0755)
+				os.WriteFile(filepath.Join(vaultDir, "file"), []byte("new"), 0644)
+			}
+			os.MkdirAll(stagingDir(vaultDir), 0755)
+
+			if err := recoverVault(vaultDir); err != nil {
+				t.Fatalf("recoverVault() error: %v", err)
+			}
+
+			data, _ := os.ReadFile(filepath.Join(vaultDir, "file"))
+			if string(data) != tt.want {
+				t.Errorf("content = %q, want %q", data, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(vaultDir, ".git")); (err == nil) != tt.wantGit {
+				t.Errorf(".git present = %v, want %v", err == nil, tt.wantGit)
+			}
+			for _, dir := range []string{previous, stagingDir(vaultDir)} {
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("%s should be removed", dir)
+				}
+			}
+		})
+	}
+}
+
+func TestStageVaultLeavesVaultUntouched(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	os.MkdirAll(filepath.Join(vaultDir, ".git"), 0755)
+	os.MkdirAll(filepath.Join(vaultDir, ".config"), 0755)
+	os.WriteFile(filepath.Join(vaultDir, ".config", "file"), []byte("old"), 0644)
+	os.Symlink("file", filepath.Join(vaultDir, ".config", "link"))
+
+	staging, err := stageVault(vaultDir)
+	if err != nil {
+		t.Fatalf("stageVault() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(staging, ".git")); !os.IsNotExist(err) {
+		t.Error(".git should not be staged")
+	}
+	if target, err := os.Readlink(filepath.Join(staging, ".config", "link")); err != nil || target != "file" {
+		t.Errorf("staged symlink = %q, %v; want %q", target, err, "file")
+	}
+
+	if err := writeFileAtomic(filepath.Join(staging, ".config", "file"), []byte("new"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic() error: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(vaultDir, ".config", "file"))
+	if string(data) != "old" {
+		t.Errorf("vault content = %q, writes to the staging directory must not reach it", data)
+	}
+}
+
+func commitCount(t *testing.T, dir string) int {
+	t.Helper()
+	out, err := exec.Command("git", "-C", dir, "rev-list", "--count", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("git rev-list: %v", err)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(out)))
+	return n
+}
@@ -0,0 +1,25 @@
+package snapfig
+
+import (
+	"os"
+	"syscall"
+)
+
+// changeTime returns the inode change time in UnixNano, or 0 if unknown.
+// Unlike mtime, ctime cannot be set by user tools.
+func changeTime(info os.FileInfo) int64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return st.Ctim.Nano()
+}
+
+// fileOwner returns the uid and gid of a file.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
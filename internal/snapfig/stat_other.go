@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package snapfig
+
+import "os"
+
+// changeTime is not available on this platform.
+func changeTime(info os.FileInfo) int64 {
+	return 0
+}
+
+// fileOwner is not available on this platform.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
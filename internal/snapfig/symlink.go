@@ -0,0 +1,163 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// linkKind is how a symlink below a watched path goes into the vault.
+type linkKind int
+
+const (
+	linkLoop     linkKind = iota // followed back to a directory being walked: left out
+	linkMarker                   // a versioned JSON marker describing the link
+	linkPreserve                 // the symlink itself
+	linkFile                     // the content of the target file
+	linkDir                      // the content of the target directory
+)
+
+// classifyLink decides how the symlink at path is stored under the
+// policy of its watched path. A dangling link cannot be followed and
+// gets a marker instead.
+func classifyLink(path string, spec *walkSpec) linkKind {
+	switch spec.symlinks {
+	case config.SymlinksPreserve:
+		return linkPreserve
+	case config.SymlinksFollow:
+		info, err := os.Stat(path)
+		if err != nil {
+			return linkMarker
+		}
+		if !info.IsDir() {
+			return linkFile
+		}
+		if real, err := filepath.EvalSymlinks(path); err == nil && spec.ancestors[real] {
+			return linkLoop
+		}
+		return linkDir
+	default:
+		return linkMarker
+	}
+}
+
+// vaultName returns the name an entry named name has in the vault.
+func (k linkKind) vaultName(name string, spec *walkSpec) string {
+	switch k {
+	case linkMarker:
+		return name + symlinkMarkerExt
+	case linkFile:
+		return name + spec.vaultSuffix(name)
+	default:
+		return name
+	}
+}
+
+// enter marks dir as being walked while following symlinks,
+// and returns the func that unmarks it.
+func (s *walkSpec) enter(dir string) func() {
+	if s.symlinks != config.SymlinksFollow {
+		return func() {}
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return func() {}
+	}
+	if s.ancestors == nil {
+		s.ancestors = make(map[string]bool)
+	}
+	s.ancestors[real] = true
+	return func() { delete(s.ancestors, real) }
+}
+
+// linkTarget reads the target of the symlink at path. An absolute target
+// inside home, from a link inside home, is made relative to the link so
+// it still resolves under a home with another user name.
+func linkTarget(home, path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil || !filepath.IsAbs(target) {
+		return target, err
+	}
+	if displayPath(home, target) == target || displayPath(home, path) == path {
+		return target, nil
+	}
+	if rel, err := filepath.Rel(filepath.Dir(path), target); err == nil {
+		return rel, nil
+	}
+	return target, nil
+}
+
+// copyLink stores the symlink at src as a symlink at dst.
+func (c *Copier) copyLink(src, dst string, result *CopyResult) error {
+	target, err := linkTarget(c.home, src)
+	if err != nil {
+		return err
+	}
+
+	if existing, err := os.Readlink(dst); err == nil && existing == target {
+		result.FilesSkipped++
+		return nil
+	}
+	if c.dryRun {
+		c.planWrite(dst, int64(len(target)), target, result)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+
+	c.index.Forget(dst)
+	result.FilesUpdated++
+	return nil
+}
+
+// clearLink removes a symlink left at dst by the preserve policy, so
+// content copied there is not written through it.
+func (c *Copier) clearLink(dst string) error {
+	if c.dryRun {
+		return nil
+	}
+	if info, err := os.Lstat(dst); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(dst)
+	}
+	return nil
+}
+
+// restoreLink recreates a symlink stored as is in the vault. An existing
+// file at dst is backed up and replaced; a directory is not.
+func (r *Restorer) restoreLink(src, dst string, result *RestoreResult) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	if existing, err := os.Readlink(dst); err == nil && existing == target {
+		result.FilesSkipped++
+		return nil
+	}
+
+	if err := r.mkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := r.backup(dst, result); err != nil {
+		return err
+	}
+	err = os.Remove(dst)
+	if err == nil || os.IsNotExist(err) {
+		err = os.Symlink(target, dst)
+	}
+	if err := r.elevate(err, "ln", "-sfn", target, dst); err != nil {
+		return err
+	}
+
+	result.FilesUpdated++
+	return nil
+}
@@ -0,0 +1,262 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+// newSymlinkTestHome creates a watched directory with relative, absolute,
+// directory, looping and dangling symlinks.
+func newSymlinkTestHome(t *testing.T) (tmpDir, homeDir string) {
+	t.Helper()
+	tmpDir = t.TempDir()
+	homeDir = filepath.Join(tmpDir, "home")
+
+	appDir := filepath.Join(homeDir, ".config", "app")
+	os.MkdirAll(filepath.Join(appDir, "themes"), 0755)
+	os.WriteFile(filepath.Join(appDir, "app.conf"), []byte("theme = dark\n"), 0644)
+	os.WriteFile(filepath.Join(appDir, "themes", "dark.conf"), []byte("bg = black\n"), 0644)
+	os.Symlink("app.conf", filepath.Join(appDir, "rel"))
+	os.Symlink(filepath.Join(appDir, "app.conf"), filepath.Join(appDir, "abs"))
+	os.Symlink("themes", filepath.Join(appDir, "current"))
+	os.Symlink("..", filepath.Join(appDir, "themes", "up"))
+	os.Symlink("missing.conf", filepath.Join(appDir, "gone"))
+	return tmpDir, homeDir
+}
+
+func copyWithPolicy(t *testing.T, tmpDir, homeDir string, w config.Watched) (*CopyResult, string) {
+	t.Helper()
+	vaultDir := filepath.Join(tmpDir, "vault")
+	cfg := &config.Config{Git: config.GitModeDisable, VaultPath: vaultDir, Watching: []config.Watched{w}}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir}
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy(%s) error: %v", w.Symlinks, err)
+	}
+	return result, vaultDir
+}
+
+func TestSymlinksMarker(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir, homeDir := newSymlinkTestHome(t)
+
+	_, vaultDir := copyWithPolicy(t, tmpDir, homeDir, config.Watched{Path: ".config/app", Enabled: true})
+	app := filepath.Join(vaultDir, ".config", "app")
+
+	// The absolute target is rewritten relative to the link
+	for _, name := range []string{"rel", "abs"} {
+		content, err := os.ReadFile(filepath.Join(app, name+symlinkMarkerExt))
+		if err != nil {
+			t.Fatalf("marker %s: %v", name, err)
+		}
+		got, _, err := decodeSymlinkMarker(content, name+symlinkMarkerExt)
+		info, _ := os.Lstat(filepath.Join(homeDir, ".config", "app", name))
+		want := newSymlinkMarker(name, "app.conf", info.Mode())
+		if err != nil || got != want {
+			t.Errorf("marker %s = %+v, %v; want %+v", name, got, err, want)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(app, "rel")); !os.IsNotExist(err) {
+		t.Error("marker policy should not store the symlink itself")
+	}
+}
+
+func TestSymlinksPreserve(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir, homeDir := newSymlinkTestHome(t)
+
+	w := config.Watched{Path: ".config/app", Enabled: true, Symlinks: config.SymlinksPreserve}
+	_, vaultDir := copyWithPolicy(t, tmpDir, homeDir, w)
+	app := filepath.Join(vaultDir, ".config", "app")
+
+	tests := map[string]string{
+		"rel":                         "app.conf",
+		"abs":                         "app.conf",
+		"current":                     "themes",
+		filepath.Join("themes", "up"): "..",
+		"gone":                        "missing.conf",
+	}
+	for name, want := range tests {
+		if got, err := os.Readlink(filepath.Join(app, name)); err != nil || got != want {
+			t.Errorf("vault link %s -> %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	cfg := &config.Config{Git: config.GitModeDisable, Watching: []config.Watched{w}}
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: vaultDir}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(newHome, ".config", "app", "abs"))
+	if err != nil || string(got) != "theme = dark\n" {
+		t.Errorf("restored link should resolve in the new home, got %q, %v", got, err)
+	}
+
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("second Restore() error: %v", err)
+	}
+	if result.FilesUpdated != 0 {
+		t.Errorf("second Restore() updated %d entries, want 0", result.FilesUpdated)
+	}
+}
+
+func TestSymlinksFollow(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir, homeDir := newSymlinkTestHome(t)
+
+	w := config.Watched{Path: ".config/app", Enabled: true, Symlinks: config.SymlinksFollow}
+	result, vaultDir := copyWithPolicy(t, tmpDir, homeDir, w)
+	app := filepath.Join(vaultDir, ".config", "app")
+
+	for _, name := range []string{"rel", "abs", filepath.Join("current", "dark.conf")} {
+		info, err := os.Lstat(filepath.Join(app, name))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Errorf("%s should be copied as a regular file: %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(app, "themes", "up")); !os.IsNotExist(err) {
+		t.Error("a link back up the tree should not be followed")
+	}
+	want := []string{filepath.Join(".config", "app", "current", "up"), filepath.Join(".config", "app", "themes", "up")}
+	if !reflect.DeepEqual(result.Loops, want) {
+		t.Errorf("Loops = %v, want %v", result.Loops, want)
+	}
+	if _, err := os.Stat(filepath.Join(app, "gone"+symlinkMarkerExt)); err != nil {
+		t.Error("a dangling link should fall back to a marker")
+	}
+}
+
+func TestSymlinksPolicySwitch(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir, homeDir := newSymlinkTestHome(t)
+
+	w := config.Watched{Path: ".config/app", Enabled: true, Symlinks: config.SymlinksPreserve}
+	copyWithPolicy(t, tmpDir, homeDir, w)
+
+	// Following now must replace the vault links, not write through them
+	w.Symlinks = config.SymlinksFollow
+	_, vaultDir := copyWithPolicy(t, tmpDir, homeDir, w)
+
+	info, err := os.Lstat(filepath.Join(vaultDir, ".config", "app", "current"))
+	if err != nil || !info.IsDir() {
+		t.Errorf("followed directory should replace the vault link: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".config", "app", "rel"+symlinkMarkerExt)); !os.IsNotExist(err) {
+		t.Error("no marker expected for a followed link")
+	}
+
+	// Back to markers: the copied content is stale
+	w.Symlinks = config.SymlinksMarker
+	result, _ := copyWithPolicy(t, tmpDir, homeDir, w)
+	if result.FilesRemoved == 0 {
+		t.Error("switching to markers should remove followed content")
+	}
+	if _, err := os.Lstat(filepath.Join(vaultDir, ".config", "app", "current")); !os.IsNotExist(err) {
+		t.Error("followed directory should be removed as stale")
+	}
+}
+
+func TestSymlinkWatchedPath(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	os.MkdirAll(filepath.Join(homeDir, "dotfiles"), 0755)
+	os.WriteFile(filepath.Join(homeDir, "dotfiles", "zshrc"), []byte("export EDITOR=vim\n"), 0644)
+	os.Symlink(filepath.Join(homeDir, "dotfiles", "zshrc"), filepath.Join(homeDir, ".zshrc"))
+
+	// Followed by default
+	_, vaultDir := copyWithPolicy(t, tmpDir, homeDir, config.Watched{Path: ".zshrc", Enabled: true})
+	if got, _ := os.ReadFile(filepath.Join(vaultDir, ".zshrc")); string(got) != "export EDITOR=vim\n" {
+		t.Errorf("vault .zshrc = %q, want the target content", got)
+	}
+
+	// Stored as a link under preserve, replacing the copied content
+	w := config.Watched{Path: ".zshrc", Enabled: true, Symlinks: config.SymlinksPreserve}
+	copyWithPolicy(t, tmpDir, homeDir, w)
+	if got, err := os.Readlink(filepath.Join(vaultDir, ".zshrc")); err != nil || got != filepath.Join("dotfiles", "zshrc") {
+		t.Errorf("vault .zshrc -> %q, %v", got, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(homeDir, "dotfiles", "zshrc")); string(got) != "export EDITOR=vim\n" {
+		t.Errorf("link target changed to %q", got)
+	}
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	cfg := &config.Config{Git: config.GitModeDisable, Watching: []config.Watched{w}}
+	restorer := &Restorer{cfg: cfg, home: newHome, vaultDir: vaultDir}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if got, err := os.Readlink(filepath.Join(newHome, ".zshrc")); err != nil || got != filepath.Join("dotfiles", "zshrc") {
+		t.Errorf("restored .zshrc -> %q, %v", got, err)
+	}
+}
+
+func TestSymlinkWatchedPathPreserved(t *testing.T) {
+	setupTestGitConfig(t)
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	os.MkdirAll(filepath.Join(homeDir, "dotfiles", "nvim"), 0755)
+	os.WriteFile(filepath.Join(homeDir, "dotfiles", "nvim", "init.lua"), []byte("vim.o.number = true\n"), 0644)
+	os.MkdirAll(filepath.Join(homeDir, ".config"), 0755)
+	os.Symlink(filepath.Join(homeDir, "dotfiles", "nvim"), filepath.Join(homeDir, ".config", "nvim"))
+	os.Symlink(filepath.Join(homeDir, "dotfiles", "gone"), filepath.Join(homeDir, ".gone"))
+
+	vaultDir := filepath.Join(tmpDir, "vault")
+	cfg := &config.Config{Git: config.GitModeDisable, VaultPath: vaultDir, Watching: []config.Watched{
+		{Path: ".config/nvim", Enabled: true, Symlinks: config.SymlinksPreserve},
+		{Path: ".gone", Enabled: true, Symlinks: config.SymlinksPreserve},
+	}}
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir}
+	result, err := copier.Copy()
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	// Neither the directory link nor the dangling one is followed
+	if len(result.Copied) != 2 {
+		t.Errorf("Copied = %v, Skipped = %v, want both links", result.Copied, result.Skipped)
+	}
+	for name, want := range map[string]string{
+		filepath.Join(".config", "nvim"): filepath.Join("..", "dotfiles", "nvim"),
+		".gone":                          filepath.Join("dotfiles", "gone"),
+	} {
+		if got, err := os.Readlink(filepath.Join(vaultDir, name)); err != nil || got != want {
+			t.Errorf("vault %s -> %q, %v, want %q", name, got, err, want)
+		}
+	}
+	for _, item := range copier.copiedItems {
+		if item.IsDir {
+			t.Errorf("%s recorded as a directory, want the link", item.Path)
+		}
+	}
+}
+
+func TestLinkTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home")
+	os.MkdirAll(filepath.Join(home, ".config"), 0755)
+
+	tests := []struct {
+		link   string
+		target string
+		want   string
+	}{
+		{filepath.Join(home, ".config", "a"), "b", "b"},
+		{filepath.Join(home, ".config", "c"), filepath.Join(home, "dotfiles", "c"), filepath.Join("..", "dotfiles", "c")},
+		{filepath.Join(home, ".config", "d"), "/etc/d", "/etc/d"},
+		{filepath.Join(tmpDir, "e"), filepath.Join(home, "e"), filepath.Join(home, "e")},
+	}
+	for _, tt := range tests {
+		os.Symlink(tt.target, tt.link)
+		got, err := linkTarget(home, tt.link)
+		if err != nil || got != tt.want {
+			t.Errorf("linkTarget(%s -> %s) = %q, %v; want %q", tt.link, tt.target, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package snapfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/adrianpk/snapfig/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// templateExt marks a file as a template source. On restore it is
+// rendered to the same name without the suffix.
+const templateExt = ".tmpl"
+
+// varsFilename holds a host's template variables inside its vault layer.
+const varsFilename = "vars.yml"
+
+// TemplateData is the data available to templates, e.g.
+// {{ .Hostname }} or {{ .Vars.email }}.
+type TemplateData struct {
+	Hostname string
+	OS       string
+	Arch     string
+	User     string
+	Home     string
+	Vars     map[string]string
+}
+
+// templateEngine renders vault templates for one host.
+// Data is gathered on first use.
+type templateEngine struct {
+	cfg      *config.Config
+	vaultDir string
+	host     string
+	home     string
+
+	once sync.Once
+	data *TemplateData
+	err  error
+}
+
+func newTemplateEngine(cfg *config.Config, vaultDir, host, home string) *templateEngine {
+	return &templateEngine{cfg: cfg, vaultDir: vaultDir, host: host, home: home}
+}
+
+// loadData builds the template data. Variables come from the host's
+// vars file in the vault, overridden by the vars section of the config.
+func (e *templateEngine) loadData() (*TemplateData, error) {
+	data := &TemplateData{
+		Hostname: e.host,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Home:     e.home,
+		Vars:     make(map[string]string),
+	}
+	if u, err := user.Current(); err == nil {
+		data.User = u.Username
+	}
+
+	if e.host != "" {
+		content, err := os.ReadFile(filepath.Join(HostLayer(e.vaultDir, e.host), varsFilename))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(content, &data.Vars); err != nil {
+				return nil, fmt.Errorf("failed to parse %s vars: %w", e.host, err)
+			}
+		}
+	}
+	for k, v := range e.cfg.Vars {
+		data.Vars[k] = v
+	}
+
+	return data, nil
+}
+
+// render executes a template source. Unknown variables are errors,
+// so a missing per-host value is not silently rendered as empty.
+func (e *templateEngine) render(name string, src []byte) ([]byte, error) {
+	if e == nil {
+		return nil, fmt.Errorf("%s: templates are not available", name)
+	}
+	e.once.Do(func() {
+		e.data, e.err = e.loadData()
+	})
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"env": os.Getenv}).
+		Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, e.data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// isTemplate reports whether a vault or source file name is a template source.
+func isTemplate(name string) bool {
+	return strings.HasSuffix(plainRel(name), templateExt)
+}
+
+// renderedName returns the output name of a template source.
+func renderedName(name string) string {
+	return strings.TrimSuffix(plainRel(name), templateExt)
+}
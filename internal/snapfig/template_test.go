@@ -0,0 +1,262 @@
+package snapfig
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/adrianpk/snapfig/internal/config"
+)
+
+func TestTemplateRender(t *testing.T) {
+	vaultDir := t.TempDir()
+	os.MkdirAll(HostLayer(vaultDir, "laptop"), 0755)
+	os.WriteFile(filepath.Join(HostLayer(vaultDir, "laptop"), varsFilename),
+		[]byte("email: me@home\neditor: vim\n"), 0644)
+
+	cfg := &config.Config{Vars: map[string]string{"editor": "nvim"}}
+	engine := newTemplateEngine(cfg, vaultDir, "laptop", "/home/me")
+
+	src := []byte("{{ .Hostname }} {{ .OS }} {{ .Home }} {{ .Vars.email }} {{ .Vars.editor }}")
+	got, err := engine.render("gitconfig.tmpl", src)
+	if err != nil {
+		t.Fatalf("render() error: %v", err)
+	}
+	want := "laptop " + runtime.GOOS + " /home/me me@home nvim"
+	if string(got) != want {
+		t.Errorf("render() = %q, want %q", got, want)
+	}
+
+	if _, err := engine.render("x.tmpl", []byte("{{ .Vars.missing }}")); err == nil {
+		t.Error("render() with an unknown variable should fail")
+	}
+
+	t.Setenv("SNAPFIG_TEST_VAR", "from-env")
+	got, err = engine.render("x.tmpl", []byte(`{{ env "SNAPFIG_TEST_VAR" }}`))
+	if err != nil || string(got) != "from-env" {
+		t.Errorf("render(env) = %q, %v", got, err)
+	}
+
+	var nilEngine *templateEngine
+	if _, err := nilEngine.render("x.tmpl", src); err == nil {
+		t.Error("nil engine should fail to render")
+	}
+}
+
+func TestTemplateNames(t *testing.T) {
+	if !isTemplate("gitconfig.tmpl") || !isTemplate("gitconfig.tmpl"+EncryptedExt) || isTemplate("gitconfig") {
+		t.Error("isTemplate() misclassified a name")
+	}
+	if got := renderedName("a/gitconfig.tmpl" + EncryptedExt); got != "a/gitconfig" {
+		t.Errorf("renderedName() = %q, want a/gitconfig", got)
+	}
+
+	spec := &walkSpec{template: true, encrypt: true}
+	if got := spec.vaultSuffix("config"); got != templateExt+EncryptedExt {
+		t.Errorf("vaultSuffix() = %q", got)
+	}
+	if got := spec.vaultSuffix("config.tmpl"); got != EncryptedExt {
+		t.Errorf("vaultSuffix(marker) = %q", got)
+	}
+	if got := spec.displayRel("a/config.tmpl" + EncryptedExt); got != "a/config" {
+		t.Errorf("displayRel() = %q", got)
+	}
+}
+
+func TestTemplateMarkerFiles(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+
+	gitDir := filepath.Join(homeDir, ".config", "git")
+	os.MkdirAll(gitDir, 0755)
+	os.WriteFile(filepath.Join(gitDir, "config.tmpl"), []byte("email = {{ .Vars.email }}\n"), 0644)
+	os.WriteFile(filepath.Join(gitDir, "config"), []byte("email = old\n"), 0644)
+	os.WriteFile(filepath.Join(gitDir, "ignore"), []byte("*.swp\n"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Vars:      map[string]string{"email": "me@home"},
+		Watching:  []config.Watched{{Path: ".config/git", Enabled: true}},
+	}
+
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	vaultGit := filepath.Join(vaultDir, ".config", "git")
+	if _, err := os.Stat(filepath.Join(vaultGit, "config.tmpl")); err != nil {
+		t.Errorf("template source should be in vault: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultGit, "config")); !os.IsNotExist(err) {
+		t.Error("rendered output next to a template should not be in vault")
+	}
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	restorer := &Restorer{
+		cfg:       cfg,
+		home:      newHome,
+		vaultDir:  vaultDir,
+		templates: newTemplateEngine(cfg, vaultDir, "", newHome),
+	}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	checks := map[string]string{
+		"config.tmpl": "email = {{ .Vars.email }}\n",
+		"config":      "email = me@home\n",
+		"ignore":      "*.swp\n",
+	}
+	for name, want := range checks {
+		got, err := os.ReadFile(filepath.Join(newHome, ".config", "git", name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	result, err := restorer.Restore()
+	if err != nil {
+		t.Fatalf("second Restore() error: %v", err)
+	}
+	if result.FilesUpdated != 0 {
+		t.Errorf("second Restore() updated %d files, want 0", result.FilesUpdated)
+	}
+}
+
+func TestTemplatePath(t *testing.T) {
+	setupTestGitConfig(t)
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(homeDir, 0755)
+	os.WriteFile(filepath.Join(homeDir, ".gitconfig"), []byte("email = me@home\n"), 0644)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Vars:      map[string]string{"email": "me@work"},
+		Watching:  []config.Watched{{Path: ".gitconfig", Enabled: true, Template: true}},
+	}
+	newCopier := func() *Copier {
+		return &Copier{
+			cfg:        cfg,
+			home:       homeDir,
+			vaultDir:   vaultDir,
+			snapfigDir: tmpDir,
+			templates:  newTemplateEngine(cfg, vaultDir, "", homeDir),
+		}
+	}
+
+	// The first copy seeds the template source from the local file
+	if _, err := newCopier().Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	tmplPath := filepath.Join(vaultDir, ".gitconfig"+templateExt)
+	if _, err := os.Stat(tmplPath); err != nil {
+		t.Fatalf("template source not seeded: %v", err)
+	}
+	os.WriteFile(tmplPath, []byte("email = {{ .Vars.email }}\n"), 0644)
+
+	// The local file no longer matches the rendered template
+	result, err := newCopier().Copy()
+	if err != nil {
+		t.Fatalf("second Copy() error: %v", err)
+	}
+	if len(result.TemplateDrift) != 1 || result.TemplateDrift[0] != ".gitconfig" {
+		t.Errorf("TemplateDrift = %v, want [.gitconfig]", result.TemplateDrift)
+	}
+	if got, _ := os.ReadFile(tmplPath); string(got) != "email = {{ .Vars.email }}\n" {
+		t.Errorf("template source overwritten: %q", got)
+	}
+
+	restorer := &Restorer{
+		cfg:       cfg,
+		home:      homeDir,
+		vaultDir:  vaultDir,
+		templates: newTemplateEngine(cfg, vaultDir, "", homeDir),
+	}
+	entries, err := restorer.ListVaultEntries()
+	if err != nil || len(entries) != 1 || entries[0].Path != ".gitconfig" || entries[0].IsDir {
+		t.Errorf("ListVaultEntries() = %+v, %v", entries, err)
+	}
+
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(homeDir, ".gitconfig"))
+	if string(got) != "email = me@work\n" {
+		t.Errorf("rendered .gitconfig = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".gitconfig"+templateExt)); !os.IsNotExist(err) {
+		t.Error("template source should stay in the vault")
+	}
+
+	// Rendered output matches again: no drift
+	result, err = newCopier().Copy()
+	if err != nil {
+		t.Fatalf("third Copy() error: %v", err)
+	}
+	if len(result.TemplateDrift) != 0 {
+		t.Errorf("TemplateDrift = %v, want none", result.TemplateDrift)
+	}
+}
+
+func TestTemplatePathEncrypted(t *testing.T) {
+	setupTestGitConfig(t)
+	t.Setenv(PassphraseEnv, "test-passphrase")
+
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	vaultDir := filepath.Join(tmpDir, "vault")
+	os.MkdirAll(filepath.Join(homeDir, ".aws"), 0700)
+	os.WriteFile(filepath.Join(homeDir, ".aws", "config"), []byte("region = x\n"), 0600)
+
+	cfg := &config.Config{
+		Git:       config.GitModeDisable,
+		VaultPath: vaultDir,
+		Vars:      map[string]string{"region": "eu-west-1"},
+		Watching:  []config.Watched{{Path: ".aws", Enabled: true, Template: true, Encrypt: true}},
+	}
+	cipher := newVaultCipher(cfg)
+
+	copier := &Copier{cfg: cfg, home: homeDir, vaultDir: vaultDir, snapfigDir: tmpDir, cipher: cipher}
+	if _, err := copier.Copy(); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+
+	blobPath := filepath.Join(vaultDir, ".aws", "config"+templateExt+EncryptedExt)
+	blob, err := cipher.encrypt([]byte("region = {{ .Vars.region }}\n"))
+	if err != nil {
+		t.Fatalf("encrypt() error: %v", err)
+	}
+	if err := os.WriteFile(blobPath, blob, 0600); err != nil {
+		t.Fatalf("template blob not seeded: %v", err)
+	}
+
+	newHome := filepath.Join(tmpDir, "newhome")
+	restorer := &Restorer{
+		cfg:       cfg,
+		home:      newHome,
+		vaultDir:  vaultDir,
+		cipher:    newVaultCipher(cfg),
+		templates: newTemplateEngine(cfg, vaultDir, "", newHome),
+	}
+	if _, err := restorer.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(newHome, ".aws", "config"))
+	if string(got) != "region = eu-west-1\n" {
+		t.Errorf("rendered .aws/config = %q", got)
+	}
+	info, _ := os.Stat(filepath.Join(newHome, ".aws", "config"))
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("rendered mode = %v, want 0600", info.Mode().Perm())
+	}
+}
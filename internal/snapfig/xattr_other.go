@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package snapfig
+
+// readXattrs is not available on this platform.
+func readXattrs(path string) map[string][]byte {
+	return nil
+}
+
+// writeXattr is not available on this platform.
+func writeXattr(path, name string, value []byte) error {
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build linux || darwin
+
+package snapfig
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the extended attributes of path, or nil if it has
+// none or the filesystem does not support them.
+func readXattrs(path string) map[string][]byte {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(path, buf)
+	if err != nil {
+		return nil
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := unix.Getxattr(path, string(name), nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = unix.Getxattr(path, string(name), value); err != nil {
+			continue
+		}
+		attrs[string(name)] = value[:n]
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
+
+// writeXattr sets an extended attribute on path.
+func writeXattr(path, name string, value []byte) error {
+	return unix.Setxattr(path, name, value, 0)
+}
@@ -2,9 +2,12 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/adrianpk/snapfig/internal/config"
@@ -19,6 +22,7 @@ const (
 	screenPicker screen = iota
 	screenSettings
 	screenRestorePicker
+	screenPlan
 )
 
 // Model is the root TUI model that manages screen navigation.
@@ -27,6 +31,7 @@ type Model struct {
 	picker        screens.PickerModel
 	settings      screens.SettingsModel
 	restorePicker screens.RestorePickerModel
+	plan          screens.PlanModel
 	service       snapfig.Service
 	configPath    string
 	width         int
@@ -34,6 +39,18 @@ type Model struct {
 	status        string
 	busy          bool
 	demoMode      bool
+
+	// Running operation
+	cancel   context.CancelFunc // cancels it on Esc, nil once cancelled
+	updates  chan snapfig.Progress
+	progress *snapfig.Progress // latest report, nil before the first
+	bar      progress.Model
+}
+
+// ProgressMsg carries a progress report of the running operation.
+type ProgressMsg struct {
+	updates  chan snapfig.Progress
+	progress snapfig.Progress
 }
 
 // CopyDoneMsg is sent when copy operation completes.
@@ -44,6 +61,15 @@ type CopyDoneMsg struct {
 	filesUpdated int // files actually copied
 	filesSkipped int // files unchanged
 	filesRemoved int // stale files removed
+	findings     int // suspected secrets
+	failed       int // files and paths not copied, continuing on errors
+	hookErrors   int // failed hooks
+}
+
+// PlanDoneMsg is sent when a copy plan has been computed.
+type PlanDoneMsg struct {
+	err  error
+	plan *snapfig.CopyPlan
 }
 
 // RestoreDoneMsg is sent when restore operation completes.
@@ -54,17 +80,21 @@ type RestoreDoneMsg struct {
 	skipped      int
 	filesUpdated int
 	filesSkipped int
+	denied       int // watched paths not written for lack of permission
+	hookErrors   int // failed hooks
 }
 
 // PushDoneMsg is sent when push operation completes.
 type PushDoneMsg struct {
-	err error
+	err        error
+	hookErrors int // failed hooks
 }
 
 // PullDoneMsg is sent when pull operation completes.
 type PullDoneMsg struct {
-	err    error
-	cloned bool
+	err        error
+	cloned     bool
+	hookErrors int // failed hooks
 }
 
 // BackupDoneMsg is sent when backup (copy+push) completes.
@@ -75,6 +105,8 @@ type BackupDoneMsg struct {
 	filesUpdated int
 	filesSkipped int
 	filesRemoved int
+	failed       int // files and paths not copied, continuing on errors
+	hookErrors   int // failed hooks
 }
 
 // SyncDoneMsg is sent when sync (pull+restore) completes.
@@ -86,6 +118,8 @@ type SyncDoneMsg struct {
 	skipped      int
 	filesUpdated int
 	filesSkipped int
+	denied       int // watched paths not written for lack of permission
+	hookErrors   int // failed hooks
 }
 
 // SelectiveRestoreDoneMsg is sent when selective restore completes.
@@ -96,6 +130,8 @@ type SelectiveRestoreDoneMsg struct {
 	skipped      int
 	filesUpdated int
 	filesSkipped int
+	denied       int // watched paths not written for lack of permission
+	hookErrors   int // failed hooks
 }
 
 // New creates a new root TUI model with a default service.
@@ -125,6 +161,7 @@ func NewWithService(svc snapfig.Service, configPath string, demoMode bool) Model
 		service:    svc,
 		configPath: configPath,
 		demoMode:   demoMode,
+		bar:        progress.New(progress.WithDefaultGradient(), progress.WithoutPercentage(), progress.WithWidth(progressBarWidth)),
 	}
 }
 
@@ -144,80 +181,105 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, cmd
 
 	case CopyDoneMsg:
-		m.busy = false
+		m.endOperation()
 		if msg.err != nil {
-			m.status = fmt.Sprintf("Error: %v", msg.err)
+			m.status = errorStatus(msg.err)
 		} else {
 			m.status = fmt.Sprintf("Copied: %d updated, %d unchanged, %d removed",
 				msg.filesUpdated, msg.filesSkipped, msg.filesRemoved)
+			if msg.findings > 0 {
+				m.status += fmt.Sprintf(", %d possible secrets (run 'snapfig copy' for details)", msg.findings)
+			}
+			m.status += failedNote(msg.failed) + hookNote(msg.hookErrors, "copy")
 		}
 		return m, nil
 
-	case RestoreDoneMsg:
+	case PlanDoneMsg:
 		m.busy = false
 		if msg.err != nil {
-			m.status = fmt.Sprintf("Error: %v", msg.err)
+			m.status = errorStatus(msg.err)
+			return m, nil
+		}
+		m.plan = screens.NewPlan(msg.plan)
+		updated, _ := m.plan.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height - 2})
+		m.plan = updated.(screens.PlanModel)
+		m.current = screenPlan
+		m.status = ""
+		return m, nil
+
+	case RestoreDoneMsg:
+		m.endOperation()
+		if msg.err != nil {
+			m.status = errorStatus(msg.err)
 		} else {
 			m.status = fmt.Sprintf("Restored: %d updated, %d unchanged",
-				msg.filesUpdated, msg.filesSkipped)
+				msg.filesUpdated, msg.filesSkipped) + backupNote(msg.backups) + deniedNote(msg.denied) + hookNote(msg.hookErrors, "restore")
 		}
 		return m, nil
 
 	case PushDoneMsg:
-		m.busy = false
+		m.endOperation()
 		if msg.err != nil {
-			m.status = fmt.Sprintf("Error: %v", msg.err)
+			m.status = errorStatus(msg.err)
 		} else {
-			m.status = "Pushed to remote"
+			m.status = "Pushed to remote" + hookNote(msg.hookErrors, "push")
 		}
 		return m, nil
 
 	case PullDoneMsg:
-		m.busy = false
+		m.endOperation()
 		if msg.err != nil {
-			m.status = fmt.Sprintf("Error: %v", msg.err)
+			m.status = errorStatus(msg.err)
 		} else if msg.cloned {
-			m.status = "Cloned from remote"
+			m.status = "Cloned from remote" + hookNote(msg.hookErrors, "pull")
 		} else {
-			m.status = "Pulled from remote"
+			m.status = "Pulled from remote" + hookNote(msg.hookErrors, "pull")
 		}
 		return m, nil
 
 	case BackupDoneMsg:
-		m.busy = false
+		m.endOperation()
 		if msg.err != nil {
-			m.status = fmt.Sprintf("Error: %v", msg.err)
+			m.status = errorStatus(msg.err)
 		} else {
 			m.status = fmt.Sprintf("Backup: %d updated, %d unchanged, %d removed, pushed",
-				msg.filesUpdated, msg.filesSkipped, msg.filesRemoved)
+				msg.filesUpdated, msg.filesSkipped, msg.filesRemoved) + failedNote(msg.failed) + hookNote(msg.hookErrors, "copy")
 		}
 		return m, nil
 
 	case SyncDoneMsg:
-		m.busy = false
+		m.endOperation()
 		if msg.err != nil {
-			m.status = fmt.Sprintf("Error: %v", msg.err)
+			m.status = errorStatus(msg.err)
 		} else {
 			action := "pulled"
 			if msg.cloned {
 				action = "cloned"
 			}
 			m.status = fmt.Sprintf("Sync: %s, %d updated, %d unchanged",
-				action, msg.filesUpdated, msg.filesSkipped)
+				action, msg.filesUpdated, msg.filesSkipped) + backupNote(msg.backups) + deniedNote(msg.denied) + hookNote(msg.hookErrors, "restore")
 		}
 		return m, nil
 
 	case SelectiveRestoreDoneMsg:
-		m.busy = false
+		m.endOperation()
 		m.current = screenPicker
 		if msg.err != nil {
-			m.status = fmt.Sprintf("Error: %v", msg.err)
+			m.status = errorStatus(msg.err)
 		} else {
 			m.status = fmt.Sprintf("Restored: %d updated, %d unchanged",
-				msg.filesUpdated, msg.filesSkipped)
+				msg.filesUpdated, msg.filesSkipped) + backupNote(msg.backups) + deniedNote(msg.denied) + hookNote(msg.hookErrors, "restore")
 		}
 		return m, nil
 
+	case ProgressMsg:
+		if msg.updates != m.updates {
+			// Sent by an operation that has ended
+			return m, nil
+		}
+		m.progress = &msg.progress
+		return m, waitProgress(m.updates)
+
 	case screens.RestorePickerInitMsg:
 		// Pass to restore picker
 		updated, cmd := m.restorePicker.Update(msg)
@@ -230,46 +292,66 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.String() {
 		case "ctrl+c", "f10":
 			return m, tea.Quit
+		case "esc":
+			if m.busy && m.cancel != nil {
+				m.cancel()
+				m.cancel = nil
+				m.status = "Cancelling..."
+				return m, nil
+			}
+		case "f1":
+			if !m.busy && m.current == screenPicker {
+				m.busy = true
+				m.status = "Planning copy..."
+				return m, m.doPlan()
+			}
+			return m, nil
 		case "f2":
 			if !m.busy {
+				if m.current == screenPlan {
+					m.current = screenPicker
+				}
 				m.busy = true
 				m.status = "Copying..."
-				return m, m.doCopy()
+				return m, m.run(m.doCopy())
 			}
 			return m, nil
 		case "f3":
 			if !m.busy {
 				m.busy = true
 				m.status = "Pushing..."
-				return m, m.doPush()
+				return m, m.run(m.doPush())
 			}
 			return m, nil
 		case "f4":
 			if !m.busy {
 				m.busy = true
 				m.status = "Pulling..."
-				return m, m.doPull()
+				return m, m.run(m.doPull())
 			}
 			return m, nil
 		case "f5":
 			if !m.busy {
 				m.busy = true
 				m.status = "Restoring..."
-				return m, m.doRestore()
+				return m, m.run(m.doRestore())
 			}
 			return m, nil
 		case "f7":
 			if !m.busy {
+				if m.current == screenPlan {
+					m.current = screenPicker
+				}
 				m.busy = true
 				m.status = "Backing up (copy + push)..."
-				return m, m.doBackup()
+				return m, m.run(m.doBackup())
 			}
 			return m, nil
 		case "f8":
 			if !m.busy {
 				m.busy = true
 				m.status = "Syncing (pull + restore)..."
-				return m, m.doSync()
+				return m, m.run(m.doSync())
 			}
 			return m, nil
 		case "f6":
@@ -321,11 +403,19 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			m.busy = true
 			m.status = "Restoring selected files..."
-			return m, m.doSelectiveRestore(selected)
+			return m, m.run(m.doSelectiveRestore(selected))
 		}
 
 		return m, cmd
 
+	case screenPlan:
+		updated, cmd := m.plan.Update(msg)
+		m.plan = updated.(screens.PlanModel)
+		if m.plan.WasClosed() {
+			m.current = screenPicker
+		}
+		return m, cmd
+
 	case screenSettings:
 		updated, cmd := m.settings.Update(msg)
 		m.settings = updated.(screens.SettingsModel)
@@ -377,6 +467,8 @@ func (m Model) View() string {
 		b.WriteString(m.picker.View())
 	case screenRestorePicker:
 		b.WriteString(m.restorePicker.View())
+	case screenPlan:
+		b.WriteString(m.plan.View())
 	case screenSettings:
 		b.WriteString(m.settings.View())
 	}
@@ -392,9 +484,11 @@ func (m Model) View() string {
 	// Status line
 	if m.status != "" {
 		b.WriteString("\n")
-		if strings.HasPrefix(m.status, "Error:") {
+		if strings.HasPrefix(m.status, "Error:") || strings.HasPrefix(m.status, vaultBusyStatus) {
 			b.WriteString(styles.Error.Render(m.status))
-		} else if m.busy {
+		} else if m.busy && m.cancel != nil {
+			b.WriteString(m.progressView())
+		} else if m.busy || m.status == cancelledStatus {
 			b.WriteString(styles.Subtitle.Render(m.status))
 		} else {
 			b.WriteString(styles.Success.Render(m.status))
@@ -415,6 +509,7 @@ func (m Model) renderActionBar() string {
 		key   string
 		label string
 	}{
+		{"F1", "Plan"},
 		{"F2", "Copy"},
 		{"F3", "Push"},
 		{"F4", "Pull"},
@@ -441,9 +536,46 @@ func (m Model) SelectedPaths() []screens.Selection {
 	return m.picker.Selected()
 }
 
+// watchingFromSelection builds the watching list from the picker selection.
+// Settings the picker does not edit (include/exclude and the like) are
+// carried over from the current entry for the same path.
+func watchingFromSelection(current []config.Watched, selected []screens.Selection) []config.Watched {
+	existing := make(map[string]config.Watched, len(current))
+	for _, w := range current {
+		existing[w.Path] = w
+	}
+
+	watching := make([]config.Watched, 0, len(selected))
+	for _, sel := range selected {
+		gitMode := config.GitModeRemove
+		switch sel.GitMode {
+		case screens.StateDisable:
+			gitMode = config.GitModeDisable
+		case screens.StateBundle:
+			gitMode = config.GitModeBundle
+		case screens.StateReference:
+			gitMode = config.GitModeReference
+		}
+		w := existing[sel.Path]
+		w.Path = sel.Path
+		w.Git = gitMode
+		w.Enabled = true
+		watching = append(watching, w)
+	}
+
+	// The picker browses $HOME only, so paths outside it are kept as they are
+	for _, w := range current {
+		if w.IsSystem() {
+			watching = append(watching, w)
+		}
+	}
+	return watching
+}
+
 // doCopy saves config and copies to vault.
 func (m *Model) doCopy() tea.Cmd {
 	svc := m.service
+	ctx, report := m.operation()
 	picker := m.picker
 	configPath := m.configPath
 	return func() tea.Msg {
@@ -453,19 +585,7 @@ func (m *Model) doCopy() tea.Cmd {
 			return CopyDoneMsg{err: fmt.Errorf("no paths selected")}
 		}
 
-		watching := make([]config.Watched, 0, len(selected))
-		for _, sel := range selected {
-			gitMode := config.GitModeRemove
-			if sel.GitMode == screens.StateDisable {
-				gitMode = config.GitModeDisable
-			}
-			watching = append(watching, config.Watched{
-				Path:    sel.Path,
-				Git:     gitMode,
-				Enabled: true,
-			})
-		}
-		svc.UpdateWatching(watching)
+		svc.UpdateWatching(watchingFromSelection(svc.Config().Watching, selected))
 
 		// Save config
 		if err := svc.SaveConfig(configPath); err != nil {
@@ -473,7 +593,7 @@ func (m *Model) doCopy() tea.Cmd {
 		}
 
 		// Copy to vault
-		result, err := svc.Copy()
+		result, err := svc.Copy(ctx, report)
 		if err != nil {
 			return CopyDoneMsg{err: err}
 		}
@@ -484,20 +604,184 @@ func (m *Model) doCopy() tea.Cmd {
 			filesUpdated: result.FilesUpdated,
 			filesSkipped: result.FilesSkipped,
 			filesRemoved: result.FilesRemoved,
+			findings:     len(result.Findings),
+			failed:       len(result.Errors),
+			hookErrors:   len(result.HookErrors),
+		}
+	}
+}
+
+// doPlan computes what a copy of the current selection would change.
+// The selection is applied but not saved: only F2 and F7 save it.
+func (m *Model) doPlan() tea.Cmd {
+	svc := m.service
+	picker := m.picker
+	return func() tea.Msg {
+		selected := picker.Selected()
+		if len(selected) == 0 {
+			return PlanDoneMsg{err: fmt.Errorf("no paths selected")}
+		}
+
+		svc.UpdateWatching(watchingFromSelection(svc.Config().Watching, selected))
+
+		plan, err := svc.PlanCopy()
+		if err != nil {
+			return PlanDoneMsg{err: err}
+		}
+		return PlanDoneMsg{plan: plan}
+	}
+}
+
+// vaultBusyStatus starts the status shown while another snapfig
+// process, e.g. the daemon, holds the vault lock.
+const vaultBusyStatus = "Vault busy"
+
+// cancelledStatus is shown once an operation stopped on Esc.
+const cancelledStatus = "Cancelled"
+
+// errorStatus renders an operation error for the status line.
+func errorStatus(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return cancelledStatus
+	}
+	var busy *snapfig.BusyError
+	if errors.As(err, &busy) {
+		if busy.Holder == nil {
+			return vaultBusyStatus + ": another snapfig process is using it, try again later"
+		}
+		return fmt.Sprintf("%s: in use by pid %d (%s), try again later", vaultBusyStatus, busy.Holder.PID, busy.Holder.Command)
+	}
+	return fmt.Sprintf("Error: %v", err)
+}
+
+// backupNote reports files restore saved before overwriting them.
+func backupNote(backups int) string {
+	if backups == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d backed up", backups)
+}
+
+// deniedNote reports watched paths restore could not write.
+func deniedNote(denied int) string {
+	if denied == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d paths need privileges (run 'snapfig restore' for details)", denied)
+}
+
+// failedNote reports files and paths a copy continuing on errors
+// could not back up.
+func failedNote(failed int) string {
+	if failed == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d not copied (see the daemon log or 'snapfig copy')", failed)
+}
+
+// progressBarWidth is the width of the progress bar in the status line.
+const progressBarWidth = 30
+
+// operation prepares a cancellable operation: Esc cancels the context,
+// and the reports sent to the ProgressFunc are shown until it ends.
+// Only the latest report is kept while the UI is behind.
+func (m *Model) operation() (context.Context, snapfig.ProgressFunc) {
+	ctx, cancel := context.WithCancel(snapfig.WithTrigger(context.Background(), snapfig.TriggerTUI))
+	updates := make(chan snapfig.Progress, 1)
+	m.cancel = cancel
+	m.updates = updates
+	m.progress = nil
+
+	return ctx, func(p snapfig.Progress) {
+		for {
+			select {
+			case updates <- p:
+				return
+			default:
+			}
+			select {
+			case <-updates:
+			default:
+			}
 		}
 	}
 }
 
+// run starts cmd, built by one of the do methods, together with the
+// relay of its progress reports.
+func (m *Model) run(cmd tea.Cmd) tea.Cmd {
+	return tea.Batch(cmd, waitProgress(m.updates))
+}
+
+// waitProgress waits for the next progress report of an operation.
+func waitProgress(updates chan snapfig.Progress) tea.Cmd {
+	return func() tea.Msg {
+		p, ok := <-updates
+		if !ok {
+			return nil
+		}
+		return ProgressMsg{updates: updates, progress: p}
+	}
+}
+
+// endOperation clears the state of the operation that just ended.
+// Its done message comes after its last report, so closing is safe.
+func (m *Model) endOperation() {
+	m.busy = false
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	if m.updates != nil {
+		close(m.updates)
+		m.updates = nil
+	}
+	m.progress = nil
+}
+
+// progressView renders the status line of a running operation.
+func (m Model) progressView() string {
+	line := m.status
+	if m.progress != nil {
+		line = m.progress.String()
+		if f, ok := m.progress.Fraction(); ok {
+			line = m.bar.ViewAs(f) + " " + line
+		}
+	}
+	return styles.Subtitle.Render(line) + styles.Help.Render("  Esc to cancel")
+}
+
+// hookNote reports failed hooks; the command named shows them.
+func hookNote(failed int, command string) string {
+	if failed == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d hooks failed (run 'snapfig %s' for details)", failed, command)
+}
+
+// pushHookErrors counts the failed hooks in a push error. A push that
+// only had hooks fail succeeded, so it returns a nil error then.
+func pushHookErrors(err error) (int, error) {
+	if !errors.Is(err, snapfig.ErrHookFailed) {
+		return 0, err
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return len(joined.Unwrap()), nil
+	}
+	return 1, nil
+}
+
 // doRestore restores from vault to original locations.
 func (m *Model) doRestore() tea.Cmd {
 	svc := m.service
+	ctx, report := m.operation()
 	return func() tea.Msg {
 		cfg := svc.Config()
 		if len(cfg.Watching) == 0 {
 			return RestoreDoneMsg{err: fmt.Errorf("no paths configured")}
 		}
 
-		result, err := svc.Restore()
+		result, err := svc.Restore(ctx, report)
 		if err != nil {
 			return RestoreDoneMsg{err: err}
 		}
@@ -508,6 +792,8 @@ func (m *Model) doRestore() tea.Cmd {
 			skipped:      len(result.Skipped),
 			filesUpdated: result.FilesUpdated,
 			filesSkipped: result.FilesSkipped,
+			denied:       len(result.Denied),
+			hookErrors:   len(result.HookErrors),
 		}
 	}
 }
@@ -515,29 +801,33 @@ func (m *Model) doRestore() tea.Cmd {
 // doPush pushes vault to remote.
 func (m *Model) doPush() tea.Cmd {
 	svc := m.service
+	ctx, report := m.operation()
 	return func() tea.Msg {
-		if err := svc.Push(); err != nil {
+		hookErrors, err := pushHookErrors(svc.Push(ctx, report))
+		if err != nil {
 			return PushDoneMsg{err: err}
 		}
-		return PushDoneMsg{}
+		return PushDoneMsg{hookErrors: hookErrors}
 	}
 }
 
 // doPull pulls vault from remote, cloning if needed.
 func (m *Model) doPull() tea.Cmd {
 	svc := m.service
+	ctx, report := m.operation()
 	return func() tea.Msg {
-		result, err := svc.Pull()
+		result, err := svc.Pull(ctx, report)
 		if err != nil {
 			return PullDoneMsg{err: err}
 		}
-		return PullDoneMsg{cloned: result.Cloned}
+		return PullDoneMsg{cloned: result.Cloned, hookErrors: len(result.HookErrors)}
 	}
 }
 
 // doBackup performs copy + push in one step.
 func (m *Model) doBackup() tea.Cmd {
 	svc := m.service
+	ctx, report := m.operation()
 	picker := m.picker
 	configPath := m.configPath
 	return func() tea.Msg {
@@ -547,19 +837,7 @@ func (m *Model) doBackup() tea.Cmd {
 			return BackupDoneMsg{err: fmt.Errorf("no paths selected")}
 		}
 
-		watching := make([]config.Watched, 0, len(selected))
-		for _, sel := range selected {
-			gitMode := config.GitModeRemove
-			if sel.GitMode == screens.StateDisable {
-				gitMode = config.GitModeDisable
-			}
-			watching = append(watching, config.Watched{
-				Path:    sel.Path,
-				Git:     gitMode,
-				Enabled: true,
-			})
-		}
-		svc.UpdateWatching(watching)
+		svc.UpdateWatching(watchingFromSelection(svc.Config().Watching, selected))
 
 		// Save config
 		if err := svc.SaveConfig(configPath); err != nil {
@@ -567,13 +845,14 @@ func (m *Model) doBackup() tea.Cmd {
 		}
 
 		// Copy to vault
-		result, err := svc.Copy()
+		result, err := svc.Copy(ctx, report)
 		if err != nil {
 			return BackupDoneMsg{err: err}
 		}
 
 		// Push
-		if err := svc.Push(); err != nil {
+		pushFailed, err := pushHookErrors(svc.Push(ctx, report))
+		if err != nil {
 			return BackupDoneMsg{err: fmt.Errorf("copied but push failed: %w", err)}
 		}
 
@@ -583,6 +862,8 @@ func (m *Model) doBackup() tea.Cmd {
 			filesUpdated: result.FilesUpdated,
 			filesSkipped: result.FilesSkipped,
 			filesRemoved: result.FilesRemoved,
+			failed:       len(result.Errors),
+			hookErrors:   len(result.HookErrors) + pushFailed,
 		}
 	}
 }
@@ -591,10 +872,11 @@ func (m *Model) doBackup() tea.Cmd {
 // On a new machine (empty config.Watching), it loads paths from the vault manifest.
 func (m *Model) doSync() tea.Cmd {
 	svc := m.service
+	ctx, report := m.operation()
 	configPath := m.configPath
 	return func() tea.Msg {
 		// First, pull (or clone)
-		pullResult, err := svc.Pull()
+		pullResult, err := svc.Pull(ctx, report)
 		if err != nil {
 			return SyncDoneMsg{err: err}
 		}
@@ -617,7 +899,7 @@ func (m *Model) doSync() tea.Cmd {
 			}
 		}
 
-		restoreResult, err := svc.Restore()
+		restoreResult, err := svc.Restore(ctx, report)
 		if err != nil {
 			return SyncDoneMsg{err: fmt.Errorf("pulled but restore failed: %w", err)}
 		}
@@ -629,6 +911,8 @@ func (m *Model) doSync() tea.Cmd {
 			skipped:      len(restoreResult.Skipped),
 			filesUpdated: restoreResult.FilesUpdated,
 			filesSkipped: restoreResult.FilesSkipped,
+			denied:       len(restoreResult.Denied),
+			hookErrors:   len(pullResult.HookErrors) + len(restoreResult.HookErrors),
 		}
 	}
 }
@@ -645,8 +929,9 @@ func (m *Model) initRestorePicker() tea.Cmd {
 // doSelectiveRestore restores only the selected paths.
 func (m *Model) doSelectiveRestore(paths []string) tea.Cmd {
 	svc := m.service
+	ctx, report := m.operation()
 	return func() tea.Msg {
-		result, err := svc.RestoreSelective(paths)
+		result, err := svc.RestoreSelective(ctx, paths, report)
 		if err != nil {
 			return SelectiveRestoreDoneMsg{err: err}
 		}
@@ -657,6 +942,8 @@ func (m *Model) doSelectiveRestore(paths []string) tea.Cmd {
 			skipped:      len(result.Skipped),
 			filesUpdated: result.FilesUpdated,
 			filesSkipped: result.FilesSkipped,
+			denied:       len(result.Denied),
+			hookErrors:   len(result.HookErrors),
 		}
 	}
 }
@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -106,6 +108,12 @@ func TestUpdateCopyDoneMsg(t *testing.T) {
 			wantBusy:   false,
 			wantStatus: "Copied: 5 updated, 2 unchanged, 1 removed",
 		},
+		{
+			name:       "success with findings",
+			msg:        CopyDoneMsg{filesUpdated: 1, findings: 2},
+			wantBusy:   false,
+			wantStatus: "Copied: 1 updated, 0 unchanged, 0 removed, 2 possible secrets (run 'snapfig copy' for details)",
+		},
 		{
 			name:       "error",
 			msg:        CopyDoneMsg{err: errNoPathsSelected},
@@ -690,6 +698,26 @@ func TestDoPushCommand(t *testing.T) {
 	}
 }
 
+func TestDoPushCommandHookFailed(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	mockSvc := snapfig.NewMockService(cfg)
+	mockSvc.PushFunc = func() error {
+		return errors.Join(&snapfig.HookError{Hook: "pre_push", Err: fmt.Errorf("exit status 1")})
+	}
+	model := NewWithService(mockSvc, "/tmp/config.yaml", false)
+
+	pushDone := model.doPush()().(PushDoneMsg)
+	if pushDone.err != nil {
+		t.Errorf("a failed hook should not fail the push: %v", pushDone.err)
+	}
+
+	updated, _ := model.Update(pushDone)
+	m := updated.(Model)
+	if !containsString(m.status, "Pushed to remote") || !containsString(m.status, "1 hooks failed") {
+		t.Errorf("status should report the failed hook, got: %s", m.status)
+	}
+}
+
 func TestDoPullCommand(t *testing.T) {
 	cfg := &config.Config{Git: config.GitModeDisable}
 	mockSvc := snapfig.NewMockService(cfg)
@@ -998,6 +1026,24 @@ func TestUpdateBackupDoneMsgError(t *testing.T) {
 	}
 }
 
+func TestUpdateCopyDoneMsgVaultBusy(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	model := New(cfg, "/tmp/config.yaml", false)
+	model.busy = true
+
+	busy := &snapfig.BusyError{Holder: &snapfig.LockHolder{PID: 4242, Command: "snapfig daemon run"}}
+	msg := CopyDoneMsg{err: busy}
+	updated, _ := model.Update(msg)
+	m := updated.(Model)
+
+	if m.busy {
+		t.Error("busy should be false after error")
+	}
+	if !containsString(m.status, "Vault busy") || !containsString(m.status, "4242") || !containsString(m.status, "snapfig daemon run") {
+		t.Errorf("status should report the busy vault and its holder, got: %s", m.status)
+	}
+}
+
 func TestUpdateSyncDoneMsgError(t *testing.T) {
 	cfg := &config.Config{Git: config.GitModeDisable}
 	model := New(cfg, "/tmp/config.yaml", false)
@@ -1248,3 +1294,152 @@ func TestDoSyncWithExistingConfig(t *testing.T) {
 		t.Error("Restore should have been called")
 	}
 }
+
+func TestWatchingFromSelectionKeepsPathSettings(t *testing.T) {
+	current := []config.Watched{
+		{Path: ".config/nvim", Git: config.GitModeRemove, Enabled: true, Exclude: []string{"lazy-lock.json"}},
+		{Path: ".zshrc", Git: config.GitModeRemove, Enabled: true},
+		{Path: "/etc/hosts", Enabled: true},
+	}
+	selected := []screens.Selection{
+		{Path: ".config/nvim", GitMode: screens.StateDisable},
+		{Path: ".bashrc", GitMode: screens.StateRemove},
+	}
+
+	watching := watchingFromSelection(current, selected)
+
+	if len(watching) != 3 {
+		t.Fatalf("watchingFromSelection() returned %d entries, want 3", len(watching))
+	}
+	if watching[2].Path != "/etc/hosts" {
+		t.Errorf("system path = %+v, want /etc/hosts kept", watching[2])
+	}
+	if watching[0].Git != config.GitModeDisable {
+		t.Errorf("Git = %q, want disable from selection", watching[0].Git)
+	}
+	if len(watching[0].Exclude) != 1 || watching[0].Exclude[0] != "lazy-lock.json" {
+		t.Errorf("Exclude = %v, want carried over", watching[0].Exclude)
+	}
+	if watching[1].Path != ".bashrc" || !watching[1].Enabled {
+		t.Errorf("new entry = %+v, want enabled .bashrc", watching[1])
+	}
+}
+
+func TestPlanDoneMsgShowsPlan(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	mockSvc := snapfig.NewMockService(cfg)
+	model := NewWithService(mockSvc, "/tmp/config.yaml", false)
+	model.busy = true
+
+	plan := &snapfig.CopyPlan{
+		Changes: []snapfig.PlanEntry{{Action: snapfig.PlanRemove, Path: ".config/app/old.conf", Bytes: 12}},
+	}
+	updated, _ := model.Update(PlanDoneMsg{plan: plan})
+	m := updated.(Model)
+
+	if m.busy || m.current != screenPlan {
+		t.Fatalf("plan should be shown, busy = %v, current = %v", m.busy, m.current)
+	}
+	if !containsAll(m.View(), []string{".config/app/old.conf"}) {
+		t.Error("view should list the planned removal")
+	}
+
+	// F2 from the plan goes ahead with the copy
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyF2})
+	m = updated.(Model)
+	if m.current != screenPicker || !m.busy || cmd == nil {
+		t.Error("F2 on the plan should start the copy from the picker")
+	}
+}
+
+func TestPlanEscReturnsToPicker(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	mockSvc := snapfig.NewMockService(cfg)
+	model := NewWithService(mockSvc, "/tmp/config.yaml", false)
+
+	updated, _ := model.Update(PlanDoneMsg{plan: &snapfig.CopyPlan{}})
+	updated, _ = updated.(Model).Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m := updated.(Model)
+
+	if m.current != screenPicker {
+		t.Error("Esc should return to the picker")
+	}
+}
+
+func TestPlanDoneMsgError(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	mockSvc := snapfig.NewMockService(cfg)
+	model := NewWithService(mockSvc, "/tmp/config.yaml", false)
+
+	updated, _ := model.Update(PlanDoneMsg{err: fmt.Errorf("no paths selected")})
+	m := updated.(Model)
+
+	if m.current != screenPicker || !containsAll(m.status, []string{"no paths selected"}) {
+		t.Errorf("status = %q, current = %v", m.status, m.current)
+	}
+}
+
+func TestActionKeyF1Plan(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	mockSvc := snapfig.NewMockService(cfg)
+	model := NewWithService(mockSvc, "/tmp/config.yaml", false)
+
+	updated, cmd := model.Update(tea.KeyMsg{Type: tea.KeyF1})
+	m := updated.(Model)
+
+	if !m.busy || m.status != "Planning copy..." || cmd == nil {
+		t.Errorf("F1 should start planning, status = %q", m.status)
+	}
+}
+
+func TestOperationProgressAndCancel(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	model := NewWithService(snapfig.NewMockService(cfg), "/tmp/config.yaml", false)
+	model.busy = true
+	model.status = "Copying..."
+	ctx, report := model.operation()
+
+	report(snapfig.Progress{Phase: snapfig.PhaseCopying, Path: ".config/nvim", PathsDone: 1, PathsTotal: 4})
+	msg := waitProgress(model.updates)()
+	updated, cmd := model.Update(msg)
+	m := updated.(Model)
+	if m.progress == nil || m.progress.Path != ".config/nvim" {
+		t.Fatalf("progress = %+v, want the report", m.progress)
+	}
+	if cmd == nil {
+		t.Error("Update should keep waiting for progress")
+	}
+	if view := m.View(); !containsString(view, ".config/nvim") || !containsString(view, "Esc to cancel") {
+		t.Errorf("view should show the progress, got: %s", view)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = updated.(Model)
+	if ctx.Err() == nil {
+		t.Error("Esc should cancel the operation")
+	}
+	if m.status != "Cancelling..." || !m.busy {
+		t.Errorf("status = %q, busy = %v; want cancelling until the operation ends", m.status, m.busy)
+	}
+
+	updates := m.updates
+	updated, _ = m.Update(CopyDoneMsg{err: fmt.Errorf("failed to copy .bashrc: %w", context.Canceled)})
+	m = updated.(Model)
+	if m.busy || m.status != cancelledStatus {
+		t.Errorf("status = %q, busy = %v; want %q", m.status, m.busy, cancelledStatus)
+	}
+	if msg := waitProgress(updates)(); msg != nil {
+		t.Errorf("progress of an ended operation should stop, got %v", msg)
+	}
+}
+
+func TestProgressMsgFromEndedOperation(t *testing.T) {
+	cfg := &config.Config{Git: config.GitModeDisable}
+	model := NewWithService(snapfig.NewMockService(cfg), "/tmp/config.yaml", false)
+
+	stale := ProgressMsg{updates: make(chan snapfig.Progress), progress: snapfig.Progress{Phase: snapfig.PhaseCopying}}
+	updated, cmd := model.Update(stale)
+	if m := updated.(Model); m.progress != nil || cmd != nil {
+		t.Error("a report from an ended operation should be ignored")
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/adrianpk/snapfig/internal/config"
 	"github.com/adrianpk/snapfig/internal/paths"
+	"github.com/adrianpk/snapfig/internal/snapfig"
 	"github.com/adrianpk/snapfig/internal/tui/styles"
 )
 
@@ -21,6 +22,8 @@ const (
 	StateNone    SelectState = iota // [ ] not selected
 	StateRemove                     // [x] selected, remove .git
 	StateDisable                    // [g] selected, disable .git
+	StateBundle                     // [b] selected, bundle .git
+	StateReference                  // [r] selected, reference .git by its remote
 )
 
 // SyncStatus represents the synchronization state of a path.
@@ -63,6 +66,7 @@ type PickerModel struct {
 	demoPaths     map[string]bool
 	vaultPath     string          // relative to home, to exclude from listing
 	vaultDir      string          // full path to vault directory
+	host          string          // this machine's vault layer
 	manifestPaths map[string]bool // paths listed in manifest
 }
 
@@ -131,13 +135,19 @@ func NewPicker(cfg *config.Config, demoMode bool) PickerModel {
 // NewPickerWithSync creates a picker with sync status information.
 func NewPickerWithSync(cfg *config.Config, demoMode bool, vaultDir string, manifestPaths []string) PickerModel {
 	preselected := make(map[string]SelectState)
-	var vaultPath string
+	var vaultPath, host string
 	if cfg != nil {
+		host, _ = cfg.Host()
 		for _, w := range cfg.Watching {
 			if w.Enabled {
 				state := StateRemove
-				if w.Git == config.GitModeDisable {
+				switch w.Git {
+				case config.GitModeDisable:
 					state = StateDisable
+				case config.GitModeBundle:
+					state = StateBundle
+				case config.GitModeReference:
+					state = StateReference
 				}
 				preselected[w.Path] = state
 			}
@@ -179,6 +189,7 @@ func NewPickerWithSync(cfg *config.Config, demoMode bool, vaultDir string, manif
 		demoPaths:     demoPaths,
 		vaultPath:     vaultPath,
 		vaultDir:      vaultDir,
+		host:          host,
 		manifestPaths: manifestMap,
 	}
 }
@@ -276,13 +287,17 @@ func (m PickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case " ":
 			if len(m.flat) > 0 {
 				n := m.flat[m.cursor]
-				// Cycle: None -> Remove -> Disable -> None
+				// Cycle: None -> Remove -> Disable -> Bundle -> Reference -> None
 				switch n.state {
 				case StateNone:
 					n.state = StateRemove
 				case StateRemove:
 					n.state = StateDisable
 				case StateDisable:
+					n.state = StateBundle
+				case StateBundle:
+					n.state = StateReference
+				case StateReference:
 					n.state = StateNone
 				}
 				m.propagateState(n)
@@ -483,7 +498,7 @@ func (m PickerModel) View() string {
 	}
 
 	b.WriteString("\n")
-	b.WriteString(styles.Help.Render("↑/↓ navigate • ←/→ collapse/expand • space [x]remove/[g]disable • a all • n none • q quit"))
+	b.WriteString(styles.Help.Render("↑/↓ navigate • ←/→ collapse/expand • space [x]remove/[g]disable/[b]bundle/[r]reference • a all • n none • q quit"))
 
 	return b.String()
 }
@@ -536,6 +551,10 @@ func (m PickerModel) renderNode(n *node, isCursor bool) string {
 		checkbox = styles.CheckedBox
 	case StateDisable:
 		checkbox = styles.GitBox
+	case StateBundle:
+		checkbox = styles.BundleBox
+	case StateReference:
+		checkbox = styles.ReferenceBox
 	}
 
 	icon := ""
@@ -591,9 +610,16 @@ func (m PickerModel) getSyncStatus(path string) SyncStatus {
 	// Check if exists in vault
 	inVault := false
 	if m.vaultDir != "" {
-		vaultPath := filepath.Join(m.vaultDir, path)
-		if _, err := os.Stat(vaultPath); err == nil {
-			inVault = true
+		candidates := []string{filepath.Join(m.vaultDir, path)}
+		if m.host != "" {
+			candidates = append(candidates, filepath.Join(snapfig.HostLayer(m.vaultDir, m.host), path))
+		}
+		for _, vaultPath := range candidates {
+			if _, err := os.Stat(vaultPath); err == nil {
+				inVault = true
+			} else if _, err := os.Stat(vaultPath + snapfig.EncryptedExt); err == nil {
+				inVault = true // single encrypted file
+			}
 		}
 	}
 
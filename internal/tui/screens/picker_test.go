@@ -465,12 +465,28 @@ func TestPickerSpaceKeyToggle(t *testing.T) {
 		t.Errorf("state = %d, want StateDisable after second space", m.flat[0].state)
 	}
 
-	// Third space: Disable -> None
+	// Third space: Disable -> Bundle
+	updated, _ = m.Update(msg)
+	m = updated.(PickerModel)
+
+	if m.flat[0].state != StateBundle {
+		t.Errorf("state = %d, want StateBundle after third space", m.flat[0].state)
+	}
+
+	// Fourth space: Bundle -> Reference
+	updated, _ = m.Update(msg)
+	m = updated.(PickerModel)
+
+	if m.flat[0].state != StateReference {
+		t.Errorf("state = %d, want StateReference after fourth space", m.flat[0].state)
+	}
+
+	// Fifth space: Reference -> None
 	updated, _ = m.Update(msg)
 	m = updated.(PickerModel)
 
 	if m.flat[0].state != StateNone {
-		t.Errorf("state = %d, want StateNone after third space", m.flat[0].state)
+		t.Errorf("state = %d, want StateNone after fifth space", m.flat[0].state)
 	}
 }
 
@@ -984,11 +1000,25 @@ func TestPickerSpaceStateCycle(t *testing.T) {
 		t.Errorf("after second space: state = %d, want StateDisable", file.state)
 	}
 
-	// Space again: StateDisable -> StateNone
+	// Space again: StateDisable -> StateBundle
+	updated, _ = m.Update(msg)
+	m = updated.(PickerModel)
+	if file.state != StateBundle {
+		t.Errorf("after third space: state = %d, want StateBundle", file.state)
+	}
+
+	// Space again: StateBundle -> StateReference
+	updated, _ = m.Update(msg)
+	m = updated.(PickerModel)
+	if file.state != StateReference {
+		t.Errorf("after fourth space: state = %d, want StateReference", file.state)
+	}
+
+	// Space again: StateReference -> StateNone
 	updated, _ = m.Update(msg)
 	m = updated.(PickerModel)
 	if file.state != StateNone {
-		t.Errorf("after third space: state = %d, want StateNone", file.state)
+		t.Errorf("after fifth space: state = %d, want StateNone", file.state)
 	}
 }
 
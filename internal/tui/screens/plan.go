@@ -0,0 +1,156 @@
+package screens
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/adrianpk/snapfig/internal/config"
+	"github.com/adrianpk/snapfig/internal/snapfig"
+	"github.com/adrianpk/snapfig/internal/tui/styles"
+)
+
+// PlanModel shows what a copy would change in the vault.
+type PlanModel struct {
+	plan   *snapfig.CopyPlan
+	lines  []string
+	offset int
+	width  int
+	height int
+	closed bool
+}
+
+// NewPlan creates the plan screen for a computed copy plan.
+func NewPlan(plan *snapfig.CopyPlan) PlanModel {
+	m := PlanModel{plan: plan}
+	m.lines = planLines(plan)
+	return m
+}
+
+var planMarks = map[snapfig.PlanAction]string{
+	snapfig.PlanAdd:    "+",
+	snapfig.PlanModify: "~",
+	snapfig.PlanRemove: "-",
+}
+
+// planLines renders one line per change, .git directory and warning.
+func planLines(plan *snapfig.CopyPlan) []string {
+	var lines []string
+	for _, e := range plan.Changes {
+		path := e.Path
+		if e.IsDir {
+			path += "/"
+		}
+		if e.Link != "" {
+			path += " -> " + e.Link
+		}
+		lines = append(lines, fmt.Sprintf("%s %s (%s)", planMarks[e.Action], path, snapfig.FormatSize(e.Bytes)))
+	}
+	for _, g := range plan.GitDirs {
+		note := "stored as .git_disabled"
+		switch g.Mode {
+		case config.GitModeRemove:
+			note = "left out"
+		case config.GitModeBundle:
+			note = "stored as a bundle"
+		case config.GitModeReference:
+			note = "referenced by its remote"
+		}
+		lines = append(lines, fmt.Sprintf("g %s (%s)", g.Path, note))
+	}
+	for _, p := range plan.Skipped {
+		lines = append(lines, fmt.Sprintf("? %s (not found)", p))
+	}
+	for _, f := range plan.Findings {
+		lines = append(lines, fmt.Sprintf("! %s:%d possible secret (%s)", f.Path, f.Line, f.Rule))
+	}
+	for _, p := range plan.TemplateDrift {
+		lines = append(lines, fmt.Sprintf("! %s drifted from its template", p))
+	}
+	for _, p := range plan.Loops {
+		lines = append(lines, fmt.Sprintf("? %s (symlink loop, not followed)", p))
+	}
+	for _, p := range plan.Special {
+		lines = append(lines, fmt.Sprintf("? %s, left out", p))
+	}
+	return lines
+}
+
+func (m PlanModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m PlanModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if m.offset > 0 {
+				m.offset--
+			}
+		case "down", "j":
+			if m.offset < len(m.lines)-m.maxVisible() {
+				m.offset++
+			}
+		case "esc":
+			m.closed = true
+		}
+	}
+
+	return m, nil
+}
+
+func (m PlanModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(styles.Title.Render("Copy Plan"))
+	b.WriteString("\n")
+	b.WriteString(styles.Subtitle.Render(fmt.Sprintf("%d to add (%s), %d to modify (%s), %d to remove (%s), %d unchanged",
+		m.plan.Count(snapfig.PlanAdd), snapfig.FormatSize(m.plan.AddedBytes),
+		m.plan.Count(snapfig.PlanModify), snapfig.FormatSize(m.plan.ModifiedBytes),
+		m.plan.Count(snapfig.PlanRemove), snapfig.FormatSize(m.plan.RemovedBytes),
+		m.plan.Unchanged)))
+	b.WriteString("\n\n")
+
+	if len(m.lines) == 0 {
+		b.WriteString(styles.Dimmed.Render("Vault is up to date"))
+	}
+
+	end := m.offset + m.maxVisible()
+	if end > len(m.lines) {
+		end = len(m.lines)
+	}
+	for _, line := range m.lines[m.offset:end] {
+		switch line[0] {
+		case '-', '!':
+			b.WriteString(styles.Error.Render(line))
+		case '+', '~':
+			b.WriteString(styles.Normal.Render(line))
+		default:
+			b.WriteString(styles.Dimmed.Render(line))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(styles.Help.Render("↑/↓ scroll • F2 copy • F7 backup • Esc back"))
+
+	return b.String()
+}
+
+func (m PlanModel) maxVisible() int {
+	if m.height > 10 {
+		return m.height - 8
+	}
+	return 15
+}
+
+// WasClosed returns true if the user pressed Esc.
+func (m PlanModel) WasClosed() bool {
+	return m.closed
+}
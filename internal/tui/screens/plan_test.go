@@ -0,0 +1,78 @@
+package screens
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/adrianpk/snapfig/internal/config"
+	"github.com/adrianpk/snapfig/internal/snapfig"
+)
+
+func TestPlanView(t *testing.T) {
+	plan := &snapfig.CopyPlan{
+		Changes: []snapfig.PlanEntry{
+			{Action: snapfig.PlanAdd, Path: ".zshrc", Bytes: 2048},
+			{Action: snapfig.PlanRemove, Path: ".config/old", IsDir: true, Bytes: 5},
+			{Action: snapfig.PlanAdd, Path: ".config/nvim/lua.snapfig-symlink", Bytes: 16, Link: "../lua"},
+		},
+		GitDirs:    []snapfig.GitDirPlan{{Path: ".config/nvim/.git", Mode: config.GitModeDisable}},
+		AddedBytes: 2064,
+		Unchanged:  7,
+	}
+	view := NewPlan(plan).View()
+
+	for _, want := range []string{
+		"Copy Plan",
+		"2 to add (2.0 KB)",
+		"7 unchanged",
+		"+ .zshrc (2.0 KB)",
+		"- .config/old/ (5 B)",
+		"-> ../lua",
+		".config/nvim/.git (stored as .git_disabled)",
+	} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view should contain %q, got:\n%s", want, view)
+		}
+	}
+}
+
+func TestPlanViewUpToDate(t *testing.T) {
+	view := NewPlan(&snapfig.CopyPlan{}).View()
+	if !strings.Contains(view, "Vault is up to date") {
+		t.Errorf("empty plan view = %s", view)
+	}
+}
+
+func TestPlanScrollAndClose(t *testing.T) {
+	plan := &snapfig.CopyPlan{}
+	for i := 0; i < 30; i++ {
+		plan.Changes = append(plan.Changes, snapfig.PlanEntry{Action: snapfig.PlanAdd, Path: string(rune('a'+i%26)) + ".conf"})
+	}
+	m := NewPlan(plan)
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+	m = updated.(PlanModel)
+
+	for i := 0; i < 40; i++ {
+		updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+		m = updated.(PlanModel)
+	}
+	if want := 30 - m.maxVisible(); m.offset != want {
+		t.Errorf("offset = %d, want %d at the bottom", m.offset, want)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyUp})
+	m = updated.(PlanModel)
+	if m.offset != 30-m.maxVisible()-1 {
+		t.Errorf("offset after up = %d", m.offset)
+	}
+
+	if m.WasClosed() {
+		t.Fatal("plan should not be closed yet")
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if !updated.(PlanModel).WasClosed() {
+		t.Error("Esc should close the plan")
+	}
+}
@@ -48,6 +48,8 @@ const (
 	CheckedBox   = "[x]"
 	UncheckedBox = "[ ]"
 	GitBox       = "[g]"
+	BundleBox    = "[b]"
+	ReferenceBox = "[r]"
 	RestoreBox   = "[r]"
 	CursorChar   = ">"
 	NoCursor     = " "